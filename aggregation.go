@@ -0,0 +1,323 @@
+package esmini
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Agg describes an aggregation to run along with a search. Build one with
+// TermsAgg, RangeAgg, HistogramAgg, DateHistogramAgg, CardinalityAgg,
+// StatsAgg or NestedAgg, and add it with the Aggregation SearchOption.
+type Agg struct {
+	kind     string
+	field    string
+	path     string
+	size     int
+	interval float64
+	calendar string
+	ranges   []AggRange
+	subAggs  []namedAgg
+}
+
+type namedAgg struct {
+	name string
+	agg  *Agg
+}
+
+// AggRange is one bucket of a RangeAgg. From is inclusive and To exclusive;
+// leave either nil for an unbounded range. Key defaults to "from-to".
+type AggRange struct {
+	Key  string
+	From interface{}
+	To   interface{}
+}
+
+// TermsAgg buckets documents by the distinct values of field, keeping the
+// size most frequent ones. A size of 0 uses Elasticsearch's default of 10.
+func TermsAgg(field string, size int) *Agg {
+	return &Agg{kind: "terms", field: field, size: size}
+}
+
+func RangeAgg(field string, ranges ...AggRange) *Agg {
+	return &Agg{kind: "range", field: field, ranges: ranges}
+}
+
+// HistogramAgg buckets numeric values of field into fixed size intervals.
+func HistogramAgg(field string, interval float64) *Agg {
+	return &Agg{kind: "histogram", field: field, interval: interval}
+}
+
+// DateHistogramAgg buckets dates of field by a calendar interval, which can
+// be "minute", "hour", "day", "week", "month", "quarter" or "year".
+func DateHistogramAgg(field string, calendarInterval string) *Agg {
+	return &Agg{kind: "date_histogram", field: field, calendar: calendarInterval}
+}
+
+// CardinalityAgg approximates the number of distinct values of field.
+func CardinalityAgg(field string) *Agg {
+	return &Agg{kind: "cardinality", field: field}
+}
+
+// StatsAgg computes the count, min, max, avg and sum of field.
+func StatsAgg(field string) *Agg {
+	return &Agg{kind: "stats", field: field}
+}
+
+// NestedAgg runs its sub-aggregations over the nested objects at path.
+func NestedAgg(path string) *Agg {
+	return &Agg{kind: "nested", path: path}
+}
+
+// SubAgg adds a named aggregation computed for every bucket of a. Metric
+// aggregations have no buckets and ignore sub-aggregations.
+func (a *Agg) SubAgg(name string, sub *Agg) *Agg {
+	a.subAggs = append(a.subAggs, namedAgg{name: name, agg: sub})
+	return a
+}
+
+// Aggregation adds a named aggregation to the search. Results are read from
+// SearchResponse.Aggregations by the same name. Use Limit(0) for
+// aggregation-only queries.
+func Aggregation(name string, agg *Agg) SearchOption {
+	return func(s *searchOption) {
+		s.aggs = append(s.aggs, namedAgg{name: name, agg: agg})
+	}
+}
+
+func (a *Agg) build() elastic.Aggregation {
+	switch a.kind {
+	case "terms":
+		agg := elastic.NewTermsAggregation().Field(a.field)
+		if a.size > 0 {
+			agg.Size(a.size)
+		}
+		for _, s := range a.subAggs {
+			agg.SubAggregation(s.name, s.agg.build())
+		}
+		return agg
+	case "range":
+		agg := elastic.NewRangeAggregation().Field(a.field)
+		for _, r := range a.ranges {
+			if len(r.Key) > 0 {
+				agg.AddRangeWithKey(r.Key, r.From, r.To)
+			} else {
+				agg.AddRange(r.From, r.To)
+			}
+		}
+		for _, s := range a.subAggs {
+			agg.SubAggregation(s.name, s.agg.build())
+		}
+		return agg
+	case "histogram":
+		agg := elastic.NewHistogramAggregation().Field(a.field).Interval(a.interval)
+		for _, s := range a.subAggs {
+			agg.SubAggregation(s.name, s.agg.build())
+		}
+		return agg
+	case "date_histogram":
+		agg := elastic.NewDateHistogramAggregation().Field(a.field).CalendarInterval(a.calendar)
+		for _, s := range a.subAggs {
+			agg.SubAggregation(s.name, s.agg.build())
+		}
+		return agg
+	case "cardinality":
+		return elastic.NewCardinalityAggregation().Field(a.field)
+	case "stats":
+		return elastic.NewStatsAggregation().Field(a.field)
+	case "nested":
+		agg := elastic.NewNestedAggregation().Path(a.path)
+		for _, s := range a.subAggs {
+			agg.SubAggregation(s.name, s.agg.build())
+		}
+		return agg
+	}
+	return nil
+}
+
+// Aggregations holds the raw aggregation results of a search or bucket,
+// keyed by aggregation name.
+type Aggregations map[string]json.RawMessage
+
+// Bucket is one bucket of a bucket aggregation. Its sub-aggregation results
+// are available through the embedded Aggregations.
+type Bucket struct {
+	Key         interface{}
+	KeyAsString string
+	DocCount    int64
+	From        *float64
+	To          *float64
+	Aggregations
+}
+
+// KeyString returns the formatted key of the bucket, the way Elasticsearch
+// renders dates and booleans, falling back to the key itself.
+func (b Bucket) KeyString() string {
+	if len(b.KeyAsString) > 0 {
+		return b.KeyAsString
+	}
+	if s, ok := b.Key.(string); ok {
+		return s
+	}
+	raw, _ := json.Marshal(b.Key)
+	return string(raw)
+}
+
+// Stats is the result of a StatsAgg. Min, Max and Avg are 0 when no
+// document has the field.
+type Stats struct {
+	Count int64
+	Min   float64
+	Max   float64
+	Avg   float64
+	Sum   float64
+}
+
+// Buckets returns the buckets of a terms, range, histogram or date histogram
+// aggregation, in the order Elasticsearch returned them.
+func (a Aggregations) Buckets(name string) ([]Bucket, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return nil, false
+	}
+	var agg struct {
+		Buckets json.RawMessage `json:"buckets"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil || len(agg.Buckets) == 0 {
+		return nil, false
+	}
+
+	var list []json.RawMessage
+	var keys []string
+	if err := json.Unmarshal(agg.Buckets, &list); err != nil {
+		// Keyed aggregations return an object; keep its order.
+		if keys, list, err = orderedObject(agg.Buckets); err != nil {
+			return nil, false
+		}
+	}
+
+	buckets := make([]Bucket, 0, len(list))
+	for j, item := range list {
+		b, ok := decodeBucket(item)
+		if !ok {
+			return nil, false
+		}
+		if b.Key == nil && keys != nil {
+			b.Key = keys[j]
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, true
+}
+
+// Bucket returns the single bucket of a nested aggregation.
+func (a Aggregations) Bucket(name string) (Bucket, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return Bucket{}, false
+	}
+	return decodeBucket(raw)
+}
+
+// Value returns the value of a single value metric aggregation.
+func (a Aggregations) Value(name string) (float64, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return 0, false
+	}
+	var agg struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil || agg.Value == nil {
+		return 0, false
+	}
+	return *agg.Value, true
+}
+
+func (a Aggregations) Cardinality(name string) (int64, bool) {
+	v, ok := a.Value(name)
+	return int64(v), ok
+}
+
+func (a Aggregations) Stats(name string) (Stats, bool) {
+	raw, ok := a[name]
+	if !ok {
+		return Stats{}, false
+	}
+	var agg struct {
+		Count *int64   `json:"count"`
+		Min   *float64 `json:"min"`
+		Max   *float64 `json:"max"`
+		Avg   *float64 `json:"avg"`
+		Sum   float64  `json:"sum"`
+	}
+	if err := json.Unmarshal(raw, &agg); err != nil || agg.Count == nil {
+		return Stats{}, false
+	}
+	stats := Stats{Count: *agg.Count, Sum: agg.Sum}
+	if agg.Min != nil {
+		stats.Min = *agg.Min
+	}
+	if agg.Max != nil {
+		stats.Max = *agg.Max
+	}
+	if agg.Avg != nil {
+		stats.Avg = *agg.Avg
+	}
+	return stats, true
+}
+
+func decodeBucket(raw json.RawMessage) (Bucket, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return Bucket{}, false
+	}
+	var b Bucket
+	if v, ok := fields["doc_count"]; ok {
+		if err := json.Unmarshal(v, &b.DocCount); err != nil {
+			return Bucket{}, false
+		}
+	} else {
+		return Bucket{}, false
+	}
+	if v, ok := fields["key"]; ok {
+		_ = json.Unmarshal(v, &b.Key)
+	}
+	if v, ok := fields["key_as_string"]; ok {
+		_ = json.Unmarshal(v, &b.KeyAsString)
+	}
+	if v, ok := fields["from"]; ok {
+		_ = json.Unmarshal(v, &b.From)
+	}
+	if v, ok := fields["to"]; ok {
+		_ = json.Unmarshal(v, &b.To)
+	}
+	for _, k := range []string{"doc_count", "key", "key_as_string", "from", "from_as_string", "to", "to_as_string"} {
+		delete(fields, k)
+	}
+	b.Aggregations = Aggregations(fields)
+	return b, true
+}
+
+func orderedObject(raw json.RawMessage) ([]string, []json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	var keys []string
+	var values []json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var v json.RawMessage
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, tok.(string))
+		values = append(values, v)
+	}
+	return keys, values, nil
+}
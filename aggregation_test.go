@@ -0,0 +1,112 @@
+package esmini
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type review struct {
+	Author string `json:"author" es:"type=keyword"`
+	Stars  int    `json:"stars"`
+}
+
+type product struct {
+	ID       string    `json:"id" esmini:"id" es:"type=keyword"`
+	Name     string    `json:"name"`
+	Category string    `json:"category" es:"type=keyword"`
+	Price    float64   `json:"price"`
+	Created  time.Time `json:"created"`
+	Reviews  []review  `json:"reviews" es:"type=nested"`
+}
+
+func products() []interface{} {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 12, 0, 0, 0, time.UTC) }
+	return []interface{}{
+		product{ID: "1", Name: "red shirt", Category: "shirts", Price: 10, Created: day(1),
+			Reviews: []review{{Author: "alice", Stars: 5}, {Author: "bob", Stars: 3}}},
+		product{ID: "2", Name: "blue shirt", Category: "shirts", Price: 25, Created: day(1),
+			Reviews: []review{{Author: "alice", Stars: 4}}},
+		product{ID: "3", Name: "red shoes", Category: "shoes", Price: 80, Created: day(3)},
+	}
+}
+
+func TestSearchAggregations(t *testing.T) {
+	index := "products"
+	_, client := setupFake(t, index, products()...)
+
+	sClient := NewSearchClient(client)
+	res, err := sClient.Search(context.TODO(), index, "", nil,
+		Limit(0),
+		Aggregation("categories", TermsAgg("category", 10).SubAgg("price", StatsAgg("price"))),
+		Aggregation("prices", RangeAgg("price", AggRange{Key: "cheap", To: 20}, AggRange{From: 20})),
+		Aggregation("histogram", HistogramAgg("price", 50)),
+		Aggregation("per_day", DateHistogramAgg("created", "day")),
+		Aggregation("names", CardinalityAgg("category")),
+		Aggregation("reviews", NestedAgg("reviews").SubAgg("authors", TermsAgg("reviews.author", 0))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Hits != 0 || res.TotalHits != 3 {
+		t.Fatalf("expected %v hits of %v, but got %v of %v\n", 0, 3, res.Hits, res.TotalHits)
+	}
+
+	categories, ok := res.Aggregations.Buckets("categories")
+	if !ok || len(categories) != 2 {
+		t.Fatalf("expected %v buckets, but got %v\n", 2, categories)
+	}
+	if categories[0].Key != "shirts" || categories[0].DocCount != 2 {
+		t.Fatalf("expected shirts with %v docs, but got %v with %v\n", 2, categories[0].Key, categories[0].DocCount)
+	}
+	stats, ok := categories[0].Stats("price")
+	if !ok || stats.Count != 2 || stats.Min != 10 || stats.Max != 25 || stats.Avg != 17.5 || stats.Sum != 35 {
+		t.Fatalf("unexpected stats %+v\n", stats)
+	}
+
+	prices, ok := res.Aggregations.Buckets("prices")
+	if !ok || len(prices) != 2 {
+		t.Fatalf("expected %v buckets, but got %v\n", 2, prices)
+	}
+	if prices[0].KeyString() != "cheap" || prices[0].DocCount != 1 || prices[0].From != nil {
+		t.Fatalf("unexpected bucket %+v\n", prices[0])
+	}
+	if prices[1].KeyString() != "20.0-*" || prices[1].DocCount != 2 || *prices[1].From != 20 {
+		t.Fatalf("unexpected bucket %+v\n", prices[1])
+	}
+
+	histogram, ok := res.Aggregations.Buckets("histogram")
+	if !ok || len(histogram) != 2 || histogram[0].DocCount != 2 || histogram[1].Key != 50.0 {
+		t.Fatalf("unexpected buckets %+v\n", histogram)
+	}
+
+	days, ok := res.Aggregations.Buckets("per_day")
+	if !ok || len(days) != 3 {
+		t.Fatalf("expected %v buckets, but got %v\n", 3, days)
+	}
+	for i, expected := range []int64{2, 0, 1} {
+		if days[i].DocCount != expected {
+			t.Fatalf("expected %v, but got %v\n", expected, days[i].DocCount)
+		}
+	}
+	if days[0].KeyString() != "2020-01-01T00:00:00.000Z" {
+		t.Fatalf("expected %v, but got %v\n", "2020-01-01T00:00:00.000Z", days[0].KeyString())
+	}
+
+	if n, ok := res.Aggregations.Cardinality("names"); !ok || n != 2 {
+		t.Fatalf("expected %v, but got %v\n", 2, n)
+	}
+
+	reviews, ok := res.Aggregations.Bucket("reviews")
+	if !ok || reviews.DocCount != 3 {
+		t.Fatalf("expected %v nested docs, but got %v\n", 3, reviews.DocCount)
+	}
+	authors, ok := reviews.Buckets("authors")
+	if !ok || len(authors) != 2 || authors[0].KeyString() != "alice" || authors[0].DocCount != 2 {
+		t.Fatalf("unexpected buckets %+v\n", authors)
+	}
+
+	if _, ok := res.Aggregations.Buckets("missing"); ok {
+		t.Fatal("expected no buckets for an unknown aggregation")
+	}
+}
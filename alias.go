@@ -0,0 +1,176 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// AliasAction is one change of an UpdateAliases request. Build it with
+// AddAliasAction, RemoveAliasAction or RemoveIndexAction:
+//
+//	esmini.AddAliasAction("tweets_v2", "tweets").WriteIndex(true)
+type AliasAction struct {
+	op         string
+	index      string
+	alias      string
+	filter     []BoolQueriesWithClauseOption
+	rawFilter  map[string]interface{}
+	writeIndex *bool
+}
+
+// AddAliasAction points alias at index, in addition to the indices it
+// already points at.
+func AddAliasAction(index, alias string) *AliasAction {
+	return &AliasAction{op: "add", index: index, alias: alias}
+}
+
+// RemoveAliasAction removes alias from index. It fails if index has no
+// such alias.
+func RemoveAliasAction(index, alias string) *AliasAction {
+	return &AliasAction{op: "remove", index: index, alias: alias}
+}
+
+// RemoveIndexAction deletes index along with its aliases.
+func RemoveIndexAction(index string) *AliasAction {
+	return &AliasAction{op: "remove_index", index: index}
+}
+
+// Filter limits the documents searched through the alias to those matching
+// every clause, built like the BoolQueriesWithClause search option. It only
+// applies to AddAliasAction.
+func (a *AliasAction) Filter(clauses []BoolQueriesWithClauseOption) *AliasAction {
+	a.filter = clauses
+	return a
+}
+
+// WriteIndex marks index as the one the alias sends writes to when it
+// points at several indices. It only applies to AddAliasAction.
+func (a *AliasAction) WriteIndex(writeIndex bool) *AliasAction {
+	a.writeIndex = &writeIndex
+	return a
+}
+
+func (a *AliasAction) build() (elastic.AliasAction, error) {
+	switch a.op {
+	case "add":
+		action := elastic.NewAliasAddAction(a.alias).Index(a.index)
+		if len(a.filter) > 0 {
+			query, err := (&searchOption{boolQueriesWithClause: a.filter}).query("", nil)
+			if err != nil {
+				return nil, err
+			}
+			action = action.Filter(query)
+		} else if len(a.rawFilter) > 0 {
+			b, err := json.Marshal(a.rawFilter)
+			if err != nil {
+				return nil, err
+			}
+			action = action.Filter(elastic.NewRawStringQuery(string(b)))
+		}
+		if a.writeIndex != nil {
+			action = action.IsWriteIndex(*a.writeIndex)
+		}
+		return action, nil
+	case "remove":
+		return elastic.NewAliasRemoveAction(a.alias).Index(a.index), nil
+	}
+	return elastic.NewAliasRemoveIndexAction(a.index), nil
+}
+
+// UpdateAliases applies actions atomically: either all of them take effect
+// or none does, so that an alias can be moved between indices without a
+// moment where it points at neither.
+func (i *IndexClient) UpdateAliases(ctx context.Context, actions ...*AliasAction) error {
+	if len(actions) == 0 {
+		return errors.New("esmini: no alias actions")
+	}
+	svc := i.raw.Alias()
+	for _, a := range actions {
+		action, err := a.build()
+		if err != nil {
+			return err
+		}
+		svc = svc.Action(action)
+	}
+	_, err := svc.Do(ctx)
+	return err
+}
+
+// CreateAlias points alias at index.
+func (i *IndexClient) CreateAlias(ctx context.Context, index, alias string) error {
+	return i.UpdateAliases(ctx, AddAliasAction(index, alias))
+}
+
+// RemoveAlias removes alias from index.
+func (i *IndexClient) RemoveAlias(ctx context.Context, index, alias string) error {
+	return i.UpdateAliases(ctx, RemoveAliasAction(index, alias))
+}
+
+// SwapAlias atomically moves alias from the index from to the index to.
+func (i *IndexClient) SwapAlias(ctx context.Context, alias, from, to string) error {
+	return i.UpdateAliases(ctx, RemoveAliasAction(from, alias), AddAliasAction(to, alias))
+}
+
+// Alias is an alias on one index, as listed by Aliases.
+type Alias struct {
+	Name       string
+	Index      string
+	Filter     map[string]interface{}
+	WriteIndex bool
+}
+
+// Aliases lists the aliases with the given names, which may contain
+// wildcards, or every alias without names. Names without an alias are left
+// out rather than reported as an error. The result is sorted by alias name
+// and index.
+func (i *IndexClient) Aliases(ctx context.Context, names ...string) ([]Alias, error) {
+	path := "/_alias"
+	if len(names) > 0 {
+		path += "/" + url.PathEscape(strings.Join(names, ","))
+	}
+	res, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:       http.MethodGet,
+		Path:         path,
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var indices map[string]json.RawMessage
+	if err := json.Unmarshal(res.Body, &indices); err != nil {
+		return nil, err
+	}
+	var aliases []Alias
+	for index, raw := range indices {
+		if index == "error" || index == "status" {
+			continue
+		}
+		var def struct {
+			Aliases map[string]struct {
+				Filter       map[string]interface{} `json:"filter"`
+				IsWriteIndex bool                   `json:"is_write_index"`
+			} `json:"aliases"`
+		}
+		if err := json.Unmarshal(raw, &def); err != nil {
+			return nil, err
+		}
+		for name, a := range def.Aliases {
+			aliases = append(aliases, Alias{Name: name, Index: index, Filter: a.Filter, WriteIndex: a.IsWriteIndex})
+		}
+	}
+	sort.Slice(aliases, func(a, b int) bool {
+		if aliases[a].Name != aliases[b].Name {
+			return aliases[a].Name < aliases[b].Name
+		}
+		return aliases[a].Index < aliases[b].Index
+	})
+	return aliases, nil
+}
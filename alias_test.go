@@ -0,0 +1,87 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestAliases(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(6)...)
+
+	ctx := context.TODO()
+	if _, err := client.CreateIndex(ctx, "counters-archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateAlias(ctx, "counters", "current"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.IndexDoc(ctx, "current", counter{ID: "7", Count: 7}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.DocCount("counters") != 7 {
+		t.Fatalf("expected %v, but got %v\n", 7, srv.DocCount("counters"))
+	}
+
+	if err := client.UpdateAliases(ctx,
+		AddAliasAction("counters", "even").Filter([]BoolQueriesWithClauseOption{{Target: "tags", Query: "even"}}),
+		AddAliasAction("counters-archive", "current"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	count, err := NewRepository[counter](client, "even").Count(ctx, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expected %v, but got %v\n", 3, count)
+	}
+	if _, err := client.IndexDoc(ctx, "current", counter{ID: "8", Count: 8}); err == nil {
+		t.Fatal("expected an error without a write index")
+	}
+	if err := client.UpdateAliases(ctx, AddAliasAction("counters-archive", "current").WriteIndex(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.IndexDoc(ctx, "current", counter{ID: "8", Count: 8}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.DocCount("counters-archive") != 1 {
+		t.Fatalf("expected %v, but got %v\n", 1, srv.DocCount("counters-archive"))
+	}
+
+	aliases, err := client.Aliases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 3 || aliases[0].Name != "current" || aliases[0].Index != "counters" || !aliases[1].WriteIndex || aliases[2].Filter == nil {
+		t.Fatalf("unexpected aliases %v\n", aliases)
+	}
+
+	err = client.UpdateAliases(ctx, AddAliasAction("counters", "tmp"), RemoveAliasAction("counters", "missing"))
+	var esErr *elastic.Error
+	if !errors.As(err, &esErr) || esErr.Status != 404 {
+		t.Fatalf("expected a not found error, but got %v\n", err)
+	}
+	if aliases, _ := client.Aliases(ctx, "tmp"); len(aliases) != 0 {
+		t.Fatalf("expected no alias, but got %v\n", aliases)
+	}
+	if err := client.CreateAlias(ctx, "counters", "counters-archive"); err == nil {
+		t.Fatal("expected an error for an alias named like an index")
+	}
+
+	if err := client.SwapAlias(ctx, "even", "counters", "counters-archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveAlias(ctx, "counters", "current"); err != nil {
+		t.Fatal(err)
+	}
+	aliases, err = client.Aliases(ctx, "current", "even")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 2 || aliases[0].Index != "counters-archive" || aliases[1].Index != "counters-archive" || aliases[1].Filter != nil {
+		t.Fatalf("unexpected aliases %v\n", aliases)
+	}
+}
@@ -0,0 +1,203 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// BulkAction is one operation of a Bulk request. Build it with IndexAction,
+// CreateAction, UpdateAction, UpsertAction, ScriptAction or DeleteAction
+// and refine it with its setters:
+//
+//	esmini.DeleteAction("1").Index("tweets").IfSeqNo(seqNo, primaryTerm)
+type BulkAction struct {
+	op              string
+	index           string
+	id              string
+	routing         string
+	doc             interface{}
+	upsert          interface{}
+	docAsUpsert     bool
+	script          *Script
+	ifSeqNo         *int64
+	ifPrimaryTerm   *int64
+	version         *int64
+	retryOnConflict int
+}
+
+// IndexAction indexes doc, replacing any document with the same ID. The ID
+// and routing are read from doc's struct tags unless set explicitly.
+func IndexAction(doc interface{}) *BulkAction {
+	return &BulkAction{op: "index", doc: doc}
+}
+
+// CreateAction indexes doc like IndexAction, but fails if a document with
+// the same ID exists.
+func CreateAction(doc interface{}) *BulkAction {
+	return &BulkAction{op: "create", doc: doc}
+}
+
+// UpdateAction merges doc, a struct or a map of fields, into the document
+// id. It fails if the document does not exist.
+func UpdateAction(id string, doc interface{}) *BulkAction {
+	return &BulkAction{op: "update", id: id, doc: doc}
+}
+
+// UpsertAction merges doc into the document id, or indexes doc when the
+// document does not exist.
+func UpsertAction(id string, doc interface{}) *BulkAction {
+	return &BulkAction{op: "update", id: id, doc: doc, docAsUpsert: true}
+}
+
+// ScriptAction updates the document id with script. Use Upsert to index a
+// document when it does not exist.
+func ScriptAction(id string, script Script) *BulkAction {
+	return &BulkAction{op: "update", id: id, script: &script}
+}
+
+func DeleteAction(id string) *BulkAction {
+	return &BulkAction{op: "delete", id: id}
+}
+
+// Index overrides the index passed to Bulk for this action.
+func (a *BulkAction) Index(index string) *BulkAction {
+	a.index = index
+	return a
+}
+
+func (a *BulkAction) ID(id string) *BulkAction {
+	a.id = id
+	return a
+}
+
+func (a *BulkAction) Routing(routing string) *BulkAction {
+	a.routing = routing
+	return a
+}
+
+// IfSeqNo applies the action only if the document was last written with
+// seqNo and primaryTerm.
+func (a *BulkAction) IfSeqNo(seqNo, primaryTerm int64) *BulkAction {
+	a.ifSeqNo, a.ifPrimaryTerm = &seqNo, &primaryTerm
+	return a
+}
+
+// Version applies an index, create or delete action only if version is
+// higher than the document's external version, which it then becomes.
+func (a *BulkAction) Version(version int64) *BulkAction {
+	a.version = &version
+	return a
+}
+
+// RetryOnConflict retries an update that conflicts with a concurrent write.
+func (a *BulkAction) RetryOnConflict(retries int) *BulkAction {
+	a.retryOnConflict = retries
+	return a
+}
+
+// Upsert is indexed by a ScriptAction or UpdateAction when the document
+// does not exist.
+func (a *BulkAction) Upsert(doc interface{}) *BulkAction {
+	a.upsert = doc
+	return a
+}
+
+func (a *BulkAction) request(index string, bulkOpt *bulkOption) (elastic.BulkableRequest, error) {
+	if len(a.index) > 0 {
+		index = a.index
+	}
+	if a.op != "index" && a.op != "create" && len(a.id) == 0 {
+		return nil, fmt.Errorf("esmini: %s action needs an ID", a.op)
+	}
+	if a.version != nil && a.op == "update" {
+		return nil, errors.New("esmini: update actions do not support versions, use IfSeqNo")
+	}
+
+	switch a.op {
+	case "index", "create":
+		meta, err := readDocMeta(a.doc, bulkOpt.docID)
+		if err != nil {
+			return nil, err
+		}
+		req := elastic.NewBulkIndexRequest().OpType(a.op).Index(index).Doc(a.doc)
+		switch {
+		case len(a.id) > 0:
+			req = req.Id(a.id)
+		case meta.hasID:
+			req = req.Id(meta.id)
+		}
+		switch {
+		case len(a.routing) > 0:
+			req = req.Routing(a.routing)
+		case len(meta.routing) > 0:
+			req = req.Routing(meta.routing)
+		case len(meta.parent) > 0:
+			req = req.Routing(meta.parent)
+		}
+		switch {
+		case a.version != nil:
+			req = req.Version(*a.version).VersionType("external")
+		case meta.hasVersion:
+			req = req.Version(meta.version).VersionType("external")
+		}
+		if a.ifSeqNo != nil {
+			req = req.IfSeqNo(*a.ifSeqNo).IfPrimaryTerm(*a.ifPrimaryTerm)
+		}
+		return req, nil
+	case "update":
+		req := elastic.NewBulkUpdateRequest().Index(index).Id(a.id)
+		if a.script != nil {
+			req = req.Script(a.script.build())
+		} else {
+			req = req.Doc(a.doc).DocAsUpsert(a.docAsUpsert)
+		}
+		if a.upsert != nil {
+			req = req.Upsert(a.upsert)
+		}
+		if len(a.routing) > 0 {
+			req = req.Routing(a.routing)
+		}
+		if a.retryOnConflict > 0 {
+			req = req.RetryOnConflict(a.retryOnConflict)
+		}
+		if a.ifSeqNo != nil {
+			req = req.IfSeqNo(*a.ifSeqNo).IfPrimaryTerm(*a.ifPrimaryTerm)
+		}
+		return req, nil
+	}
+
+	req := elastic.NewBulkDeleteRequest().Index(index).Id(a.id)
+	if len(a.routing) > 0 {
+		req = req.Routing(a.routing)
+	}
+	if a.version != nil {
+		req = req.Version(*a.version).VersionType("external")
+	}
+	if a.ifSeqNo != nil {
+		req = req.IfSeqNo(*a.ifSeqNo).IfPrimaryTerm(*a.ifPrimaryTerm)
+	}
+	return req, nil
+}
+
+// Bulk sends actions in one bulk request. Actions without their own index
+// go to index, which may be empty otherwise. Failed actions are reported
+// by a *BulkError whose positions are indices into actions.
+func (i *IndexClient) Bulk(ctx context.Context, index string, actions []*BulkAction, opts ...BulkOption) (*elastic.BulkResponse, error) {
+	bulkOpt := &bulkOption{}
+	for _, opt := range opts {
+		opt(bulkOpt)
+	}
+
+	reqs := make([]elastic.BulkableRequest, 0, len(actions))
+	for pos, action := range actions {
+		req, err := action.request(index, bulkOpt)
+		if err != nil {
+			return nil, fmt.Errorf("%w (bulk action %d)", err, pos)
+		}
+		reqs = append(reqs, req)
+	}
+	return i.bulk(ctx, index, reqs, bulkOpt)
+}
@@ -0,0 +1,82 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type counter struct {
+	ID    string   `json:"id" esmini:"id"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestBulk(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	if _, err := client.Bulk(ctx, index, []*BulkAction{
+		IndexAction(counter{ID: "1", Count: 1}),
+		IndexAction(counter{ID: "2", Count: 2}),
+		IndexAction(counter{ID: "3", Count: 3}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var current counter
+	res, err := client.Get(ctx, index, "3", &current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res2, err := client.Bulk(ctx, index, []*BulkAction{
+		CreateAction(counter{ID: "4", Count: 4}),
+		CreateAction(counter{ID: "1", Count: 10}),
+		UpdateAction("2", map[string]interface{}{"count": 20}),
+		UpsertAction("5", counter{ID: "5", Count: 5}),
+		ScriptAction("1", Script{Source: "ctx._source.count += params.n; ctx._source.tags = params.tags", Params: map[string]interface{}{"n": 2, "tags": []string{"a"}}}),
+		ScriptAction("6", Script{Source: "ctx._source.count += 1"}).Upsert(counter{ID: "6", Count: 60}),
+		DeleteAction("3").IfSeqNo(*res.SeqNo, *res.PrimaryTerm),
+		DeleteAction("4").IfSeqNo(0, 1),
+		IndexAction(counter{ID: "7", Count: 7}).Index("others").Routing("r"),
+	})
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Items) != 2 {
+		t.Fatalf("expected %v failures, but got %v\n", 2, err)
+	}
+	if bulkErr.Items[0].Position != 1 || bulkErr.Items[1].Position != 7 || bulkErr.Items[1].Status != 409 {
+		t.Fatalf("expected conflicts at %v and %v, but got %v\n", 1, 7, bulkErr.Items)
+	}
+	if len(res2.Items) != 9 || res2.Items[4]["update"].Result != "updated" || res2.Items[6]["delete"].Result != "deleted" {
+		t.Fatalf("unexpected response items %v\n", res2.Items)
+	}
+
+	expected := map[string]int{"1": 3, "2": 20, "4": 4, "5": 5, "6": 60}
+	for id, count := range expected {
+		var c counter
+		if _, err := client.Get(ctx, index, id, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Count != count {
+			t.Fatalf("expected %v for %v, but got %v\n", count, id, c.Count)
+		}
+	}
+	var one counter
+	if _, err := client.Get(ctx, index, "1", &one); err != nil || len(one.Tags) != 1 {
+		t.Fatalf("expected tags %v, but got %v (%v)\n", []string{"a"}, one.Tags, err)
+	}
+	if _, err := client.Get(ctx, index, "3", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v\n", ErrNotFound, err)
+	}
+	if got, err := client.Get(ctx, "others", "7", nil, GetRouting("r")); err != nil || got.Routing != "r" {
+		t.Fatalf("expected routing %v, but got %v (%v)\n", "r", got, err)
+	}
+
+	if _, err := client.Bulk(ctx, index, []*BulkAction{DeleteAction("")}); err == nil {
+		t.Fatal("expected an error for a delete without an ID")
+	}
+	if _, err := client.Bulk(ctx, index, []*BulkAction{UpdateAction("1", counter{}).Version(2)}); err == nil {
+		t.Fatal("expected an error for a versioned update")
+	}
+}
@@ -0,0 +1,44 @@
+package esmini
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BulkItemError describes a document rejected by a bulk request.
+// Position is its index in the input passed to BulkInsert, or in the order
+// documents were added to a BulkIndexer.
+type BulkItemError struct {
+	Position int
+	DocID    string
+	Status   int
+	Type     string
+	Reason   string
+}
+
+func (e BulkItemError) Retryable() bool {
+	return isRetryableStatus(e.Status)
+}
+
+func (e BulkItemError) String() string {
+	return fmt.Sprintf("[%d] id=%q status=%d %s: %s", e.Position, e.DocID, e.Status, e.Type, e.Reason)
+}
+
+// BulkError is returned by BulkInsert, and by BulkIndexer's Flush and Close,
+// when at least one document failed.
+type BulkError struct {
+	Items []BulkItemError
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		msgs = append(msgs, item.String())
+	}
+	return fmt.Sprintf("esmini: %d bulk items failed: %s", len(e.Items), strings.Join(msgs, "; "))
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
@@ -0,0 +1,362 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	DefaultBulkWorkers    = 1
+	DefaultBulkFlushDocs  = 1000
+	DefaultBulkFlushBytes = 5 << 20
+	DefaultBulkQueueSize  = 1000
+)
+
+var ErrBulkIndexerClosed = errors.New("bulk indexer is closed")
+
+// Workers sets the number of bulk requests a BulkIndexer sends in parallel.
+func Workers(workers int) BulkOption {
+	return func(b *bulkOption) {
+		b.workers = workers
+	}
+}
+
+// FlushDocs flushes a worker once it holds the given number of documents.
+// It also caps the bulk requests of BulkInsertSlice, BulkInsertChan and
+// BulkInsertNDJSON. Use -1 to disable.
+func FlushDocs(docs int) BulkOption {
+	return func(b *bulkOption) {
+		b.flushDocs = docs
+	}
+}
+
+// FlushBytes flushes a worker once its request body reaches the given size,
+// and caps the streaming BulkInsert variants likewise. Use -1 to disable.
+func FlushBytes(bytes int) BulkOption {
+	return func(b *bulkOption) {
+		b.flushBytes = bytes
+	}
+}
+
+// FlushInterval flushes every worker periodically. It is disabled by default.
+func FlushInterval(interval time.Duration) BulkOption {
+	return func(b *bulkOption) {
+		b.flushInterval = interval
+	}
+}
+
+// QueueSize is the number of documents a BulkIndexer buffers before Add
+// blocks.
+func QueueSize(size int) BulkOption {
+	return func(b *bulkOption) {
+		b.queueSize = size
+	}
+}
+
+// OnFlush is called after every bulk request a BulkIndexer sends.
+func OnFlush(fn func(BulkFlushStats)) BulkOption {
+	return func(b *bulkOption) {
+		b.onFlush = fn
+	}
+}
+
+type BulkFlushStats struct {
+	ExecutionID int64
+	Docs        int
+	Succeeded   int
+	Failed      int
+	Took        time.Duration
+	Err         error
+}
+
+type bulkIndexerItem struct {
+	req     elastic.BulkableRequest
+	flushed chan error
+}
+
+type BulkIndexer struct {
+	index     string
+	bulkOpt   *bulkOption
+	processor *elastic.BulkProcessor
+	queue     chan bulkIndexerItem
+	done      chan struct{}
+	mu        sync.RWMutex
+	closed    bool
+
+	// failMu guards the documents in flight, the retries waiting to be
+	// added again and the failures not reported by Flush or Close yet.
+	failMu   sync.Mutex
+	retried  *sync.Cond
+	added    int
+	inFlight map[elastic.BulkableRequest]*bulkIndexerDoc
+	retrying int
+	failures []BulkItemError
+}
+
+// bulkIndexerDoc is a document sent by a BulkIndexer: its position among
+// the added documents and how often it was retried.
+type bulkIndexerDoc struct {
+	position int
+	retry    int
+}
+
+func (i *IndexClient) NewBulkIndexer(ctx context.Context, index string, opts ...BulkOption) (*BulkIndexer, error) {
+	bulkOpt := &bulkOption{
+		workers:    DefaultBulkWorkers,
+		flushDocs:  DefaultBulkFlushDocs,
+		flushBytes: DefaultBulkFlushBytes,
+		queueSize:  DefaultBulkQueueSize,
+	}
+	for _, opt := range opts {
+		opt(bulkOpt)
+	}
+	if len(bulkOpt.refresh) > 0 {
+		// The bulk processor has no way to set the refresh parameter.
+		return nil, errors.New("esmini: BulkIndexer does not support BulkRefresh, call Refresh after Flush instead")
+	}
+
+	if bulkOpt.retryBackoff == nil {
+		// The bulk processor's default.
+		bulkOpt.retryBackoff = elastic.NewExponentialBackoff(200*time.Millisecond, 10*time.Second)
+	}
+
+	b := &BulkIndexer{
+		index:    index,
+		bulkOpt:  bulkOpt,
+		queue:    make(chan bulkIndexerItem, bulkOpt.queueSize),
+		done:     make(chan struct{}),
+		inFlight: make(map[elastic.BulkableRequest]*bulkIndexerDoc),
+	}
+	b.retried = sync.NewCond(&b.failMu)
+	// Items are retried by after rather than by the processor, whose
+	// response to a retry only holds the retried items.
+	processor, err := i.raw.BulkProcessor().
+		Workers(bulkOpt.workers).
+		BulkActions(bulkOpt.flushDocs).
+		BulkSize(bulkOpt.flushBytes).
+		FlushInterval(bulkOpt.flushInterval).
+		Stats(true).
+		Backoff(bulkOpt.retryBackoff).
+		RetryItemStatusCodes().
+		After(b.after).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.processor = processor
+	go b.run()
+
+	return b, nil
+}
+
+func newBulkFlushStats(id int64, reqs []elastic.BulkableRequest, res *elastic.BulkResponse, err error) BulkFlushStats {
+	stats := BulkFlushStats{
+		ExecutionID: id,
+		Docs:        len(reqs),
+		Err:         err,
+	}
+	if res == nil {
+		stats.Failed = len(reqs)
+		return stats
+	}
+	stats.Took = time.Duration(res.Took) * time.Millisecond
+	for _, item := range res.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				stats.Succeeded++
+			} else {
+				stats.Failed++
+			}
+		}
+	}
+	return stats
+}
+
+// after records the failed items of a bulk request for Flush and Close,
+// adds those rejected with a retryable status again once the backoff allows,
+// and calls OnFlush.
+func (b *BulkIndexer) after(id int64, reqs []elastic.BulkableRequest, res *elastic.BulkResponse, err error) {
+	b.failMu.Lock()
+	for j, req := range reqs {
+		doc := b.inFlight[req]
+		if res == nil || j >= len(res.Items) {
+			e := BulkItemError{Position: doc.position}
+			if err != nil {
+				e.Reason = err.Error()
+			}
+			b.failures = append(b.failures, e)
+			delete(b.inFlight, req)
+			continue
+		}
+		for _, r := range res.Items[j] {
+			if r.Status >= 200 && r.Status <= 299 {
+				delete(b.inFlight, req)
+				continue
+			}
+			if isRetryableStatus(r.Status) {
+				if wait, ok := b.bulkOpt.retryBackoff.Next(doc.retry); ok {
+					doc.retry++
+					b.retrying++
+					go b.retry(req, wait)
+					continue
+				}
+			}
+			e := BulkItemError{Position: doc.position, DocID: r.Id, Status: r.Status}
+			if r.Error != nil {
+				e.Type, e.Reason = r.Error.Type, r.Error.Reason
+			}
+			b.failures = append(b.failures, e)
+			delete(b.inFlight, req)
+		}
+	}
+	b.failMu.Unlock()
+
+	if b.bulkOpt.onFlush != nil {
+		b.bulkOpt.onFlush(newBulkFlushStats(id, reqs, res, err))
+	}
+}
+
+// retry adds req to the processor again after wait. It runs in its own
+// goroutine, as the processor's workers may all be busy.
+func (b *BulkIndexer) retry(req elastic.BulkableRequest, wait time.Duration) {
+	time.Sleep(wait)
+	b.processor.Add(req)
+
+	b.failMu.Lock()
+	b.retrying--
+	b.retried.Broadcast()
+	b.failMu.Unlock()
+}
+
+// flush flushes the processor until no document waits for a retry.
+func (b *BulkIndexer) flush() error {
+	for {
+		if err := b.processor.Flush(); err != nil {
+			return err
+		}
+		b.failMu.Lock()
+		if b.retrying == 0 {
+			b.failMu.Unlock()
+			return nil
+		}
+		for b.retrying > 0 {
+			b.retried.Wait()
+		}
+		b.failMu.Unlock()
+	}
+}
+
+// takeFailures returns the items failed since the last call as a
+// *BulkError, or nil.
+func (b *BulkIndexer) takeFailures() error {
+	b.failMu.Lock()
+	defer b.failMu.Unlock()
+	if len(b.failures) == 0 {
+		return nil
+	}
+	err := &BulkError{Items: b.failures}
+	b.failures = nil
+	return err
+}
+
+func (b *BulkIndexer) run() {
+	defer close(b.done)
+	for item := range b.queue {
+		if item.flushed != nil {
+			item.flushed <- b.flush()
+			continue
+		}
+		b.processor.Add(item.req)
+	}
+}
+
+// Add queues doc for indexing. It blocks while the queue is full, until
+// ctx is done.
+func (b *BulkIndexer) Add(ctx context.Context, doc interface{}) error {
+	req, err := newBulkIndexRequest(b.index, doc, b.bulkOpt)
+	if err != nil {
+		return err
+	}
+	if len(b.bulkOpt.pipeline) > 0 {
+		req = req.Pipeline(b.bulkOpt.pipeline)
+	}
+
+	// The position is recorded first, as the request may be sent before
+	// enqueue returns.
+	b.failMu.Lock()
+	b.inFlight[req] = &bulkIndexerDoc{position: b.added}
+	b.added++
+	b.failMu.Unlock()
+	if err := b.enqueue(ctx, bulkIndexerItem{req: req}); err != nil {
+		b.failMu.Lock()
+		delete(b.inFlight, req)
+		b.failMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (b *BulkIndexer) enqueue(ctx context.Context, item bulkIndexerItem) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrBulkIndexerClosed
+	}
+
+	select {
+	case b.queue <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush sends every document added so far and waits for the bulk requests
+// to complete, including the retries of documents rejected with 429 or 503. Documents that failed since the previous Flush are returned
+// as a *BulkError, positioned in the order they were added.
+func (b *BulkIndexer) Flush(ctx context.Context) error {
+	flushed := make(chan error, 1)
+	if err := b.enqueue(ctx, bulkIndexerItem{flushed: flushed}); err != nil {
+		return err
+	}
+	select {
+	case err := <-flushed:
+		if err != nil {
+			return err
+		}
+		return b.takeFailures()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *BulkIndexer) Stats() elastic.BulkProcessorStats {
+	return b.processor.Stats()
+}
+
+// Close sends the remaining documents and stops the workers. Like Flush, it
+// returns the documents that failed since the previous Flush as a
+// *BulkError.
+func (b *BulkIndexer) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	<-b.done
+	if err := b.flush(); err != nil {
+		return err
+	}
+	if err := b.processor.Close(); err != nil {
+		return err
+	}
+	return b.takeFailures()
+}
@@ -0,0 +1,196 @@
+package esmini
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkIndexer(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	index := "tweets_with_id"
+	var mu sync.Mutex
+	var flushes []BulkFlushStats
+	indexer, err := client.NewBulkIndexer(context.TODO(), index,
+		DocID("ID"),
+		Workers(2),
+		FlushDocs(10),
+		QueueSize(5),
+		OnFlush(func(stats BulkFlushStats) {
+			mu.Lock()
+			defer mu.Unlock()
+			flushes = append(flushes, stats)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 25; i++ {
+		tw := tweetWithID{ID: i, Message: "message", Retweets: i, Created: time.Now()}
+		if err := indexer.Add(context.TODO(), tw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := indexer.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if srv.DocCount(index) != 25 {
+		t.Fatalf("expected %v, but got %v\n", 25, srv.DocCount(index))
+	}
+
+	if err := indexer.Add(context.TODO(), tweetWithID{ID: 26, Message: "message"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.DocCount(index) != 26 {
+		t.Fatalf("expected %v, but got %v\n", 26, srv.DocCount(index))
+	}
+	if err := indexer.Add(context.TODO(), tweetWithID{ID: 27}); err != ErrBulkIndexerClosed {
+		t.Fatalf("expected %v, but got %v\n", ErrBulkIndexerClosed, err)
+	}
+
+	stats := indexer.Stats()
+	if stats.Succeeded != 26 {
+		t.Fatalf("expected %v, but got %v\n", 26, stats.Succeeded)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	succeeded := 0
+	for _, f := range flushes {
+		if f.Err != nil {
+			t.Fatal(f.Err)
+		}
+		if f.Docs > 10 {
+			t.Fatalf("expected at most %v docs per flush, but got %v\n", 10, f.Docs)
+		}
+		succeeded += f.Succeeded
+	}
+	if succeeded != 26 {
+		t.Fatalf("expected %v, but got %v\n", 26, succeeded)
+	}
+}
+
+func TestBulkIndexerAddCanceled(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	indexer, err := client.NewBulkIndexer(context.TODO(), "tweets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if err := indexer.Flush(ctx); err != context.Canceled {
+		t.Fatalf("expected %v, but got %v\n", context.Canceled, err)
+	}
+}
+
+func TestBulkIndexerRefresh(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	if _, err := client.NewBulkIndexer(context.TODO(), "tweets", BulkRefresh(RefreshTrue)); err == nil {
+		t.Fatal("expected an error for BulkRefresh")
+	}
+}
+
+func TestBulkIndexerFailures(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	index := "tweets_with_id"
+	indexer, err := client.NewBulkIndexer(context.TODO(), index, DocID("ID"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+
+	srv.FailNextBulkItems(2, 400, "mapper_parsing_exception", "failed to parse")
+	for i := 1; i <= 3; i++ {
+		if err := indexer.Add(context.TODO(), tweetWithID{ID: i, Message: "message"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = indexer.Flush(context.TODO())
+	bulkErr, ok := err.(*BulkError)
+	if !ok {
+		t.Fatalf("expected *BulkError, but got %v\n", err)
+	}
+	if len(bulkErr.Items) != 2 || bulkErr.Items[1].Position != 1 || bulkErr.Items[1].DocID != "2" || bulkErr.Items[1].Status != 400 {
+		t.Fatalf("unexpected item errors %v\n", bulkErr.Items)
+	}
+	if srv.DocCount(index) != 1 {
+		t.Fatalf("expected %v, but got %v\n", 1, srv.DocCount(index))
+	}
+
+	if err := indexer.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNextBulkItems(1, 400, "mapper_parsing_exception", "failed to parse")
+	if err := indexer.Add(context.TODO(), tweetWithID{ID: 4, Message: "message"}); err != nil {
+		t.Fatal(err)
+	}
+	if bulkErr, ok = indexer.Close().(*BulkError); !ok || len(bulkErr.Items) != 1 || bulkErr.Items[0].Position != 3 {
+		t.Fatalf("expected a *BulkError for position %v, but got %v\n", 3, bulkErr)
+	}
+}
+
+func TestBulkIndexerRetry(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	index := "tweets_with_id"
+	var mu sync.Mutex
+	succeeded := 0
+	indexer, err := client.NewBulkIndexer(context.TODO(), index,
+		DocID("ID"),
+		RetryBackoff(time.Millisecond, time.Second),
+		OnFlush(func(stats BulkFlushStats) {
+			mu.Lock()
+			defer mu.Unlock()
+			succeeded += stats.Succeeded
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexer.Close()
+
+	srv.FailNextBulkItems(1, 429, "es_rejected_execution_exception", "rejected execution")
+	for i := 1; i <= 5; i++ {
+		if err := indexer.Add(context.TODO(), tweetWithID{ID: i, Message: "message"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := indexer.Flush(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+	if srv.DocCount(index) != 5 {
+		t.Fatalf("expected %v, but got %v\n", 5, srv.DocCount(index))
+	}
+	mu.Lock()
+	if succeeded != 5 {
+		t.Fatalf("expected %v, but got %v\n", 5, succeeded)
+	}
+	mu.Unlock()
+
+	// A backoff that gives up at once reports the rejected item.
+	noRetry, err := client.NewBulkIndexer(context.TODO(), index, DocID("ID"), RetryBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNextBulkItems(1, 429, "es_rejected_execution_exception", "rejected execution")
+	for i := 6; i <= 7; i++ {
+		if err := noRetry.Add(context.TODO(), tweetWithID{ID: i, Message: "message"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bulkErr, ok := noRetry.Close().(*BulkError)
+	if !ok || len(bulkErr.Items) != 1 || bulkErr.Items[0].Position != 0 || !bulkErr.Items[0].Retryable() {
+		t.Fatalf("expected a retryable *BulkError for position %v, but got %v\n", 0, bulkErr)
+	}
+}
@@ -0,0 +1,241 @@
+package esmini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// BulkInsertSlice indexes docs like BulkInsert. Documents are sent in
+// bulk requests of FlushDocs documents or FlushBytes bytes, whichever
+// comes first. Every document is checked before the first request, so an
+// invalid one means nothing is indexed.
+func BulkInsertSlice[T any](ctx context.Context, client *IndexClient, index string, docs []T, opts ...BulkOption) (*elastic.BulkResponse, error) {
+	bulkOpt := newStreamBulkOption(opts)
+	reqs := make([]elastic.BulkableRequest, 0, len(docs))
+	for pos, doc := range docs {
+		req, err := newBulkIndexRequest(index, doc, bulkOpt)
+		if err != nil {
+			return nil, fmt.Errorf("esmini: document %d: %w", pos, err)
+		}
+		reqs = append(reqs, req)
+	}
+
+	pos := 0
+	return client.bulkStream(ctx, index, bulkOpt, func() (elastic.BulkableRequest, bool, error) {
+		if pos == len(reqs) {
+			return nil, false, nil
+		}
+		pos++
+		return reqs[pos-1], true, nil
+	})
+}
+
+// BulkInsertChan indexes the documents received from docs until it is
+// closed, sending a bulk request every FlushDocs documents or FlushBytes
+// bytes. Only one request's worth of documents is held in memory. An
+// invalid document stops the insert; the documents received since the last
+// request are not sent.
+func BulkInsertChan[T any](ctx context.Context, client *IndexClient, index string, docs <-chan T, opts ...BulkOption) (*elastic.BulkResponse, error) {
+	bulkOpt := newStreamBulkOption(opts)
+	pos := 0
+	return client.bulkStream(ctx, index, bulkOpt, func() (elastic.BulkableRequest, bool, error) {
+		select {
+		case doc, ok := <-docs:
+			if !ok {
+				return nil, false, nil
+			}
+			req, err := newBulkIndexRequest(index, doc, bulkOpt)
+			if err != nil {
+				return nil, false, fmt.Errorf("esmini: document %d: %w", pos, err)
+			}
+			pos++
+			return req, true, nil
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	})
+}
+
+// BulkInsertNDJSON indexes the newline-delimited JSON documents read from r,
+// one per line, in bulk requests like BulkInsertChan. Blank lines are
+// skipped. With DocID, the ID is read from the JSON field of that name
+// instead of a Go field; otherwise IDs are generated.
+func (i *IndexClient) BulkInsertNDJSON(ctx context.Context, index string, r io.Reader, opts ...BulkOption) (*elastic.BulkResponse, error) {
+	bulkOpt := newStreamBulkOption(opts)
+	reader := bufio.NewReader(r)
+	line := 0
+	return i.bulkStream(ctx, index, bulkOpt, func() (elastic.BulkableRequest, bool, error) {
+		for {
+			b, err := reader.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return nil, false, err
+			}
+			if len(b) == 0 && err == io.EOF {
+				return nil, false, nil
+			}
+			line++
+			b = bytes.TrimSpace(b)
+			if len(b) == 0 {
+				continue
+			}
+			req, err := newNDJSONIndexRequest(index, b, bulkOpt)
+			if err != nil {
+				return nil, false, fmt.Errorf("esmini: line %d: %w", line, err)
+			}
+			return req, true, nil
+		}
+	})
+}
+
+func newNDJSONIndexRequest(index string, doc []byte, bulkOpt *bulkOption) (*elastic.BulkIndexRequest, error) {
+	if !json.Valid(doc) {
+		return nil, errors.New("invalid JSON document")
+	}
+	req := elastic.NewBulkIndexRequest().Index(index).Doc(json.RawMessage(doc))
+	if len(bulkOpt.docID) == 0 {
+		return req, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMissingDocID, err)
+	}
+	var s string
+	switch id := fields[bulkOpt.docID].(type) {
+	case nil:
+		return nil, fmt.Errorf("%w: no field %s", ErrMissingDocID, bulkOpt.docID)
+	case string:
+		s = id
+	case json.Number:
+		// Formatting a float would merge distinct IDs such as 1.5 and 2.
+		if strings.ContainsAny(id.String(), ".eE") {
+			return nil, fmt.Errorf("esmini: field %s: ID must be an integer, got %s", bulkOpt.docID, id)
+		}
+		if s = id.String(); s == "-0" {
+			s = "0"
+		}
+	default:
+		return nil, fmt.Errorf("esmini: field %s: ID must be a string or an integer, got %v", bulkOpt.docID, id)
+	}
+	if s == "" || s == "0" {
+		return nil, fmt.Errorf("%w: field %s", ErrZeroDocID, bulkOpt.docID)
+	}
+	return req.Id(s), nil
+}
+
+func newStreamBulkOption(opts []BulkOption) *bulkOption {
+	bulkOpt := &bulkOption{
+		flushDocs:  DefaultBulkFlushDocs,
+		flushBytes: DefaultBulkFlushBytes,
+	}
+	for _, opt := range opts {
+		opt(bulkOpt)
+	}
+	return bulkOpt
+}
+
+// bulkStream sends the requests next yields in chunks bounded by the
+// flushDocs and flushBytes options. The returned response and *BulkError
+// cover every chunk, with positions counted from the start of the stream.
+// When next fails, the pending chunk is dropped and the error is returned
+// with the response for the chunks already sent; it also matches the
+// *BulkError of their failed items, if any.
+func (i *IndexClient) bulkStream(ctx context.Context, index string, bulkOpt *bulkOption, next func() (elastic.BulkableRequest, bool, error)) (*elastic.BulkResponse, error) {
+	result := &elastic.BulkResponse{}
+	bulkErr := &BulkError{}
+	var chunk []elastic.BulkableRequest
+	chunkBytes, sent := 0, 0
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		res, err := i.bulk(ctx, index, chunk, bulkOpt)
+		var chunkErr *BulkError
+		if errors.As(err, &chunkErr) {
+			for _, item := range chunkErr.Items {
+				item.Position += sent
+				bulkErr.Items = append(bulkErr.Items, item)
+			}
+		} else if err != nil {
+			return err
+		}
+		result.Took += res.Took
+		result.Errors = result.Errors || res.Errors
+		result.Items = append(result.Items, res.Items...)
+		sent += len(chunk)
+		chunk, chunkBytes = nil, 0
+		return nil
+	}
+
+	for {
+		req, ok, err := next()
+		if err != nil {
+			if len(bulkErr.Items) > 0 {
+				return result, &streamError{err: err, bulkErr: bulkErr}
+			}
+			return result, err
+		}
+		if !ok {
+			break
+		}
+		chunk = append(chunk, req)
+		if bulkOpt.flushBytes > 0 {
+			lines, err := req.Source()
+			if err != nil {
+				return result, err
+			}
+			for _, l := range lines {
+				chunkBytes += len(l) + 1
+			}
+		}
+		if (bulkOpt.flushDocs > 0 && len(chunk) >= bulkOpt.flushDocs) ||
+			(bulkOpt.flushBytes > 0 && chunkBytes >= bulkOpt.flushBytes) {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+
+	if len(bulkErr.Items) > 0 {
+		return result, bulkErr
+	}
+	return result, nil
+}
+
+// streamError is a request-building error from a bulk stream whose earlier
+// chunks had failed items. It unwraps to the former and converts to the
+// latter with errors.As.
+type streamError struct {
+	err     error
+	bulkErr *BulkError
+}
+
+func (e *streamError) Error() string {
+	return fmt.Sprintf("%v; earlier %v", e.err, e.bulkErr)
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+func (e *streamError) As(target interface{}) bool {
+	if t, ok := target.(**BulkError); ok {
+		*t = e.bulkErr
+		return true
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBulkInsertSlice(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	tweets := []taggedTweet{{ID: 1, Message: "one"}, {ID: 2, Message: "two"}, {ID: 3, Message: "three"}}
+	res, err := BulkInsertSlice(context.TODO(), client, "tweets", tweets, FlushDocs(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 3 || res.Items[2]["index"].Id != "3" || srv.DocCount("tweets") != 3 {
+		t.Fatalf("expected %v, but got %v\n", 3, srv.DocCount("tweets"))
+	}
+
+	mixed := []interface{}{taggedTweet{ID: 4}, taggedTweet{ID: 5}, taggedTweet{ID: 6}, "not a document", taggedTweet{ID: 7}}
+	_, err = BulkInsertSlice(context.TODO(), client, "tweets", mixed, FlushDocs(2))
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Items) != 1 || bulkErr.Items[0].Position != 3 {
+		t.Fatalf("expected a failure at %v, but got %v\n", 3, err)
+	}
+	if srv.DocCount("tweets") != 7 {
+		t.Fatalf("expected %v, but got %v\n", 7, srv.DocCount("tweets"))
+	}
+
+	zero := []taggedTweet{{ID: 8}, {ID: 9}, {ID: 0}, {ID: 10}}
+	_, err = BulkInsertSlice(context.TODO(), client, "tweets", zero, FlushDocs(2))
+	if !errors.Is(err, ErrZeroDocID) || !strings.Contains(err.Error(), "document 2") {
+		t.Fatalf("expected %v on document 2, but got %v\n", ErrZeroDocID, err)
+	}
+	if srv.DocCount("tweets") != 7 {
+		t.Fatalf("expected %v, but got %v\n", 7, srv.DocCount("tweets"))
+	}
+}
+
+func TestBulkInsertChan(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	docs := make(chan taggedTweet)
+	go func() {
+		defer close(docs)
+		for id := 1; id <= 25; id++ {
+			docs <- taggedTweet{ID: id, Message: "message"}
+		}
+	}()
+	res, err := BulkInsertChan(context.TODO(), client, "tweets", docs, FlushDocs(10), FlushBytes(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 25 || srv.DocCount("tweets") != 25 {
+		t.Fatalf("expected %v, but got %v\n", 25, srv.DocCount("tweets"))
+	}
+
+	mixed := make(chan interface{}, 4)
+	mixed <- taggedTweet{ID: 26}
+	mixed <- "not a document"
+	mixed <- taggedTweet{ID: 27}
+	mixed <- taggedTweet{ID: 0}
+	close(mixed)
+	_, err = BulkInsertChan(context.TODO(), client, "tweets", mixed, FlushDocs(2))
+	if !errors.Is(err, ErrZeroDocID) || !strings.Contains(err.Error(), "document 3") {
+		t.Fatalf("expected %v on document 3, but got %v\n", ErrZeroDocID, err)
+	}
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || len(bulkErr.Items) != 1 || bulkErr.Items[0].Position != 1 {
+		t.Fatalf("expected a failure at %v, but got %v\n", 1, err)
+	}
+	if srv.DocCount("tweets") != 26 {
+		t.Fatalf("expected %v, but got %v\n", 26, srv.DocCount("tweets"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := BulkInsertChan(ctx, client, "tweets", make(chan taggedTweet)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, but got %v\n", context.Canceled, err)
+	}
+}
+
+func TestBulkInsertNDJSON(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	input := `{"id": 1, "message": "one"}
+
+{"id": 2, "message": "two"}
+{"id": "three", "message": "three"}`
+	res, err := client.BulkInsertNDJSON(context.TODO(), "tweets", strings.NewReader(input), DocID("id"), FlushBytes(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Items) != 3 || res.Items[0]["index"].Id != "1" || res.Items[2]["index"].Id != "three" {
+		t.Fatalf("unexpected response items %v\n", res.Items)
+	}
+
+	_, err = client.BulkInsertNDJSON(context.TODO(), "tweets", strings.NewReader("{\"id\": 4}\n{\"message\": \"no id\"}\n"), DocID("id"))
+	if !errors.Is(err, ErrMissingDocID) || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected %v on line 2, but got %v\n", ErrMissingDocID, err)
+	}
+	if srv.DocCount("tweets") != 3 {
+		t.Fatalf("expected %v, but got %v\n", 3, srv.DocCount("tweets"))
+	}
+
+	if _, err := client.BulkInsertNDJSON(context.TODO(), "tweets", strings.NewReader("{not json}\n")); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+
+	res, err = client.BulkInsertNDJSON(context.TODO(), "big", strings.NewReader(`{"id": 9007199254740993}`+"\n"+`{"id": 9007199254740992}`), DocID("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Items[0]["index"].Id != "9007199254740993" || srv.DocCount("big") != 2 {
+		t.Fatalf("expected %v documents, but got %v\n", 2, res.Items)
+	}
+	for _, line := range []string{`{"id": 1.5}`, `{"id": 1e3}`, `{"id": true}`} {
+		if _, err := client.BulkInsertNDJSON(context.TODO(), "big", strings.NewReader(line), DocID("id")); err == nil {
+			t.Fatalf("expected an error for %v\n", line)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// AutoSlices lets Elasticsearch pick the number of slices, one per shard.
+const AutoSlices = -1
+
+type byQueryOption struct {
+	slices    int
+	proceed   bool
+	rps       float64
+	batchSize int
+	refresh   RefreshPolicy
+	reindex   reindexOption
+}
+
+// ByQueryOption configures UpdateByQuery, DeleteByQuery, their Async
+// variants and Reindex. ReindexQuery, ReindexScript and ReindexPipeline
+// only apply to Reindex; the others reject them.
+type ByQueryOption func(*byQueryOption)
+
+func newByQueryOption(opts []ByQueryOption) *byQueryOption {
+	bOpt := &byQueryOption{}
+	for _, opt := range opts {
+		opt(bOpt)
+	}
+	return bOpt
+}
+
+// newByQueryOnlyOption is newByQueryOption for the by query requests,
+// failing on the options of Reindex rather than ignoring them.
+func newByQueryOnlyOption(opts []ByQueryOption) (*byQueryOption, error) {
+	bOpt := newByQueryOption(opts)
+	if r := bOpt.reindex; len(r.clauses) > 0 || r.script != nil || len(r.pipeline) > 0 {
+		return nil, errors.New("esmini: ReindexQuery, ReindexScript and ReindexPipeline only apply to Reindex")
+	}
+	return bOpt, nil
+}
+
+// ByQuerySlices splits the request into n slices processed in parallel.
+// Pass AutoSlices to use one slice per shard.
+func ByQuerySlices(n int) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.slices = n
+	}
+}
+
+// ProceedOnConflicts counts version conflicts, such as documents changed
+// while the request runs, and goes on instead of stopping at the first one.
+func ProceedOnConflicts() ByQueryOption {
+	return func(b *byQueryOption) {
+		b.proceed = true
+	}
+}
+
+// RequestsPerSecond throttles the request to rps documents per second.
+// A running Task can be rethrottled.
+func RequestsPerSecond(rps float64) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.rps = rps
+	}
+}
+
+// BatchSize sets how many documents are read and written per batch.
+// Defaults to 1000.
+func BatchSize(n int) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.batchSize = n
+	}
+}
+
+// ByQueryRefresh refreshes the affected indices once the request is done.
+// Elasticsearch does not support RefreshWaitFor here, so it refreshes too.
+// Defaults to the client's refresh policy.
+func ByQueryRefresh(policy RefreshPolicy) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.refresh = policy
+	}
+}
+
+// DeleteByQuery deletes the documents of index matching every clause,
+// built like the BoolQueriesWithClause search option. It returns a
+// *ByQueryError if documents failed or changed since they were matched,
+// unless ProceedOnConflicts is given.
+func (i *IndexClient) DeleteByQuery(ctx context.Context, index string, clauses []BoolQueriesWithClauseOption, opts ...ByQueryOption) (*elastic.BulkIndexByScrollResponse, error) {
+	bOpt, err := newByQueryOnlyOption(opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := byQueryBody(clauses, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return i.byQuery(ctx, index, "_delete_by_query", body, bOpt)
+}
+
+// DeleteByQueryAsync starts DeleteByQuery as a background Task.
+func (i *IndexClient) DeleteByQueryAsync(ctx context.Context, index string, clauses []BoolQueriesWithClauseOption, opts ...ByQueryOption) (*Task, error) {
+	bOpt, err := newByQueryOnlyOption(opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := byQueryBody(clauses, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	return i.startTask(ctx, "/"+url.PathEscape(index)+"/_delete_by_query", "_delete_by_query", i.byQueryParams(bOpt), body)
+}
+
+// UpdateByQuery runs script on the documents of index matching every
+// clause, or rewrites them as they are with a nil script, e.g. to pick up
+// mapping changes. No clauses matches every document. Errors are reported
+// like DeleteByQuery.
+func (i *IndexClient) UpdateByQuery(ctx context.Context, index string, clauses []BoolQueriesWithClauseOption, script *Script, opts ...ByQueryOption) (*elastic.BulkIndexByScrollResponse, error) {
+	bOpt, err := newByQueryOnlyOption(opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := byQueryBody(clauses, script, false)
+	if err != nil {
+		return nil, err
+	}
+	return i.byQuery(ctx, index, "_update_by_query", body, bOpt)
+}
+
+// UpdateByQueryAsync starts UpdateByQuery as a background Task.
+func (i *IndexClient) UpdateByQueryAsync(ctx context.Context, index string, clauses []BoolQueriesWithClauseOption, script *Script, opts ...ByQueryOption) (*Task, error) {
+	bOpt, err := newByQueryOnlyOption(opts)
+	if err != nil {
+		return nil, err
+	}
+	body, err := byQueryBody(clauses, script, false)
+	if err != nil {
+		return nil, err
+	}
+	return i.startTask(ctx, "/"+url.PathEscape(index)+"/_update_by_query", "_update_by_query", i.byQueryParams(bOpt), body)
+}
+
+func byQueryBody(clauses []BoolQueriesWithClauseOption, script *Script, requireQuery bool) (map[string]interface{}, error) {
+	if requireQuery && len(clauses) == 0 {
+		return nil, errors.New("esmini: delete by query needs at least one clause")
+	}
+	body := map[string]interface{}{}
+	if len(clauses) > 0 {
+		query, err := (&searchOption{boolQueriesWithClause: clauses}).query("", nil)
+		if err != nil {
+			return nil, err
+		}
+		src, err := query.Source()
+		if err != nil {
+			return nil, err
+		}
+		body["query"] = src
+	}
+	if script != nil {
+		src, err := script.build().Source()
+		if err != nil {
+			return nil, err
+		}
+		body["script"] = src
+	}
+	return body, nil
+}
+
+func (i *IndexClient) byQuery(ctx context.Context, index, endpoint string, body map[string]interface{}, bOpt *byQueryOption) (*elastic.BulkIndexByScrollResponse, error) {
+	res, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:       http.MethodPost,
+		Path:         "/" + url.PathEscape(index) + "/" + endpoint,
+		Params:       i.byQueryParams(bOpt),
+		Body:         body,
+		IgnoreErrors: []int{http.StatusConflict},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &elastic.BulkIndexByScrollResponse{}
+	if err := json.Unmarshal(res.Body, result); err != nil {
+		return nil, err
+	}
+	return byQueryResult(result)
+}
+
+// startTask sends a request with wait_for_completion=false to path and
+// returns the task it started. endpoint is the API the task is
+// rethrottled through.
+func (i *IndexClient) startTask(ctx context.Context, path, endpoint string, params url.Values, body map[string]interface{}) (*Task, error) {
+	params.Set("wait_for_completion", "false")
+	res, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   path,
+		Params: params,
+		Body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var started elastic.StartTaskResult
+	if err := json.Unmarshal(res.Body, &started); err != nil {
+		return nil, err
+	}
+	return &Task{ID: started.TaskId, client: i, endpoint: endpoint}, nil
+}
+
+func (i *IndexClient) byQueryParams(bOpt *byQueryOption) url.Values {
+	params := i.taskParams(bOpt)
+	if bOpt.proceed {
+		params.Set("conflicts", "proceed")
+	}
+	if bOpt.batchSize > 0 {
+		params.Set("scroll_size", strconv.Itoa(bOpt.batchSize))
+	}
+	return params
+}
+
+// taskParams returns the URL parameters shared by the by-query APIs and
+// reindex.
+func (i *IndexClient) taskParams(bOpt *byQueryOption) url.Values {
+	params := url.Values{}
+	switch {
+	case bOpt.slices == AutoSlices:
+		params.Set("slices", "auto")
+	case bOpt.slices != 0:
+		params.Set("slices", strconv.Itoa(bOpt.slices))
+	}
+	if bOpt.rps > 0 {
+		params.Set("requests_per_second", formatRequestsPerSecond(bOpt.rps))
+	}
+	switch refresh := i.refreshPolicy(bOpt.refresh, ""); refresh {
+	case "":
+	case string(RefreshWaitFor):
+		params.Set("refresh", string(RefreshTrue))
+	default:
+		params.Set("refresh", refresh)
+	}
+	return params
+}
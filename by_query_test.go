@@ -0,0 +1,175 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kazu1029/esmini/esminitest"
+	"github.com/olivere/elastic/v7"
+)
+
+func counters(n int) []interface{} {
+	docs := make([]interface{}, 0, n)
+	for id := 1; id <= n; id++ {
+		c := counter{ID: strconv.Itoa(id), Count: id}
+		if id%2 == 0 {
+			c.Tags = []string{"even"}
+		}
+		docs = append(docs, c)
+	}
+	return docs
+}
+
+func TestUpdateByQuery(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(6)...)
+
+	ctx := context.TODO()
+	even := []BoolQueriesWithClauseOption{{Target: "tags", Query: "even", Clause: "filter"}}
+	res, err := client.UpdateByQuery(ctx, "counters", even, &Script{
+		Source: "ctx._source.count += params.n",
+		Params: map[string]interface{}{"n": 10},
+	}, ByQuerySlices(AutoSlices), BatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || res.Updated != 3 || res.Batches != 2 {
+		t.Fatalf("expected %v updated in %v batches, but got %v in %v\n", 3, 2, res.Updated, res.Batches)
+	}
+	var c counter
+	if _, err := client.Get(ctx, "counters", "4", &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Count != 14 {
+		t.Fatalf("expected %v, but got %v\n", 14, c.Count)
+	}
+
+	res, err = client.UpdateByQuery(ctx, "counters", nil, &Script{Source: "ctx.op = 'noop'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 6 || res.Noops != 6 {
+		t.Fatalf("expected %v noops, but got %v\n", 6, res.Noops)
+	}
+
+	res, err = client.UpdateByQuery(ctx, "counters", nil, nil, ByQueryRefresh(RefreshWaitFor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated != 6 || srv.Refreshes() != 1 {
+		t.Fatalf("expected %v updated and a refresh, but got %v and %v\n", 6, res.Updated, srv.Refreshes())
+	}
+
+	if _, err := client.UpdateByQuery(ctx, "counters", nil, nil, ByQuerySlices(-2)); err == nil {
+		t.Fatal("expected an error for invalid slices")
+	}
+	if _, err := client.UpdateByQuery(ctx, "missing", nil, nil); err == nil {
+		t.Fatal("expected an error for a missing index")
+	}
+}
+
+func TestDeleteByQuery(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(6)...)
+
+	ctx := context.TODO()
+	res, err := client.DeleteByQuery(ctx, "counters", []BoolQueriesWithClauseOption{
+		{Target: "count", Query: Range{Gte: 3}, Clause: "filter", Type: "range"},
+		{Target: "tags", Query: "even", Clause: "must_not"},
+	}, RequestsPerSecond(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Deleted != 2 || res.RequestsPerSecond != 100 || srv.DocCount("counters") != 4 {
+		t.Fatalf("expected %v deleted, but got %v\n", 2, res.Deleted)
+	}
+
+	if _, err := client.DeleteByQuery(ctx, "counters", nil); err == nil {
+		t.Fatal("expected an error without clauses")
+	}
+	if _, err := client.UpdateByQueryAsync(ctx, "counters", nil, nil, ReindexPipeline("lowercase")); err == nil {
+		t.Fatal("expected an error for a Reindex option")
+	}
+}
+
+func TestByQueryTask(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(6)...)
+
+	ctx := context.TODO()
+	script := &Script{Source: "ctx._source.count += 1"}
+	task, err := client.UpdateByQueryAsync(ctx, "counters", nil, script, BatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Completed || status.Total != 6 || status.Updated != 2 {
+		t.Fatalf("expected %v of %v updated, but got %v\n", 2, 6, status)
+	}
+	if err := task.Rethrottle(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Update(ctx, "counters", "5", map[string]interface{}{"count": 50}); err != nil {
+		t.Fatal(err)
+	}
+	var polls []int64
+	res, err := task.Wait(ctx, time.Millisecond, func(s *TaskStatus) {
+		polls = append(polls, s.Updated)
+	})
+	var byQueryErr *ByQueryError
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &byQueryErr) || byQueryErr.Response.Failures[0].Id != "5" {
+		t.Fatalf("expected %v on %v, but got %v\n", ErrConflict, "5", err)
+	}
+	if res.Updated != 4 || res.VersionConflicts != 1 || res.RequestsPerSecond != 50 || len(polls) != 2 {
+		t.Fatalf("expected %v updated before the conflict, but got %v after %v polls\n", 4, res.Updated, polls)
+	}
+
+	task, err = client.UpdateByQueryAsync(ctx, "counters", nil, script, BatchSize(2), ProceedOnConflicts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteByQuery(ctx, "counters", []BoolQueriesWithClauseOption{{Target: "_id", Query: []string{"6"}, Type: "ids"}}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = task.Wait(ctx, time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated != 5 || res.VersionConflicts != 1 {
+		t.Fatalf("expected %v updated and %v conflict, but got %v and %v\n", 5, 1, res.Updated, res.VersionConflicts)
+	}
+
+	task, err = client.DeleteByQueryAsync(ctx, "counters", []BoolQueriesWithClauseOption{{Target: "tags", Query: "even"}}, BatchSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Cancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err = task.Wait(ctx, time.Millisecond, nil)
+	if !errors.Is(err, ErrTaskCanceled) || res.Deleted != 1 || srv.DocCount("counters") != 4 {
+		t.Fatalf("expected %v after %v deleted, but got %v\n", ErrTaskCanceled, 1, err)
+	}
+
+	task, err = client.UpdateByQueryAsync(ctx, "counters", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err = task.Wait(ctx, 0, nil); err != nil || res.Updated != 4 {
+		t.Fatalf("expected %v updated, but got %v (%v)\n", 4, res, err)
+	}
+
+	missing := &Task{ID: esminitest.NodeName + ":99", client: client}
+	if _, err := missing.Status(ctx); !elastic.IsNotFound(err) {
+		t.Fatalf("expected a not found error, but got %v\n", err)
+	}
+}
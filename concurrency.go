@@ -0,0 +1,118 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// ErrConflict is matched by errors.Is when a write was rejected because the
+// document changed since it was read.
+var ErrConflict = errors.New("esmini: version conflict")
+
+// ConflictError is returned by IndexDoc, Update and Delete when the
+// document no longer has the sequence number, primary term or version the
+// write required, or already exists for a create.
+type ConflictError struct {
+	Index  string
+	ID     string
+	Reason string
+	err    error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("esmini: version conflict on %s/%s: %s", e.Index, e.ID, e.Reason)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Unwrap returns the *elastic.Error the conflict was reported with.
+func (e *ConflictError) Unwrap() error {
+	return e.err
+}
+
+// asConflict turns a 409 response into a *ConflictError and returns other
+// errors as they are.
+func asConflict(index, id string, err error) error {
+	e, ok := err.(*elastic.Error)
+	if !ok || e.Status != http.StatusConflict {
+		return err
+	}
+	conflict := &ConflictError{Index: index, ID: id, err: err}
+	if e.Details != nil {
+		conflict.Reason = e.Details.Reason
+	}
+	return conflict
+}
+
+// Conflict reports whether the item was rejected by a version conflict.
+func (e BulkItemError) Conflict() bool {
+	return e.Status == http.StatusConflict
+}
+
+// IfSeqNo applies a write only if the document was last written with seqNo
+// and primaryTerm, as returned by Get, Search metadata and every write.
+func IfSeqNo(seqNo, primaryTerm int64) WriteOption {
+	return func(w *writeOption) {
+		w.ifSeqNo, w.ifPrimaryTerm = &seqNo, &primaryTerm
+	}
+}
+
+// ExternalVersion applies IndexDoc or Delete only if version is higher than
+// the document's version, which it then becomes. Update does not support
+// it.
+func ExternalVersion(version int64) WriteOption {
+	return func(w *writeOption) {
+		w.version = &version
+	}
+}
+
+// WriteRouting sends a write to the shard of routing instead of the one
+// read from the document's routing tag.
+func WriteRouting(routing string) WriteOption {
+	return func(w *writeOption) {
+		w.routing = routing
+	}
+}
+
+// ReadModifyWrite gets the document id, passes it to modify and writes it
+// back only if nobody else wrote it in between. On a conflict it starts
+// over, at most retries more times, and then returns the *ConflictError.
+// Errors returned by modify abort without writing. Documents stored with a
+// custom routing are read with WriteRouting and written back to the same
+// shard; a version tag on T is ignored in favor of the sequence number.
+func ReadModifyWrite[T any](ctx context.Context, client *IndexClient, index, id string, retries int, modify func(*T) error, opts ...WriteOption) (*elastic.IndexResponse, error) {
+	for attempt := 0; ; attempt++ {
+		wOpt := newWriteOption(opts)
+		var getOpts []GetOption
+		if len(wOpt.routing) > 0 {
+			getOpts = append(getOpts, GetRouting(wOpt.routing))
+		}
+		var doc T
+		res, err := client.Get(ctx, index, id, &doc, getOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if res.SeqNo == nil || res.PrimaryTerm == nil {
+			return nil, fmt.Errorf("esmini: %s/%s has no sequence number", index, id)
+		}
+		if err := modify(&doc); err != nil {
+			return nil, err
+		}
+
+		if len(res.Routing) > 0 {
+			wOpt.routing = res.Routing
+		}
+		wOpt.ifSeqNo, wOpt.ifPrimaryTerm = res.SeqNo, res.PrimaryTerm
+		saved, err := client.indexDoc(ctx, index, id, doc, wOpt)
+		if errors.Is(err, ErrConflict) && attempt < retries {
+			continue
+		}
+		return saved, err
+	}
+}
@@ -0,0 +1,143 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestOptimisticConcurrency(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	created, err := client.IndexDoc(ctx, index, counter{ID: "1", Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := client.Update(ctx, index, "1", map[string]interface{}{"count": 2}, IfSeqNo(created.SeqNo, created.PrimaryTerm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.SeqNo <= created.SeqNo || updated.PrimaryTerm != created.PrimaryTerm {
+		t.Fatalf("expected a seq_no after %v, but got %v\n", created.SeqNo, updated.SeqNo)
+	}
+
+	_, err = client.Update(ctx, index, "1", map[string]interface{}{"count": 3}, IfSeqNo(created.SeqNo, created.PrimaryTerm))
+	var conflict *ConflictError
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &conflict) || conflict.ID != "1" || conflict.Reason == "" {
+		t.Fatalf("expected %v, but got %v\n", ErrConflict, err)
+	}
+	var esErr *elastic.Error
+	if !errors.As(err, &esErr) || esErr.Status != 409 {
+		t.Fatalf("expected the 409 response, but got %v\n", err)
+	}
+	if _, err := client.Delete(ctx, index, "1", IfSeqNo(created.SeqNo, created.PrimaryTerm)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v, but got %v\n", ErrConflict, err)
+	}
+	if _, err := client.Update(ctx, index, "1", map[string]interface{}{"count": 3}, ExternalVersion(5)); err == nil {
+		t.Fatal("expected an error for a versioned update")
+	}
+
+	if _, err := client.IndexDoc(ctx, index, counter{ID: "2", Count: 1}, ExternalVersion(5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.IndexDoc(ctx, index, counter{ID: "2", Count: 2}, ExternalVersion(5)); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v, but got %v\n", ErrConflict, err)
+	}
+	deleted, err := client.Delete(ctx, index, "2", ExternalVersion(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Version != 6 {
+		t.Fatalf("expected %v, but got %v\n", 6, deleted.Version)
+	}
+
+	_, err = client.Bulk(ctx, index, []*BulkAction{
+		UpdateAction("1", map[string]interface{}{"count": 4}).IfSeqNo(created.SeqNo, created.PrimaryTerm),
+	})
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) || !bulkErr.Items[0].Conflict() {
+		t.Fatalf("expected a conflicting item, but got %v\n", err)
+	}
+}
+
+func TestReadModifyWrite(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	if _, err := client.IndexDoc(ctx, index, counter{ID: "1", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another worker writes the document while the first attempt runs.
+	attempts := 0
+	increment := func(c *counter) error {
+		attempts++
+		if attempts == 1 {
+			if _, err := client.Update(ctx, index, "1", map[string]interface{}{"count": 10}); err != nil {
+				return err
+			}
+		}
+		c.Count++
+		return nil
+	}
+	if _, err := ReadModifyWrite(ctx, client, index, "1", 3, increment); err != nil {
+		t.Fatal(err)
+	}
+	var c counter
+	if _, err := client.Get(ctx, index, "1", &c); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 || c.Count != 11 {
+		t.Fatalf("expected %v after %v attempts, but got %v after %v\n", 11, 2, c.Count, attempts)
+	}
+
+	attempts = 0
+	repo := NewRepository[counter](client, index)
+	if _, err := repo.Modify(ctx, "1", 0, increment); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v, but got %v\n", ErrConflict, err)
+	}
+
+	stop := errors.New("stop")
+	if _, err := repo.Modify(ctx, "1", 3, func(*counter) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("expected %v, but got %v\n", stop, err)
+	}
+	if _, err := repo.Modify(ctx, "9", 3, increment); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v\n", ErrNotFound, err)
+	}
+}
+
+type routedCounter struct {
+	ID      string `json:"id" esmini:"id"`
+	Count   int    `json:"count"`
+	Version int64  `json:"version" esmini:"version"`
+}
+
+func TestReadModifyWriteRouting(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	if _, err := client.IndexDoc(ctx, index, routedCounter{ID: "1", Count: 1, Version: 5}, WriteRouting("user1")); err != nil {
+		t.Fatal(err)
+	}
+	increment := func(c *routedCounter) error {
+		c.Count++
+		return nil
+	}
+	if _, err := ReadModifyWrite(ctx, client, index, "1", 0, increment, WriteRouting("user1")); err != nil {
+		t.Fatal(err)
+	}
+	var c routedCounter
+	res, err := client.Get(ctx, index, "1", &c, GetRouting("user1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Count != 2 || res.Routing != "user1" {
+		t.Fatalf("expected %v on %v, but got %v on %v\n", 2, "user1", c.Count, res.Routing)
+	}
+}
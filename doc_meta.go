@@ -0,0 +1,235 @@
+package esmini
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// TagName is the struct tag esmini reads document metadata from:
+//
+//	type tweet struct {
+//		ID      string `json:"id" esmini:"id"`
+//		User    string `json:"user" esmini:"routing"`
+//		Version int64  `json:"-" esmini:"version"`
+//	}
+//
+// Supported keys are "id", "routing", "version" and "parent". Tagged fields
+// may be strings, integers, floats, fmt.Stringer or encoding.TextMarshaler
+// implementations, [16]byte UUIDs or pointers to any of those, and may live
+// in nested or embedded structs.
+const TagName = "esmini"
+
+var (
+	ErrMissingDocID = errors.New("esmini: document has no ID field")
+	ErrZeroDocID    = errors.New("esmini: document ID is zero")
+)
+
+var (
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type docMeta struct {
+	id         string
+	hasID      bool
+	routing    string
+	parent     string
+	version    int64
+	hasVersion bool
+}
+
+// readDocMeta collects the metadata of doc from its esmini struct tags. When
+// idField is set, the ID is read from the field with that Go name instead,
+// and it is an error for a struct to lack the field or leave it zero. For a
+// map with string keys, the ID is read from the idField key.
+func readDocMeta(doc interface{}, idField string) (docMeta, error) {
+	var meta docMeta
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if len(idField) > 0 {
+			return meta, fmt.Errorf("%w: document is nil", ErrMissingDocID)
+		}
+		return meta, nil
+	}
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && len(idField) > 0 {
+		return readMapDocID(v, idField)
+	}
+	if v.Kind() != reflect.Struct {
+		// Other documents carry no metadata, and Elasticsearch rejects
+		// those that are not JSON objects item by item.
+		return meta, nil
+	}
+
+	seen := map[string]bool{}
+	err := walkFields(v, func(f reflect.StructField, fv reflect.Value) error {
+		key := f.Tag.Get(TagName)
+		if len(idField) > 0 {
+			if f.Name == idField {
+				key = "id"
+			} else if key == "id" {
+				key = ""
+			}
+		}
+		if key == "" || key == "-" {
+			return nil
+		}
+
+		s, zero, err := formatMetaValue(fv)
+		if err != nil {
+			return fmt.Errorf("esmini: field %s: %w", f.Name, err)
+		}
+		// Like encoding/json, the shallowest field wins.
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		switch key {
+		case "id":
+			if zero {
+				return fmt.Errorf("%w: field %s of %s", ErrZeroDocID, f.Name, v.Type())
+			}
+			meta.id, meta.hasID = s, true
+		case "routing":
+			if !zero {
+				meta.routing = s
+			}
+		case "parent":
+			if !zero {
+				meta.parent = s
+			}
+		case "version":
+			if zero {
+				return nil
+			}
+			version, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("esmini: field %s: version must be an integer, got %q", f.Name, s)
+			}
+			meta.version, meta.hasVersion = version, true
+		default:
+			return fmt.Errorf("esmini: field %s: unknown %s tag %q", f.Name, TagName, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return meta, err
+	}
+	if len(idField) > 0 && !seen["id"] {
+		return meta, fmt.Errorf("%w: %s has no field %s", ErrMissingDocID, v.Type(), idField)
+	}
+	return meta, nil
+}
+
+// readMapDocID reads the ID of a map document from its idField key.
+func readMapDocID(v reflect.Value, idField string) (docMeta, error) {
+	var meta docMeta
+	fv := v.MapIndex(reflect.ValueOf(idField).Convert(v.Type().Key()))
+	if !fv.IsValid() {
+		return meta, fmt.Errorf("%w: %s has no key %s", ErrMissingDocID, v.Type(), idField)
+	}
+	s, zero, err := formatMetaValue(fv)
+	if err != nil {
+		return meta, fmt.Errorf("esmini: key %s: %w", idField, err)
+	}
+	if zero {
+		return meta, fmt.Errorf("%w: key %s of %s", ErrZeroDocID, idField, v.Type())
+	}
+	meta.id, meta.hasID = s, true
+	return meta, nil
+}
+
+// walkFields calls fn for every exported field of v, descending into nested
+// and embedded structs, including through non-nil pointers. Fields are
+// visited breadth first, so a struct's own fields come before those of the
+// structs it embeds.
+func walkFields(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	level := []reflect.Value{v}
+	for len(level) > 0 {
+		var next []reflect.Value
+		for _, v := range level {
+			t := v.Type()
+			for j := 0; j < t.NumField(); j++ {
+				f := t.Field(j)
+				if f.PkgPath != "" && !f.Anonymous {
+					continue
+				}
+				fv := v.Field(j)
+				if err := fn(f, fv); err != nil {
+					return err
+				}
+				if f.Tag.Get(TagName) != "" {
+					continue
+				}
+
+				for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+					fv = fv.Elem()
+				}
+				if fv.Kind() != reflect.Struct || isScalar(fv.Type()) {
+					continue
+				}
+				next = append(next, fv)
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+func isScalar(t reflect.Type) bool {
+	return t.Implements(stringerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(stringerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// formatMetaValue renders v as a metadata string and reports whether it is
+// the zero value of its type.
+func formatMetaValue(v reflect.Value) (string, bool, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", true, nil
+		}
+		v = v.Elem()
+	}
+	zero := v.IsZero()
+
+	if v.Type().Implements(stringerType) {
+		return v.Interface().(fmt.Stringer).String(), zero, nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), zero, err
+	}
+	if v.CanAddr() {
+		if p := v.Addr(); p.Type().Implements(stringerType) {
+			return p.Interface().(fmt.Stringer).String(), zero, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), zero, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), zero, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), zero, nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), zero, nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), zero, nil
+	case reflect.Array:
+		if v.Len() == 16 && v.Type().Elem().Kind() == reflect.Uint8 {
+			var b [16]byte
+			reflect.Copy(reflect.ValueOf(&b).Elem(), v)
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), zero, nil
+		}
+	}
+	return "", zero, fmt.Errorf("unsupported type %s", v.Type())
+}
@@ -0,0 +1,160 @@
+package esmini
+
+import (
+	"errors"
+	"testing"
+)
+
+type uuid [16]byte
+
+type userID int
+
+func (u userID) String() string {
+	return "user-" + string(rune('0'+int(u)))
+}
+
+type base struct {
+	ID string `esmini:"id"`
+}
+
+type embeddedDoc struct {
+	base
+	Message string
+}
+
+type meta struct {
+	Routing string `esmini:"routing"`
+	Version *int64 `esmini:"version"`
+}
+
+type shadowingDoc struct {
+	base
+	Key string `esmini:"id"`
+}
+
+type nestedDoc struct {
+	ID   *uint64 `esmini:"id"`
+	Meta meta
+}
+
+func TestReadDocMeta(t *testing.T) {
+	id := uint64(42)
+	version := int64(7)
+
+	testCases := []struct {
+		name    string
+		doc     interface{}
+		idField string
+		meta    docMeta
+		err     error
+	}{
+		{
+			"int id", struct {
+				ID int `esmini:"id"`
+			}{ID: 1}, "", docMeta{id: "1", hasID: true}, nil,
+		},
+		{
+			"float id", struct {
+				ID float64 `esmini:"id"`
+			}{ID: 1.5}, "", docMeta{id: "1.5", hasID: true}, nil,
+		},
+		{
+			"stringer id", &struct {
+				ID userID `esmini:"id"`
+			}{ID: 3}, "", docMeta{id: "user-3", hasID: true}, nil,
+		},
+		{
+			"uuid id", struct {
+				ID uuid `esmini:"id"`
+			}{ID: uuid{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}},
+			"", docMeta{id: "12345678-9abc-def0-1234-56789abcdef0", hasID: true}, nil,
+		},
+		{
+			"embedded id", embeddedDoc{base: base{ID: "abc"}}, "", docMeta{id: "abc", hasID: true}, nil,
+		},
+		{
+			"own id before embedded id", shadowingDoc{base: base{ID: "inner"}, Key: "outer"}, "", docMeta{id: "outer", hasID: true}, nil,
+		},
+		{
+			"own id before zero embedded id", shadowingDoc{Key: "outer"}, "", docMeta{id: "outer", hasID: true}, nil,
+		},
+		{
+			"nested routing and version", nestedDoc{ID: &id, Meta: meta{Routing: "user1", Version: &version}}, "",
+			docMeta{id: "42", hasID: true, routing: "user1", version: 7, hasVersion: true}, nil,
+		},
+		{
+			"parent", struct {
+				ID     int    `esmini:"id"`
+				Parent string `esmini:"parent"`
+			}{ID: 2, Parent: "1"}, "", docMeta{id: "2", hasID: true, parent: "1"}, nil,
+		},
+		{
+			"no tags", tweetWithID{ID: 1}, "", docMeta{}, nil,
+		},
+		{
+			"DocID field", tweetWithID{ID: 1}, "ID", docMeta{id: "1", hasID: true}, nil,
+		},
+		{
+			"missing DocID field", tweetWithID{ID: 1}, "UUID", docMeta{}, ErrMissingDocID,
+		},
+		{
+			"nil doc", nil, "", docMeta{}, nil,
+		},
+		{
+			"nil doc with DocID", nil, "ID", docMeta{}, ErrMissingDocID,
+		},
+		{
+			"nil pointer with DocID", (*tweetWithID)(nil), "ID", docMeta{}, ErrMissingDocID,
+		},
+		{
+			"not a struct with DocID", "tweet", "ID", docMeta{}, nil,
+		},
+		{
+			"map with DocID", map[string]interface{}{"ID": 1.0, "message": "hi"}, "ID", docMeta{id: "1", hasID: true}, nil,
+		},
+		{
+			"map without DocID key", map[string]interface{}{"message": "hi"}, "ID", docMeta{}, ErrMissingDocID,
+		},
+		{
+			"map with zero DocID", map[string]string{"ID": ""}, "ID", docMeta{}, ErrZeroDocID,
+		},
+		{
+			"map without DocID", map[string]interface{}{"ID": 1}, "", docMeta{}, nil,
+		},
+		{
+			"zero id", struct {
+				ID int `esmini:"id"`
+			}{}, "", docMeta{}, ErrZeroDocID,
+		},
+		{
+			"nil pointer id", nestedDoc{}, "", docMeta{}, ErrZeroDocID,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, err := readDocMeta(tt.doc, tt.idField)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, but got %v\n", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta != tt.meta {
+				t.Fatalf("expected %+v, but got %+v\n", tt.meta, meta)
+			}
+		})
+	}
+}
+
+func TestReadDocMetaUnsupportedType(t *testing.T) {
+	_, err := readDocMeta(struct {
+		ID []string `esmini:"id"`
+	}{ID: []string{"a"}}, "")
+	if err == nil {
+		t.Fatal("expected error, but got nil")
+	}
+}
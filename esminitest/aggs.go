@@ -0,0 +1,373 @@
+package esminitest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// aggregate computes the aggregations defined in defs over docs, the source
+// fields of the matching documents.
+func aggregate(defs map[string]interface{}, docs []map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(defs))
+	for name, raw := range defs {
+		def, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, parsingError("Expected [START_OBJECT] under [%s], but got a different token", name)
+		}
+		res, err := aggregateOne(name, def, docs)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = res
+	}
+	return out, nil
+}
+
+func aggregateOne(name string, def map[string]interface{}, docs []map[string]interface{}) (map[string]interface{}, error) {
+	var subs map[string]interface{}
+	for _, key := range []string{"aggs", "aggregations"} {
+		if v, ok := def[key].(map[string]interface{}); ok {
+			subs = v
+		}
+	}
+
+	for typ, raw := range def {
+		if typ == "aggs" || typ == "aggregations" || typ == "meta" {
+			continue
+		}
+		params, _ := raw.(map[string]interface{})
+		field, _ := params["field"].(string)
+
+		switch typ {
+		case "terms":
+			return termsAgg(field, params, subs, docs)
+		case "range":
+			return rangeAgg(field, params, subs, docs)
+		case "histogram":
+			interval, ok := toFloat(params["interval"])
+			if !ok || interval <= 0 {
+				return nil, badRequest("[interval] must be >0 for histogram aggregation [%s]", name)
+			}
+			return histogramAgg(field, subs, docs, func(v interface{}) (float64, bool) {
+				f, ok := toFloat(v)
+				return math.Floor(f/interval) * interval, ok
+			}, func(key float64) float64 { return key + interval }, nil)
+		case "date_histogram":
+			return dateHistogramAgg(name, field, params, subs, docs)
+		case "cardinality":
+			distinct := map[string]bool{}
+			for _, doc := range docs {
+				for _, v := range values(doc, field) {
+					distinct[fmt.Sprint(v)] = true
+				}
+			}
+			return map[string]interface{}{"value": len(distinct)}, nil
+		case "stats":
+			return statsAgg(field, docs), nil
+		case "nested":
+			path, _ := params["path"].(string)
+			var nested []map[string]interface{}
+			for _, doc := range docs {
+				for _, obj := range collect(doc, strings.Split(path, ".")) {
+					if m, ok := obj.(map[string]interface{}); ok {
+						nested = append(nested, wrap(path, m))
+					}
+				}
+			}
+			return bucket(map[string]interface{}{}, subs, nested)
+		default:
+			return nil, &esError{
+				status: 400,
+				typ:    "named_object_not_found_exception",
+				reason: fmt.Sprintf("unknown aggregation type [%s] in esminitest", typ),
+			}
+		}
+	}
+	return nil, parsingError("Missing definition for aggregation [%s]", name)
+}
+
+// wrap puts a nested object back under its path, so that sub-aggregations
+// address its fields by their full name like Elasticsearch does.
+func wrap(path string, obj map[string]interface{}) map[string]interface{} {
+	parts := strings.Split(path, ".")
+	out := obj
+	for j := len(parts) - 1; j >= 0; j-- {
+		out = map[string]interface{}{parts[j]: out}
+	}
+	return out
+}
+
+// bucket fills b with the doc count and sub-aggregations of docs.
+func bucket(b map[string]interface{}, subs map[string]interface{}, docs []map[string]interface{}) (map[string]interface{}, error) {
+	b["doc_count"] = len(docs)
+	if len(subs) == 0 {
+		return b, nil
+	}
+	res, err := aggregate(subs, docs)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range res {
+		b[k] = v
+	}
+	return b, nil
+}
+
+func termsAgg(field string, params, subs map[string]interface{}, docs []map[string]interface{}) (map[string]interface{}, error) {
+	size := 10
+	if v, ok := toFloat(params["size"]); ok {
+		size = int(v)
+	}
+
+	type group struct {
+		key  interface{}
+		docs []map[string]interface{}
+	}
+	groups := map[string]*group{}
+	for _, doc := range docs {
+		seen := map[string]bool{}
+		for _, v := range values(doc, field) {
+			k := fmt.Sprint(v)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			g, ok := groups[k]
+			if !ok {
+				g = &group{key: termKey(v)}
+				groups[k] = g
+			}
+			g.docs = append(g.docs, doc)
+		}
+	}
+
+	list := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if len(list[a].docs) != len(list[b].docs) {
+			return len(list[a].docs) > len(list[b].docs)
+		}
+		return compareValues(list[a].key, list[b].key) < 0
+	})
+
+	other := 0
+	if len(list) > size {
+		for _, g := range list[size:] {
+			other += len(g.docs)
+		}
+		list = list[:size]
+	}
+	buckets := make([]interface{}, 0, len(list))
+	for _, g := range list {
+		b := map[string]interface{}{"key": g.key}
+		if flag, ok := g.key.(bool); ok {
+			b["key"], b["key_as_string"] = 0, strconv.FormatBool(flag)
+			if flag {
+				b["key"] = 1
+			}
+		}
+		b, err := bucket(b, subs, g.docs)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return map[string]interface{}{
+		"doc_count_error_upper_bound": 0,
+		"sum_other_doc_count":         other,
+		"buckets":                     buckets,
+	}, nil
+}
+
+func termKey(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && f == math.Trunc(f) {
+		return int64(f)
+	}
+	return v
+}
+
+func rangeAgg(field string, params, subs map[string]interface{}, docs []map[string]interface{}) (map[string]interface{}, error) {
+	ranges, _ := params["ranges"].([]interface{})
+	if len(ranges) == 0 {
+		return nil, badRequest("No [ranges] specified for the [range] aggregation")
+	}
+
+	buckets := make([]interface{}, 0, len(ranges))
+	for _, raw := range ranges {
+		r, _ := raw.(map[string]interface{})
+		from, hasFrom := toFloat(r["from"])
+		to, hasTo := toFloat(r["to"])
+
+		var in []map[string]interface{}
+		for _, doc := range docs {
+			for _, v := range values(doc, field) {
+				f, ok := toFloat(v)
+				if ok && (!hasFrom || f >= from) && (!hasTo || f < to) {
+					in = append(in, doc)
+					break
+				}
+			}
+		}
+
+		key, _ := r["key"].(string)
+		if key == "" {
+			key = rangeBound(from, hasFrom) + "-" + rangeBound(to, hasTo)
+		}
+		b := map[string]interface{}{"key": key}
+		if hasFrom {
+			b["from"] = from
+		}
+		if hasTo {
+			b["to"] = to
+		}
+		b, err := bucket(b, subs, in)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return map[string]interface{}{"buckets": buckets}, nil
+}
+
+func rangeBound(f float64, ok bool) string {
+	if !ok {
+		return "*"
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+// histogramAgg buckets docs by the key keyOf computes for each value, filling
+// the gaps between the first and last bucket using next. format renders
+// key_as_string when set.
+func histogramAgg(field string, subs map[string]interface{}, docs []map[string]interface{},
+	keyOf func(interface{}) (float64, bool), next func(float64) float64, format func(float64) string) (map[string]interface{}, error) {
+	groups := map[float64][]map[string]interface{}{}
+	for _, doc := range docs {
+		seen := map[float64]bool{}
+		for _, v := range values(doc, field) {
+			key, ok := keyOf(v)
+			if !ok || seen[key] {
+				continue
+			}
+			seen[key] = true
+			groups[key] = append(groups[key], doc)
+		}
+	}
+
+	buckets := []interface{}{}
+	if len(groups) == 0 {
+		return map[string]interface{}{"buckets": buckets}, nil
+	}
+	first, last := math.Inf(1), math.Inf(-1)
+	for key := range groups {
+		first = math.Min(first, key)
+		last = math.Max(last, key)
+	}
+	for key := first; key <= last; key = next(key) {
+		b := map[string]interface{}{"key": key}
+		if format != nil {
+			b["key"] = int64(key)
+			b["key_as_string"] = format(key)
+		}
+		b, err := bucket(b, subs, groups[key])
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return map[string]interface{}{"buckets": buckets}, nil
+}
+
+func dateHistogramAgg(name, field string, params, subs map[string]interface{}, docs []map[string]interface{}) (map[string]interface{}, error) {
+	interval, _ := params["calendar_interval"].(string)
+	if interval == "" {
+		interval, _ = params["interval"].(string)
+	}
+	if interval == "" {
+		interval, _ = params["fixed_interval"].(string)
+	}
+
+	var floor func(time.Time) time.Time
+	var next func(time.Time) time.Time
+	switch interval {
+	case "minute", "1m":
+		floor = func(t time.Time) time.Time { return t.Truncate(time.Minute) }
+		next = func(t time.Time) time.Time { return t.Add(time.Minute) }
+	case "hour", "1h":
+		floor = func(t time.Time) time.Time { return t.Truncate(time.Hour) }
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case "day", "1d":
+		floor = func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week", "1w":
+		floor = func(t time.Time) time.Time {
+			d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+		}
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month", "1M":
+		floor = func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC) }
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	case "quarter", "1q":
+		floor = func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		}
+		next = func(t time.Time) time.Time { return t.AddDate(0, 3, 0) }
+	case "year", "1y":
+		floor = func(t time.Time) time.Time { return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC) }
+		next = func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	default:
+		return nil, badRequest("The supplied interval [%s] could not be parsed as a calendar interval in aggregation [%s]", interval, name)
+	}
+
+	fromMillis := func(ms float64) time.Time {
+		return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC()
+	}
+	toMillis := func(t time.Time) float64 {
+		return float64(t.UnixNano() / int64(time.Millisecond))
+	}
+	return histogramAgg(field, subs, docs, func(v interface{}) (float64, bool) {
+		ms, ok := numeric(normalize(v))
+		if !ok {
+			return 0, false
+		}
+		return toMillis(floor(fromMillis(ms))), true
+	}, func(key float64) float64 {
+		return toMillis(next(fromMillis(key)))
+	}, func(key float64) string {
+		return fromMillis(key).Format("2006-01-02T15:04:05.000Z")
+	})
+}
+
+func statsAgg(field string, docs []map[string]interface{}) map[string]interface{} {
+	count := 0
+	sum, min, max := 0.0, math.Inf(1), math.Inf(-1)
+	for _, doc := range docs {
+		for _, v := range values(doc, field) {
+			f, ok := numeric(normalize(v))
+			if !ok {
+				continue
+			}
+			count++
+			sum += f
+			min = math.Min(min, f)
+			max = math.Max(max, f)
+		}
+	}
+	if count == 0 {
+		return map[string]interface{}{"count": 0, "min": nil, "max": nil, "avg": nil, "sum": 0.0}
+	}
+	return map[string]interface{}{
+		"count": count,
+		"min":   min,
+		"max":   max,
+		"avg":   sum / float64(count),
+		"sum":   sum,
+	}
+}
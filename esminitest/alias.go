@@ -0,0 +1,315 @@
+package esminitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// alias is the definition of an alias on one index.
+type alias struct {
+	Filter       map[string]interface{} `json:"filter,omitempty"`
+	IsWriteIndex *bool                  `json:"is_write_index,omitempty"`
+}
+
+// aliased returns the indices name is an alias of, sorted by name.
+func (s *Server) aliased(name string) []*index {
+	var out []*index
+	for _, idx := range s.indices {
+		if _, ok := idx.aliases[name]; ok {
+			out = append(out, idx)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].name < out[b].name })
+	return out
+}
+
+// writeTarget returns the index a document API call on name writes to or
+// reads from: name itself, or the write index of the alias name.
+func (s *Server) writeTarget(name string) (string, error) {
+	if _, ok := s.indices[name]; ok {
+		return name, nil
+	}
+	indices := s.aliased(name)
+	if len(indices) == 0 {
+		return name, nil
+	}
+	var write *index
+	for _, idx := range indices {
+		if w := idx.aliases[name].IsWriteIndex; w != nil {
+			if *w {
+				write = idx
+			}
+		} else if len(indices) == 1 {
+			write = idx
+		}
+	}
+	if write == nil {
+		return "", badRequest("no write index is defined for alias [%s]. The write index may be explicitly disabled using is_write_index=false or the alias points to multiple indices without one being designated as a write index", name)
+	}
+	return write.name, nil
+}
+
+// aliasFilters returns the filter reads through expr apply to each of the
+// indices it resolves to. An index named directly, or through an alias
+// without a filter, is not filtered.
+func (s *Server) aliasFilters(expr string) (map[*index]matcher, error) {
+	queries := map[*index][]interface{}{}
+	unfiltered := map[*index]bool{}
+	for _, name := range strings.Split(expr, ",") {
+		if _, ok := s.indices[name]; ok || name == "_all" || strings.ContainsAny(name, "*?") {
+			indices, err := s.resolve(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, idx := range indices {
+				unfiltered[idx] = true
+			}
+			continue
+		}
+		for _, idx := range s.aliased(name) {
+			if f := idx.aliases[name].Filter; f != nil {
+				queries[idx] = append(queries[idx], f)
+			} else {
+				unfiltered[idx] = true
+			}
+		}
+	}
+
+	filters := map[*index]matcher{}
+	for idx, should := range queries {
+		if unfiltered[idx] {
+			continue
+		}
+		m, err := compile(map[string]interface{}{"bool": map[string]interface{}{"should": should}})
+		if err != nil {
+			return nil, err
+		}
+		filters[idx] = m
+	}
+	return filters, nil
+}
+
+// aliasAction is one entry of the actions of POST _aliases.
+type aliasAction struct {
+	Index        string                 `json:"index"`
+	Indices      []string               `json:"indices"`
+	Alias        string                 `json:"alias"`
+	Aliases      []string               `json:"aliases"`
+	Filter       map[string]interface{} `json:"filter"`
+	IsWriteIndex *bool                  `json:"is_write_index"`
+}
+
+func (a aliasAction) indexNames() []string {
+	if a.Index != "" {
+		return append([]string{a.Index}, a.Indices...)
+	}
+	return a.Indices
+}
+
+func (a aliasAction) aliasNames() []string {
+	if a.Alias != "" {
+		return append([]string{a.Alias}, a.Aliases...)
+	}
+	return a.Aliases
+}
+
+// updateAliases applies the actions of POST _aliases atomically: either
+// all of them take effect or, on the first error, none.
+func (s *Server) updateAliases(body []byte) (int, interface{}, error) {
+	var req struct {
+		Actions []map[string]aliasAction `json:"actions"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parsingError("failed to parse aliases request: %v", err)
+	}
+	if len(req.Actions) == 0 {
+		return 0, nil, badRequest("Validation Failed: 1: no actions;")
+	}
+
+	saved := map[*index]map[string]*alias{}
+	for _, idx := range s.indices {
+		saved[idx] = idx.aliases
+		idx.aliases = make(map[string]*alias, len(saved[idx]))
+		for name, a := range saved[idx] {
+			idx.aliases[name] = a
+		}
+	}
+	removed := map[string]bool{}
+	err := func() error {
+		for _, action := range req.Actions {
+			for op, a := range action {
+				if err := s.aliasAction(op, a, removed); err != nil {
+					return err
+				}
+			}
+		}
+		return s.validateAliases(removed)
+	}()
+	if err != nil {
+		for idx, aliases := range saved {
+			idx.aliases = aliases
+		}
+		return 0, nil, err
+	}
+	for name := range removed {
+		delete(s.indices, name)
+	}
+	return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+}
+
+func (s *Server) aliasAction(op string, a aliasAction, removed map[string]bool) error {
+	names := a.indexNames()
+	if len(names) == 0 {
+		return badRequest("Validation Failed: 1: One of [index] or [indices] is required;")
+	}
+	var indices []*index
+	for _, name := range names {
+		resolved, err := s.resolve(name)
+		if err != nil {
+			return err
+		}
+		for _, idx := range resolved {
+			if removed[idx.name] {
+				return indexNotFound(idx.name)
+			}
+		}
+		indices = append(indices, resolved...)
+	}
+
+	switch op {
+	case "add":
+		aliases := a.aliasNames()
+		if len(aliases) == 0 {
+			return badRequest("Validation Failed: 1: One of [alias] or [aliases] is required;")
+		}
+		if a.Filter != nil {
+			if _, err := compile(a.Filter); err != nil {
+				return err
+			}
+		}
+		for _, name := range aliases {
+			for _, idx := range indices {
+				idx.aliases[name] = &alias{Filter: a.Filter, IsWriteIndex: a.IsWriteIndex}
+			}
+		}
+	case "remove":
+		aliases := a.aliasNames()
+		if len(aliases) == 0 {
+			return badRequest("Validation Failed: 1: One of [alias] or [aliases] is required;")
+		}
+		for _, idx := range indices {
+			var missing []string
+			for _, pattern := range aliases {
+				found := false
+				for name := range idx.aliases {
+					if ok, _ := path.Match(pattern, name); ok {
+						delete(idx.aliases, name)
+						found = true
+					}
+				}
+				if !found {
+					missing = append(missing, pattern)
+				}
+			}
+			if len(missing) > 0 {
+				return &esError{status: http.StatusNotFound, typ: "aliases_not_found_exception", reason: "aliases [" + strings.Join(missing, ",") + "] missing"}
+			}
+		}
+	case "remove_index":
+		for _, idx := range indices {
+			removed[idx.name] = true
+			idx.aliases = map[string]*alias{}
+		}
+	default:
+		return badRequest("[aliases] unknown field [%s]", op)
+	}
+	return nil
+}
+
+// validateAliases fails if an alias ends up named like an index or with
+// more than one write index, ignoring the indices about to be removed.
+func (s *Server) validateAliases(removed map[string]bool) error {
+	writers := map[string][]string{}
+	for _, idx := range s.indices {
+		if removed[idx.name] {
+			continue
+		}
+		for name, a := range idx.aliases {
+			if other, ok := s.indices[name]; ok && !removed[other.name] {
+				return &esError{status: http.StatusBadRequest, typ: "invalid_alias_name_exception", reason: "Invalid alias name [" + name + "], an index exists with the same name as the alias", index: name}
+			}
+			if a.IsWriteIndex != nil && *a.IsWriteIndex {
+				writers[name] = append(writers[name], idx.name)
+			}
+		}
+	}
+	for name, indices := range writers {
+		if len(indices) > 1 {
+			sort.Strings(indices)
+			return &esError{status: http.StatusBadRequest, typ: "illegal_state_exception", reason: "alias [" + name + "] has more than one write index [" + strings.Join(indices, ",") + "]"}
+		}
+	}
+	return nil
+}
+
+// aliasAPI serves PUT, DELETE, GET and HEAD on <index>/_alias/<name>, and
+// GET and HEAD on _alias/<name>, with expr "" for _alias.
+func (s *Server) aliasAPI(method, expr, name string, body []byte) (int, interface{}, error) {
+	switch method {
+	case http.MethodPut, http.MethodPost:
+		a := aliasAction{Index: expr, Alias: name}
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := json.Unmarshal(body, &a); err != nil {
+				return 0, nil, parsingError("failed to parse alias: %v", err)
+			}
+			a.Index, a.Alias = expr, name
+		}
+		b, _ := json.Marshal(map[string]interface{}{"actions": []interface{}{map[string]interface{}{"add": a}}})
+		return s.updateAliases(b)
+	case http.MethodDelete:
+		b, _ := json.Marshal(map[string]interface{}{"actions": []interface{}{map[string]interface{}{"remove": aliasAction{Index: expr, Alias: name}}}})
+		return s.updateAliases(b)
+	}
+
+	indices := make([]*index, 0, len(s.indices))
+	if expr == "" {
+		for _, idx := range s.indices {
+			indices = append(indices, idx)
+		}
+	} else {
+		var err error
+		if indices, err = s.resolve(expr); err != nil {
+			return 0, nil, err
+		}
+	}
+	patterns := strings.Split(name, ",")
+	res := map[string]interface{}{}
+	found := map[string]bool{}
+	for _, idx := range indices {
+		aliases := map[string]interface{}{}
+		for n, a := range idx.aliases {
+			if name == "" || matchAny(patterns, n) {
+				aliases[n] = a
+				found[n] = true
+			}
+		}
+		if len(aliases) > 0 || name == "" {
+			res[idx.name] = map[string]interface{}{"aliases": aliases}
+		}
+	}
+	var missing []string
+	for _, p := range patterns {
+		if p != "" && !strings.ContainsAny(p, "*?") && !found[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		res["error"] = "alias [" + strings.Join(missing, ",") + "] missing"
+		res["status"] = http.StatusNotFound
+		return http.StatusNotFound, res, nil
+	}
+	return http.StatusOK, res, nil
+}
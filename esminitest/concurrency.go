@@ -0,0 +1,94 @@
+package esminitest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// writeControl holds the optimistic concurrency parameters of a write:
+// if_seq_no and if_primary_term, or an external version.
+type writeControl struct {
+	IfSeqNo       *int64 `json:"if_seq_no"`
+	IfPrimaryTerm *int64 `json:"if_primary_term"`
+	Version       *int64 `json:"version"`
+	VersionType   string `json:"version_type"`
+}
+
+func (c writeControl) external() bool {
+	return c.Version != nil && (c.VersionType == "external" || c.VersionType == "external_gt" || c.VersionType == "external_gte")
+}
+
+// validate rejects combinations Elasticsearch refuses before looking at the
+// document. Updates support neither internal nor external versions.
+func (c writeControl) validate(update bool) error {
+	if (c.IfSeqNo == nil) != (c.IfPrimaryTerm == nil) {
+		return badRequest("Validation Failed: 1: if_seq_no and if_primary_term must be set together;")
+	}
+	if c.Version == nil {
+		return nil
+	}
+	if update {
+		return badRequest("Validation Failed: 1: can't provide version in update request;")
+	}
+	switch c.VersionType {
+	case "external", "external_gt", "external_gte":
+	case "", "internal":
+		return badRequest("Validation Failed: 1: internal versioning can not be used for optimistic concurrency control. Please use `if_seq_no` and `if_primary_term` instead;")
+	default:
+		return badRequest("Validation Failed: 1: version type [%s] is not supported;", c.VersionType)
+	}
+	if c.IfSeqNo != nil {
+		return badRequest("Validation Failed: 1: compare and write operations can not use versioning;")
+	}
+	return nil
+}
+
+// check fails with a version conflict when doc, nil if missing, does not
+// satisfy c.
+func (c writeControl) check(idx *index, id string, doc *document) error {
+	if c.IfSeqNo != nil {
+		if doc == nil {
+			return versionConflict(idx, id, fmt.Sprintf("required seqNo [%d], primary term [%d] but no document was found", *c.IfSeqNo, *c.IfPrimaryTerm))
+		}
+		if doc.seqNo != *c.IfSeqNo || doc.primaryTerm != *c.IfPrimaryTerm {
+			return versionConflict(idx, id, fmt.Sprintf("required seqNo [%d], primary term [%d]. current document has seqNo [%d] and primary term [%d]", *c.IfSeqNo, *c.IfPrimaryTerm, doc.seqNo, doc.primaryTerm))
+		}
+	}
+	if c.external() && doc != nil {
+		if doc.version > *c.Version || (doc.version == *c.Version && c.VersionType != "external_gte") {
+			return versionConflict(idx, id, fmt.Sprintf("current version [%d] is higher or equal to the one provided [%d]", doc.version, *c.Version))
+		}
+	}
+	return nil
+}
+
+// stamp sets the external version on a document just written.
+func (c writeControl) stamp(doc *document) {
+	if c.external() {
+		doc.version = *c.Version
+	}
+}
+
+// writeControlParams reads the concurrency URL parameters of the document
+// APIs.
+func writeControlParams(q url.Values) (writeControl, error) {
+	var c writeControl
+	for name, dst := range map[string]**int64{
+		"if_seq_no":       &c.IfSeqNo,
+		"if_primary_term": &c.IfPrimaryTerm,
+		"version":         &c.Version,
+	} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return c, badRequest("Failed to parse [%s] value [%s]", name, v)
+		}
+		*dst = &n
+	}
+	c.VersionType = q.Get("version_type")
+	return c, nil
+}
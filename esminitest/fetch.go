@@ -0,0 +1,280 @@
+package esminitest
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fetchSpec describes what a search returns of each hit besides its
+// metadata: the filtered _source, docvalue_fields and stored_fields.
+type fetchSpec struct {
+	source    bool
+	includes  []string
+	excludes  []string
+	docvalues []docvalueField
+	stored    []string
+}
+
+type docvalueField struct {
+	field  string
+	format string
+}
+
+func newFetchSpec(req *searchBody, indices []*index) (*fetchSpec, error) {
+	f := &fetchSpec{source: true}
+
+	switch t := req.StoredFields.(type) {
+	case nil:
+	case string:
+		f.stored = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			f.stored = append(f.stored, fmt.Sprint(v))
+		}
+	default:
+		return nil, parsingError("[stored_fields] malformed")
+	}
+	if f.stored != nil {
+		// Asking for stored fields drops the source unless it is requested.
+		f.source = false
+		if len(f.stored) == 1 && f.stored[0] == "_none_" {
+			f.stored = nil
+		}
+	}
+
+	if err := f.parseSource(req.Source); err != nil {
+		return nil, err
+	}
+
+	for _, raw := range req.DocvalueFields {
+		var dv docvalueField
+		switch t := raw.(type) {
+		case string:
+			dv.field = t
+		case map[string]interface{}:
+			dv.field, _ = t["field"].(string)
+			dv.format, _ = t["format"].(string)
+		}
+		if dv.field == "" {
+			return nil, parsingError("[docvalue_fields] malformed")
+		}
+		for _, idx := range indices {
+			if idx.fieldType(dv.field) == "text" {
+				return nil, badRequest("Text fields are not optimised for operations that require per-document field data like aggregations and sorting, so these operations are disabled by default. Please use a keyword field instead. Alternatively, set fielddata=true on [%s] in order to load field data by uninverting the inverted index.", dv.field)
+			}
+		}
+		f.docvalues = append(f.docvalues, dv)
+	}
+	return f, nil
+}
+
+// parseSource reads a _source body parameter: a boolean, one or several
+// include patterns, or an object with includes and excludes.
+func (f *fetchSpec) parseSource(raw interface{}) error {
+	switch t := raw.(type) {
+	case nil:
+	case bool:
+		f.source = t
+	case string:
+		f.source, f.includes = true, []string{t}
+	case []interface{}:
+		f.source = true
+		for _, v := range t {
+			f.includes = append(f.includes, fmt.Sprint(v))
+		}
+	case map[string]interface{}:
+		f.source = true
+		f.includes = stringList(t["includes"])
+		f.excludes = stringList(t["excludes"])
+	default:
+		return parsingError("[_source] malformed")
+	}
+	return nil
+}
+
+// sourceParams reads the _source, _source_includes and _source_excludes
+// URL parameters of the document APIs.
+func sourceParams(q url.Values) *fetchSpec {
+	f := &fetchSpec{source: true}
+	if v := q.Get("_source"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			f.source = b
+		} else {
+			f.includes = strings.Split(v, ",")
+		}
+	}
+	if v := q.Get("_source_includes"); v != "" {
+		f.includes = strings.Split(v, ",")
+	}
+	if v := q.Get("_source_excludes"); v != "" {
+		f.excludes = strings.Split(v, ",")
+	}
+	return f
+}
+
+func stringList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, e := range t {
+			out = append(out, fmt.Sprint(e))
+		}
+		return out
+	}
+	return nil
+}
+
+// apply adds _source and fields to the rendered hit m.
+func (f *fetchSpec) apply(m map[string]interface{}, idx *index, doc *document) {
+	if f == nil {
+		m["_source"] = doc.source
+		return
+	}
+	if f.source {
+		if len(f.includes) == 0 && len(f.excludes) == 0 {
+			m["_source"] = doc.source
+		} else {
+			m["_source"] = filterSource(doc.fields, "", f.includes, f.excludes)
+		}
+	}
+
+	fields := map[string]interface{}{}
+	for _, dv := range f.docvalues {
+		vals := values(doc.fields, dv.field)
+		if len(vals) == 0 {
+			continue
+		}
+		out := make([]interface{}, 0, len(vals))
+		for _, v := range vals {
+			out = append(out, docvalue(idx.fieldType(dv.field), dv.format, v))
+		}
+		fields[dv.field] = out
+	}
+	for _, name := range f.stored {
+		if name == "_source" || !idx.stored(name) {
+			continue
+		}
+		if vals := values(doc.fields, name); len(vals) > 0 {
+			fields[name] = vals
+		}
+	}
+	if len(fields) > 0 {
+		m["fields"] = fields
+	}
+}
+
+// docvalue renders v the way doc values come back: dates as formatted
+// strings, or epoch milliseconds with the "epoch_millis" format.
+func docvalue(typ, format string, v interface{}) interface{} {
+	if typ != "date" {
+		return v
+	}
+	ms, ok := numeric(normalize(v))
+	if !ok {
+		return v
+	}
+	if format == "epoch_millis" {
+		return fmt.Sprint(int64(ms))
+	}
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// stored reports whether field is mapped with "store": true.
+func (idx *index) stored(field string) bool {
+	props := idx.properties
+	parts := strings.Split(field, ".")
+	for i, part := range parts {
+		def, ok := props[part].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			store, _ := def["store"].(bool)
+			return store
+		}
+		if props, ok = def["properties"].(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// filterSource keeps the fields of m matching includes and not matching
+// excludes. Patterns are dotted paths and may use wildcards.
+func filterSource(m map[string]interface{}, prefix string, includes, excludes []string) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range m {
+		p := k
+		if prefix != "" {
+			p = prefix + "." + k
+		}
+		if matchAny(excludes, p) {
+			continue
+		}
+		if len(includes) == 0 || matchAny(includes, p) {
+			out[k] = filterValue(v, p, nil, excludes)
+			continue
+		}
+		if mayMatchBelow(includes, p) {
+			if sub := filterValue(v, p, includes, excludes); !isEmpty(sub) {
+				out[k] = sub
+			}
+		}
+	}
+	return out
+}
+
+func filterValue(v interface{}, p string, includes, excludes []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return filterSource(t, p, includes, excludes)
+	case []interface{}:
+		out := make([]interface{}, 0, len(t))
+		for _, e := range t {
+			if sub := filterValue(e, p, includes, excludes); !isEmpty(sub) || len(includes) == 0 {
+				out = append(out, sub)
+			}
+		}
+		return out
+	}
+	if len(includes) > 0 {
+		return nil
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(t) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+	return false
+}
+
+func matchAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func mayMatchBelow(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, p+".") || strings.HasPrefix(pattern, "*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package esminitest
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// highlighter marks the query terms found in the requested fields of a hit,
+// roughly like the plain highlighter: values are cut into fragments at word
+// boundaries and only fragments holding a term are kept.
+type highlighter struct {
+	fields []highlightField
+	terms  map[string]map[string]bool
+}
+
+type highlightField struct {
+	name              string
+	preTag, postTag   string
+	fragmentSize      int
+	fragments         int
+	requireFieldMatch bool
+}
+
+func newHighlighter(spec, query map[string]interface{}) (*highlighter, error) {
+	defaults := highlightField{preTag: "<em>", postTag: "</em>", fragmentSize: 100, fragments: 5, requireFieldMatch: true}
+	if err := defaults.apply(spec); err != nil {
+		return nil, err
+	}
+
+	hl := &highlighter{terms: map[string]map[string]bool{}}
+	hl.collect(query)
+
+	add := func(name string, raw interface{}) error {
+		f := defaults
+		f.name = name
+		if params, ok := raw.(map[string]interface{}); ok {
+			if err := f.apply(params); err != nil {
+				return err
+			}
+		}
+		hl.fields = append(hl.fields, f)
+		return nil
+	}
+	switch fields := spec["fields"].(type) {
+	case map[string]interface{}:
+		for name, raw := range fields {
+			if err := add(name, raw); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for _, entry := range fields {
+			m, _ := entry.(map[string]interface{})
+			for name, raw := range m {
+				if err := add(name, raw); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return hl, nil
+}
+
+func (f *highlightField) apply(params map[string]interface{}) error {
+	if tags, ok := params["pre_tags"].([]interface{}); ok && len(tags) > 0 {
+		f.preTag = fmt.Sprint(tags[0])
+	}
+	if tags, ok := params["post_tags"].([]interface{}); ok && len(tags) > 0 {
+		f.postTag = fmt.Sprint(tags[0])
+	}
+	if v, ok := toFloat(params["fragment_size"]); ok {
+		f.fragmentSize = int(v)
+	}
+	if v, ok := toFloat(params["number_of_fragments"]); ok {
+		f.fragments = int(v)
+	}
+	if v, ok := params["require_field_match"].(bool); ok {
+		f.requireFieldMatch = v
+	}
+	if typ, ok := params["type"].(string); ok {
+		switch typ {
+		case "unified", "plain", "fvh":
+		default:
+			return badRequest("unknown highlighter type [%s] for the field [%s]", typ, f.name)
+		}
+	}
+	return nil
+}
+
+// collect records the terms each field is queried for, skipping must_not
+// clauses which never contribute to a hit.
+func (hl *highlighter) collect(query map[string]interface{}) {
+	for typ, body := range query {
+		params, _ := body.(map[string]interface{})
+		switch typ {
+		case "bool":
+			for _, clause := range []string{"must", "should", "filter"} {
+				switch c := params[clause].(type) {
+				case []interface{}:
+					for _, q := range c {
+						if m, ok := q.(map[string]interface{}); ok {
+							hl.collect(m)
+						}
+					}
+				case map[string]interface{}:
+					hl.collect(c)
+				}
+			}
+		case "multi_match":
+			fields, _ := params["fields"].([]interface{})
+			for _, f := range fields {
+				name := fmt.Sprint(f)
+				if i := strings.LastIndex(name, "^"); i >= 0 {
+					name = name[:i]
+				}
+				hl.add(name, params["query"])
+			}
+		case "match", "match_phrase", "term", "terms":
+			for field, v := range params {
+				if m, ok := v.(map[string]interface{}); ok {
+					if q, ok := m["query"]; ok {
+						v = q
+					} else {
+						v = m["value"]
+					}
+				}
+				if list, ok := v.([]interface{}); ok {
+					for _, e := range list {
+						hl.add(field, e)
+					}
+					continue
+				}
+				hl.add(field, v)
+			}
+		}
+	}
+}
+
+func (hl *highlighter) add(field string, v interface{}) {
+	field = strings.TrimSuffix(field, ".keyword")
+	if hl.terms[field] == nil {
+		hl.terms[field] = map[string]bool{}
+	}
+	for _, tok := range analyze(fmt.Sprint(v)) {
+		hl.terms[field][tok] = true
+	}
+}
+
+func (hl *highlighter) termsFor(f highlightField, field string) map[string]bool {
+	if f.requireFieldMatch {
+		return hl.terms[field]
+	}
+	all := map[string]bool{}
+	for _, terms := range hl.terms {
+		for t := range terms {
+			all[t] = true
+		}
+	}
+	return all
+}
+
+// highlight returns the fragments of every requested field of doc holding a
+// query term.
+func (hl *highlighter) highlight(doc *document) map[string][]string {
+	out := map[string][]string{}
+	for _, f := range hl.fields {
+		names := []string{f.name}
+		if strings.ContainsAny(f.name, "*?") {
+			names = names[:0]
+			for name := range doc.fields {
+				if ok, _ := path.Match(f.name, name); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range names {
+			terms := hl.termsFor(f, name)
+			if len(terms) == 0 {
+				continue
+			}
+			var fragments []string
+			for _, v := range values(doc.fields, name) {
+				s, ok := v.(string)
+				if !ok {
+					continue
+				}
+				fragments = append(fragments, f.fragment(s, terms)...)
+			}
+			if f.fragments > 0 && len(fragments) > f.fragments {
+				fragments = fragments[:f.fragments]
+			}
+			if len(fragments) > 0 {
+				out[name] = fragments
+			}
+		}
+	}
+	return out
+}
+
+func (f highlightField) fragment(s string, terms map[string]bool) []string {
+	if f.fragments == 0 || len(s) <= f.fragmentSize {
+		if marked, ok := f.mark(s, terms); ok {
+			return []string{marked}
+		}
+		return nil
+	}
+
+	var out []string
+	var chunk strings.Builder
+	flush := func() {
+		if marked, ok := f.mark(strings.TrimSpace(chunk.String()), terms); ok {
+			out = append(out, marked)
+		}
+		chunk.Reset()
+	}
+	for _, word := range strings.SplitAfter(s, " ") {
+		if chunk.Len() > 0 && chunk.Len()+len(word) > f.fragmentSize {
+			flush()
+		}
+		chunk.WriteString(word)
+	}
+	flush()
+	return out
+}
+
+// mark wraps every token of s found in terms with the field's tags.
+func (f highlightField) mark(s string, terms map[string]bool) (string, bool) {
+	var b strings.Builder
+	found := false
+	start := -1
+	emit := func(end int) {
+		tok := s[start:end]
+		if terms[strings.ToLower(tok)] {
+			found = true
+			b.WriteString(f.preTag + tok + f.postTag)
+		} else {
+			b.WriteString(tok)
+		}
+		start = -1
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			emit(i)
+		}
+		b.WriteRune(r)
+	}
+	if start >= 0 {
+		emit(len(s))
+	}
+	return b.String(), found
+}
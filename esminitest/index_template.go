@@ -0,0 +1,357 @@
+package esminitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// templateContent is the settings, mappings and aliases a composable or
+// component template applies to new indices.
+type templateContent struct {
+	Settings map[string]interface{} `json:"settings,omitempty"`
+	Mappings map[string]interface{} `json:"mappings,omitempty"`
+	Aliases  map[string]*alias      `json:"aliases,omitempty"`
+}
+
+// componentTemplate is a building block of composable index templates.
+type componentTemplate struct {
+	Template templateContent        `json:"template"`
+	Version  *int64                 `json:"version,omitempty"`
+	Meta     map[string]interface{} `json:"_meta,omitempty"`
+}
+
+// indexTemplate is a composable index template. Templates flagged with
+// data_stream are stored, but matching indices are created as regular
+// indices.
+type indexTemplate struct {
+	IndexPatterns []string               `json:"index_patterns"`
+	ComposedOf    []string               `json:"composed_of"`
+	Priority      *int64                 `json:"priority,omitempty"`
+	Version       *int64                 `json:"version,omitempty"`
+	Template      *templateContent       `json:"template,omitempty"`
+	DataStream    map[string]interface{} `json:"data_stream,omitempty"`
+	Meta          map[string]interface{} `json:"_meta,omitempty"`
+}
+
+func (t *indexTemplate) priority() int64 {
+	if t.Priority == nil {
+		return 0
+	}
+	return *t.Priority
+}
+
+func (t *indexTemplate) matches(name string) bool {
+	return !strings.HasPrefix(name, ".") && matchAny(t.IndexPatterns, name)
+}
+
+// normalizeSettings flattens settings given as {"index": {...}} or with
+// "index." prefixed keys into the form kept by index.settings.
+func normalizeSettings(settings map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range settings {
+		if k == "index" {
+			if nested, ok := v.(map[string]interface{}); ok {
+				out = merge(out, normalizeSettings(nested))
+				continue
+			}
+		}
+		out[strings.TrimPrefix(k, "index.")] = v
+	}
+	return out
+}
+
+// patternsOverlap reports whether some index name could match a pattern of
+// both a and b.
+func patternsOverlap(a, b []string) bool {
+	for _, pa := range a {
+		for _, pb := range b {
+			if pa == pb || matchAny([]string{pa}, pb) || matchAny([]string{pb}, pa) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchingTemplates returns the names of the index templates matching
+// name, highest priority first.
+func (s *Server) matchingTemplates(name string) []string {
+	var names []string
+	for n, t := range s.indexTemplates {
+		if t.matches(name) {
+			names = append(names, n)
+		}
+	}
+	sort.Slice(names, func(a, b int) bool {
+		pa, pb := s.indexTemplates[names[a]].priority(), s.indexTemplates[names[b]].priority()
+		if pa != pb {
+			return pa > pb
+		}
+		return names[a] < names[b]
+	})
+	return names
+}
+
+// compose merges the component templates of t, in order, and then t's own
+// template.
+func (s *Server) compose(t *indexTemplate) templateContent {
+	out := templateContent{
+		Settings: map[string]interface{}{},
+		Mappings: map[string]interface{}{},
+		Aliases:  map[string]*alias{},
+	}
+	apply := func(c *templateContent) {
+		if c == nil {
+			return
+		}
+		out.Settings = merge(out.Settings, normalizeSettings(deepCopy(c.Settings).(map[string]interface{})))
+		if c.Mappings != nil {
+			out.Mappings = merge(out.Mappings, deepCopy(c.Mappings).(map[string]interface{}))
+		}
+		for name, a := range c.Aliases {
+			if a == nil {
+				a = &alias{}
+			}
+			out.Aliases[name] = a
+		}
+	}
+	for _, name := range t.ComposedOf {
+		if c, ok := s.componentTemplates[name]; ok {
+			apply(&c.Template)
+		}
+	}
+	apply(t.Template)
+	return out
+}
+
+// newTemplatedIndex returns a new index name with the settings, mappings
+// and aliases of the highest priority index template matching it, if any.
+func (s *Server) newTemplatedIndex(name string) *index {
+	idx := newIndex(name)
+	matching := s.matchingTemplates(name)
+	if len(matching) == 0 {
+		return idx
+	}
+	content := s.compose(s.indexTemplates[matching[0]])
+	idx.settings = content.Settings
+	idx.mappings = content.Mappings
+	idx.properties, _ = idx.mappings["properties"].(map[string]interface{})
+	for aliasName, a := range content.Aliases {
+		idx.aliases[aliasName] = a
+	}
+	return idx
+}
+
+func (s *Server) parseIndexTemplate(name string, body []byte) (*indexTemplate, error) {
+	var t indexTemplate
+	if err := json.Unmarshal(body, &t); err != nil {
+		return nil, parsingError("failed to parse index template [%s]: %v", name, err)
+	}
+	if len(t.IndexPatterns) == 0 {
+		return nil, &esError{status: http.StatusBadRequest, typ: "action_request_validation_exception", reason: "Validation Failed: 1: index patterns are missing;"}
+	}
+	if t.ComposedOf == nil {
+		t.ComposedOf = []string{}
+	}
+	var missing []string
+	for _, c := range t.ComposedOf {
+		if _, ok := s.componentTemplates[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &esError{
+			status: http.StatusBadRequest,
+			typ:    "invalid_index_template_exception",
+			reason: "index_template [" + name + "] invalid, cause [index template [" + name + "] specifies component templates [" + strings.Join(missing, ", ") + "] that do not exist]",
+		}
+	}
+	if t.Template != nil && t.Template.Mappings != nil {
+		if err := validateMappings(t.Template.Mappings); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// validateMappings checks that the properties of mappings are an object.
+func validateMappings(mappings map[string]interface{}) error {
+	if props, ok := mappings["properties"]; ok {
+		if _, ok := props.(map[string]interface{}); !ok {
+			return &esError{status: http.StatusBadRequest, typ: "mapper_parsing_exception", reason: "Expected map for property [properties]"}
+		}
+	}
+	return nil
+}
+
+// indexTemplateAPI serves PUT, GET, HEAD and DELETE on _index_template and
+// _index_template/<name>, with name "" for _index_template.
+func (s *Server) indexTemplateAPI(method, name string, q url.Values, body []byte) (int, interface{}, error) {
+	switch method {
+	case http.MethodPut, http.MethodPost:
+		t, err := s.parseIndexTemplate(name, body)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, ok := s.indexTemplates[name]; ok && q.Get("create") == "true" {
+			return 0, nil, badRequest("index template [%s] already exists", name)
+		}
+		var conflicts []string
+		for other, o := range s.indexTemplates {
+			if other != name && o.priority() == t.priority() && patternsOverlap(o.IndexPatterns, t.IndexPatterns) {
+				conflicts = append(conflicts, other)
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return 0, nil, badRequest("index template [%s] has index patterns [%s] matching patterns from existing templates [%s] that have the same priority [%d], multiple index templates may not match during index creation, please use a different priority",
+				name, strings.Join(t.IndexPatterns, ", "), strings.Join(conflicts, ","), t.priority())
+		}
+		s.indexTemplates[name] = t
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	case http.MethodDelete:
+		if _, ok := s.indexTemplates[name]; !ok {
+			return 0, nil, &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "index_template [" + name + "] missing"}
+		}
+		delete(s.indexTemplates, name)
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+
+	names := matchingNames(s.indexTemplates, name)
+	if len(names) == 0 && name != "" && !strings.ContainsAny(name, "*?") {
+		return 0, nil, &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "index template matching [" + name + "] not found"}
+	}
+	templates := make([]interface{}, 0, len(names))
+	for _, n := range names {
+		templates = append(templates, map[string]interface{}{"name": n, "index_template": s.indexTemplates[n]})
+	}
+	return http.StatusOK, map[string]interface{}{"index_templates": templates}, nil
+}
+
+// componentTemplateAPI serves PUT, GET, HEAD and DELETE on
+// _component_template and _component_template/<name>, with name "" for
+// _component_template.
+func (s *Server) componentTemplateAPI(method, name string, q url.Values, body []byte) (int, interface{}, error) {
+	switch method {
+	case http.MethodPut, http.MethodPost:
+		var c componentTemplate
+		if err := json.Unmarshal(body, &c); err != nil {
+			return 0, nil, parsingError("failed to parse component template [%s]: %v", name, err)
+		}
+		if c.Template.Mappings != nil {
+			if err := validateMappings(c.Template.Mappings); err != nil {
+				return 0, nil, err
+			}
+		}
+		if _, ok := s.componentTemplates[name]; ok && q.Get("create") == "true" {
+			return 0, nil, badRequest("component template [%s] already exists", name)
+		}
+		s.componentTemplates[name] = &c
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	case http.MethodDelete:
+		if _, ok := s.componentTemplates[name]; !ok {
+			return 0, nil, &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "component template matching [" + name + "] not found"}
+		}
+		var users []string
+		for n, t := range s.indexTemplates {
+			for _, c := range t.ComposedOf {
+				if c == name {
+					users = append(users, n)
+				}
+			}
+		}
+		if len(users) > 0 {
+			sort.Strings(users)
+			return 0, nil, badRequest("component templates [%s] cannot be removed as they are still in use by index templates [%s]", name, strings.Join(users, ", "))
+		}
+		delete(s.componentTemplates, name)
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+
+	names := matchingNames(s.componentTemplates, name)
+	if len(names) == 0 && name != "" && !strings.ContainsAny(name, "*?") {
+		return 0, nil, &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "component template matching [" + name + "] not found"}
+	}
+	templates := make([]interface{}, 0, len(names))
+	for _, n := range names {
+		templates = append(templates, map[string]interface{}{"name": n, "component_template": s.componentTemplates[n]})
+	}
+	return http.StatusOK, map[string]interface{}{"component_templates": templates}, nil
+}
+
+// matchingNames returns the sorted keys of templates matching the comma
+// separated patterns of expr, or all of them for "".
+func matchingNames[T any](templates map[string]T, expr string) []string {
+	patterns := strings.Split(expr, ",")
+	var names []string
+	for n := range templates {
+		if expr == "" || matchAny(patterns, n) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// simulateIndex serves POST _index_template/_simulate_index/<name>: the
+// template an index created as name would get.
+func (s *Server) simulateIndex(name string) (int, interface{}, error) {
+	matching := s.matchingTemplates(name)
+	res := map[string]interface{}{"overlapping": []interface{}{}}
+	if len(matching) == 0 {
+		return http.StatusOK, res, nil
+	}
+	res["template"] = renderContent(s.compose(s.indexTemplates[matching[0]]))
+	res["overlapping"] = s.overlapping(matching[1:])
+	return http.StatusOK, res, nil
+}
+
+// simulateTemplate serves POST _index_template/_simulate[/<name>]: the
+// template composed from the body or, without one, the stored template
+// name, and the other templates its patterns overlap with.
+func (s *Server) simulateTemplate(name string, body []byte) (int, interface{}, error) {
+	var t *indexTemplate
+	if len(strings.TrimSpace(string(body))) > 0 {
+		var err error
+		if t, err = s.parseIndexTemplate(name, body); err != nil {
+			return 0, nil, err
+		}
+	} else {
+		var ok bool
+		if t, ok = s.indexTemplates[name]; !ok {
+			return 0, nil, &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "unable to simulate template [" + name + "] that does not exist"}
+		}
+	}
+	var others []string
+	for n, o := range s.indexTemplates {
+		if n != name && patternsOverlap(o.IndexPatterns, t.IndexPatterns) {
+			others = append(others, n)
+		}
+	}
+	sort.Strings(others)
+	return http.StatusOK, map[string]interface{}{
+		"template":    renderContent(s.compose(t)),
+		"overlapping": s.overlapping(others),
+	}, nil
+}
+
+func (s *Server) overlapping(names []string) []interface{} {
+	out := make([]interface{}, 0, len(names))
+	for _, n := range names {
+		out = append(out, map[string]interface{}{"name": n, "index_patterns": s.indexTemplates[n].IndexPatterns})
+	}
+	return out
+}
+
+// renderContent renders c the way the simulate APIs return it, with the
+// settings under "index" like GET <index>.
+func renderContent(c templateContent) map[string]interface{} {
+	return map[string]interface{}{
+		"settings": map[string]interface{}{"index": c.Settings},
+		"mappings": c.Mappings,
+		"aliases":  c.Aliases,
+	}
+}
@@ -0,0 +1,143 @@
+package esminitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// pipeline is an ingest pipeline. Only the set, remove, rename, lowercase
+// and uppercase processors are supported.
+type pipeline struct {
+	body       json.RawMessage
+	processors []processor
+}
+
+type processor func(fields map[string]interface{}) error
+
+func compilePipeline(body []byte) (*pipeline, error) {
+	var req struct {
+		Processors []map[string]map[string]interface{} `json:"processors"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, parsingError("failed to parse pipeline: %v", err)
+	}
+	if req.Processors == nil {
+		return nil, &esError{status: http.StatusBadRequest, typ: "parse_exception", reason: "[processors] required property is missing"}
+	}
+	p := &pipeline{body: json.RawMessage(append([]byte(nil), body...))}
+	for _, def := range req.Processors {
+		for typ, params := range def {
+			proc, err := compileProcessor(typ, params)
+			if err != nil {
+				return nil, err
+			}
+			p.processors = append(p.processors, proc)
+		}
+	}
+	return p, nil
+}
+
+func compileProcessor(typ string, params map[string]interface{}) (processor, error) {
+	field, _ := params["field"].(string)
+	if field == "" && typ != "remove" {
+		return nil, &esError{status: http.StatusBadRequest, typ: "parse_exception", reason: "[field] required property is missing"}
+	}
+	path := strings.Split(field, ".")
+	switch typ {
+	case "set":
+		value, ok := params["value"]
+		if !ok {
+			return nil, &esError{status: http.StatusBadRequest, typ: "parse_exception", reason: "[value] required property is missing"}
+		}
+		return func(fields map[string]interface{}) error {
+			return setPath(fields, path, deepCopy(value))
+		}, nil
+	case "remove":
+		names := stringList(params["field"])
+		if len(names) == 0 {
+			return nil, &esError{status: http.StatusBadRequest, typ: "parse_exception", reason: "[field] required property is missing"}
+		}
+		return func(fields map[string]interface{}) error {
+			for _, name := range names {
+				if !removePath(fields, strings.Split(name, ".")) {
+					return badRequest("field [%s] not present as part of path [%s]", name, name)
+				}
+			}
+			return nil
+		}, nil
+	case "rename":
+		target, _ := params["target_field"].(string)
+		if target == "" {
+			return nil, &esError{status: http.StatusBadRequest, typ: "parse_exception", reason: "[target_field] required property is missing"}
+		}
+		return func(fields map[string]interface{}) error {
+			v := lookupPath(fields, path)
+			if v == nil || !removePath(fields, path) {
+				return badRequest("field [%s] doesn't exist", field)
+			}
+			return setPath(fields, strings.Split(target, "."), v)
+		}, nil
+	case "lowercase", "uppercase":
+		convert := strings.ToLower
+		if typ == "uppercase" {
+			convert = strings.ToUpper
+		}
+		return func(fields map[string]interface{}) error {
+			v, ok := lookupPath(fields, path).(string)
+			if !ok {
+				return badRequest("field [%s] of type [%T] cannot be cast to [java.lang.String]", field, lookupPath(fields, path))
+			}
+			return setPath(fields, path, convert(v))
+		}, nil
+	}
+	return nil, &esError{status: http.StatusBadRequest, typ: "parse_exception", reason: fmt.Sprintf("No processor type exists with name [%s]", typ)}
+}
+
+func removePath(fields map[string]interface{}, path []string) bool {
+	parent, ok := lookupPath(fields, path[:len(path)-1]).(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, ok := parent[path[len(path)-1]]; !ok {
+		return false
+	}
+	delete(parent, path[len(path)-1])
+	return true
+}
+
+// run applies the processors of p to fields in order.
+func (p *pipeline) run(fields map[string]interface{}) error {
+	for _, proc := range p.processors {
+		if err := proc(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) pipelineAPI(method, id string, body []byte) (int, interface{}, error) {
+	switch method {
+	case http.MethodPut:
+		p, err := compilePipeline(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.pipelines[id] = p
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	case http.MethodGet:
+		p, ok := s.pipelines[id]
+		if !ok {
+			return http.StatusNotFound, map[string]interface{}{}, nil
+		}
+		return http.StatusOK, map[string]interface{}{id: p.body}, nil
+	case http.MethodDelete:
+		if _, ok := s.pipelines[id]; !ok {
+			return 0, nil, &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "pipeline [" + id + "] is missing"}
+		}
+		delete(s.pipelines, id)
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+	return 0, nil, badRequest("unsupported method [%s] for pipelines", method)
+}
@@ -0,0 +1,250 @@
+package esminitest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type bound struct {
+	value     interface{}
+	inclusive bool
+}
+
+func compileRange(params map[string]interface{}) (matcher, error) {
+	field, v, err := singleField("range", params)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, parsingError("[range] query malformed, no start_object after query name")
+	}
+
+	var lower, upper *bound
+	if v, ok := p["from"]; ok && v != nil {
+		inclusive, _ := p["include_lower"].(bool)
+		if _, ok := p["include_lower"]; !ok {
+			inclusive = true
+		}
+		lower = &bound{value: v, inclusive: inclusive}
+	}
+	if v, ok := p["to"]; ok && v != nil {
+		inclusive, _ := p["include_upper"].(bool)
+		if _, ok := p["include_upper"]; !ok {
+			inclusive = true
+		}
+		upper = &bound{value: v, inclusive: inclusive}
+	}
+	for key, inclusive := range map[string]bool{"gt": false, "gte": true} {
+		if v, ok := p[key]; ok && v != nil {
+			lower = &bound{value: v, inclusive: inclusive}
+		}
+	}
+	for key, inclusive := range map[string]bool{"lt": false, "lte": true} {
+		if v, ok := p[key]; ok && v != nil {
+			upper = &bound{value: v, inclusive: inclusive}
+		}
+	}
+
+	loc := time.UTC
+	if tz, ok := p["time_zone"].(string); ok && tz != "" {
+		if loc, err = parseTimeZone(tz); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+
+	// Date bounds are resolved once. Rounding widens inclusive bounds and
+	// narrows exclusive ones, as Elasticsearch does.
+	resolve := func(b *bound, roundUp bool) (*bound, error) {
+		s, ok := b.value.(string)
+		if !ok {
+			return b, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return &bound{value: f, inclusive: b.inclusive}, nil
+		}
+		t, ok, err := parseDateMath(s, now, loc, roundUp)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return b, nil
+		}
+		return &bound{value: float64(t.UnixNano() / int64(time.Millisecond)), inclusive: b.inclusive}, nil
+	}
+	if lower != nil {
+		if lower, err = resolve(lower, !lower.inclusive); err != nil {
+			return nil, err
+		}
+	}
+	if upper != nil {
+		if upper, err = resolve(upper, upper.inclusive); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(idx *index, doc *document) (bool, float64) {
+		for _, v := range values(doc.fields, field) {
+			v = rangeValue(v, loc)
+			if lower != nil {
+				c := compareValues(v, lower.value)
+				if c < 0 || c == 0 && !lower.inclusive {
+					continue
+				}
+			}
+			if upper != nil {
+				c := compareValues(v, upper.value)
+				if c > 0 || c == 0 && !upper.inclusive {
+					continue
+				}
+			}
+			return true, 1
+		}
+		return false, 0
+	}, nil
+}
+
+// rangeValue turns stored date strings into epoch milliseconds so they
+// compare with resolved date bounds.
+func rangeValue(v interface{}, loc *time.Location) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	if t, ok := parseDate(s, loc); ok {
+		return float64(t.UnixNano() / int64(time.Millisecond))
+	}
+	return v
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"2006-01",
+}
+
+func parseDate(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseTimeZone(tz string) (*time.Location, error) {
+	if loc, err := time.LoadLocation(tz); err == nil {
+		return loc, nil
+	}
+	if t, err := time.Parse("-07:00", tz); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(tz, offset), nil
+	}
+	return nil, badRequest("unknown time zone [%s]", tz)
+}
+
+// parseDateMath resolves expressions like "now-7d/d" or "2020-01-01||+1M".
+// It reports false when s is neither date math nor a date.
+func parseDateMath(s string, now time.Time, loc *time.Location, roundUp bool) (time.Time, bool, error) {
+	var t time.Time
+	var expr string
+	switch {
+	case strings.HasPrefix(s, "now"):
+		t, expr = now.In(loc), s[len("now"):]
+	case strings.Contains(s, "||"):
+		parts := strings.SplitN(s, "||", 2)
+		var ok bool
+		if t, ok = parseDate(parts[0], loc); !ok {
+			return time.Time{}, false, badRequest("failed to parse date field [%s]", s)
+		}
+		expr = parts[1]
+	default:
+		t, ok := parseDate(s, loc)
+		return t, ok, nil
+	}
+
+	for len(expr) > 0 {
+		op := expr[0]
+		expr = expr[1:]
+		n := 1
+		if op != '/' {
+			j := 0
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			if j > 0 {
+				n, _ = strconv.Atoi(expr[:j])
+			}
+			expr = expr[j:]
+		}
+		if len(expr) == 0 {
+			return time.Time{}, false, badRequest("truncated date math [%s]", s)
+		}
+		unit := expr[0]
+		expr = expr[1:]
+
+		switch op {
+		case '+':
+			t = addUnit(t, unit, n)
+		case '-':
+			t = addUnit(t, unit, -n)
+		case '/':
+			t = roundDown(t, unit)
+			if roundUp {
+				t = addUnit(t, unit, 1).Add(-time.Millisecond)
+			}
+		default:
+			return time.Time{}, false, badRequest("operator not supported for date math [%s]", s)
+		}
+		if t.IsZero() {
+			return time.Time{}, false, badRequest("unit [%c] not supported for date math [%s]", unit, s)
+		}
+	}
+	return t, true, nil
+}
+
+func addUnit(t time.Time, unit byte, n int) time.Time {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0)
+	case 'M':
+		return t.AddDate(0, n, 0)
+	case 'w':
+		return t.AddDate(0, 0, 7*n)
+	case 'd':
+		return t.AddDate(0, 0, n)
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour)
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute)
+	case 's':
+		return t.Add(time.Duration(n) * time.Second)
+	}
+	return time.Time{}
+}
+
+func roundDown(t time.Time, unit byte) time.Time {
+	y, mo, d := t.Date()
+	switch unit {
+	case 'y':
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	case 'M':
+		return time.Date(y, mo, 1, 0, 0, 0, 0, t.Location())
+	case 'w':
+		day := time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case 'd':
+		return time.Date(y, mo, d, 0, 0, 0, 0, t.Location())
+	case 'h', 'H':
+		return time.Date(y, mo, d, t.Hour(), 0, 0, 0, t.Location())
+	case 'm':
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case 's':
+		return time.Date(y, mo, d, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	}
+	return time.Time{}
+}
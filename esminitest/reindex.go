@@ -0,0 +1,103 @@
+package esminitest
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+type reindexBody struct {
+	Source struct {
+		Index interface{}            `json:"index"`
+		Query map[string]interface{} `json:"query"`
+		Size  int                    `json:"size"`
+	} `json:"source"`
+	Dest struct {
+		Index    string `json:"index"`
+		Pipeline string `json:"pipeline"`
+	} `json:"dest"`
+	Script    interface{} `json:"script"`
+	Conflicts string      `json:"conflicts"`
+}
+
+// reindex copies the source documents into the destination index, running
+// the script and then the pipeline on each. Source documents are read as
+// they were when the request started.
+func (s *Server) reindex(q url.Values, body []byte) (int, interface{}, error) {
+	var req reindexBody
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parsingError("failed to parse reindex request: %v", err)
+	}
+	sources := stringList(req.Source.Index)
+	if len(sources) == 0 || req.Dest.Index == "" {
+		return 0, nil, badRequest("Validation Failed: 1: use _reindex with a source and a destination index;")
+	}
+	for _, src := range sources {
+		if src == req.Dest.Index {
+			return 0, nil, badRequest("reindex cannot write into an index its reading from [%s]", src)
+		}
+	}
+	p, err := parseTaskParams(q, req.Conflicts)
+	if err != nil {
+		return 0, nil, err
+	}
+	if req.Source.Size > 0 {
+		p.batchSize = req.Source.Size
+	}
+	var sc *script
+	if req.Script != nil {
+		if sc, err = compileUpdateScript(req.Script); err != nil {
+			return 0, nil, err
+		}
+	}
+	var pl *pipeline
+	if req.Dest.Pipeline != "" {
+		var ok bool
+		if pl, ok = s.pipelines[req.Dest.Pipeline]; !ok {
+			return 0, nil, badRequest("pipeline with id [%s] does not exist", req.Dest.Pipeline)
+		}
+	}
+	hits, err := s.query(strings.Join(sources, ","), req.Source.Query)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return s.startTask("indices:data/write/reindex", hits, p, func(it taskItem) (string, error) {
+		fields := deepCopy(it.doc.fields).(map[string]interface{})
+		if sc != nil {
+			ctx := map[string]interface{}{"_source": fields, "op": "index"}
+			if err := sc.update(ctx); err != nil {
+				return "", err
+			}
+			switch ctx["op"] {
+			case "noop":
+				return "noop", nil
+			case "delete":
+				if dest, ok := s.indices[req.Dest.Index]; ok {
+					if _, ok := dest.remove(it.doc.id); ok {
+						return "deleted", nil
+					}
+				}
+				return "noop", nil
+			case "index":
+			default:
+				return "", badRequest("Operation type [%v] not allowed, only [noop, index, delete] are allowed", ctx["op"])
+			}
+		}
+		if pl != nil {
+			if err := pl.run(fields); err != nil {
+				return "", err
+			}
+		}
+		source, err := json.Marshal(fields)
+		if err != nil {
+			return "", err
+		}
+		if fields, err = decodeSource(source); err != nil {
+			return "", err
+		}
+		doc, result := s.autoCreate(req.Dest.Index).put(it.doc.id, source, fields)
+		doc.routing = it.doc.routing
+		return result, nil
+	})
+}
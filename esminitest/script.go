@@ -0,0 +1,474 @@
+package esminitest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// script is a compiled Painless expression. Only the arithmetic subset
+// esmini's tests need is understood: number and string literals,
+// params.<name>, doc['<field>'].value, doc['<field>'].size(), unary minus,
+// + - * / and parentheses.
+//
+// Update scripts are instead a list of statements separated by ';':
+// ctx._source.<path> = <expr> (or += and -=), ctx._source.<path>.add(<expr>),
+// ctx._source[.<path>].remove('<name>') and ctx.op = 'noop' or 'delete'.
+// Expressions may read ctx._source.<path> there.
+type script struct {
+	source string
+	params map[string]interface{}
+	eval   evalFunc
+	exec   execFunc
+}
+
+type scriptEnv struct {
+	doc    map[string]interface{}
+	ctx    map[string]interface{}
+	params map[string]interface{}
+}
+
+func compileScript(raw interface{}) (*script, error) {
+	return compileScriptSource(raw, false)
+}
+
+// compileUpdateScript compiles the script of an update, update_by_query or
+// reindex request.
+func compileUpdateScript(raw interface{}) (*script, error) {
+	return compileScriptSource(raw, true)
+}
+
+func compileScriptSource(raw interface{}, update bool) (*script, error) {
+	s := &script{params: map[string]interface{}{}}
+	switch t := raw.(type) {
+	case string:
+		s.source = t
+	case map[string]interface{}:
+		if lang, ok := t["lang"].(string); ok && lang != "painless" {
+			return nil, badRequest("script_lang not supported [%s]", lang)
+		}
+		s.source, _ = t["source"].(string)
+		if s.source == "" {
+			s.source, _ = t["inline"].(string)
+		}
+		if params, ok := t["params"].(map[string]interface{}); ok {
+			s.params = params
+		}
+	default:
+		return nil, parsingError("[script] malformed")
+	}
+
+	p := &scriptParser{src: s.source}
+	var err error
+	if update {
+		s.exec, err = p.statements()
+	} else {
+		s.eval, err = p.expr()
+	}
+	if err == nil {
+		p.space()
+		if p.pos < len(p.src) {
+			err = fmt.Errorf("unexpected %q", p.src[p.pos:])
+		}
+	}
+	if err != nil {
+		return nil, &esError{
+			status: 400,
+			typ:    "script_exception",
+			reason: fmt.Sprintf("compile error in [%s]: %v (esminitest only runs arithmetic expressions)", s.source, err),
+		}
+	}
+	return s, nil
+}
+
+func (s *script) run(doc map[string]interface{}) (interface{}, error) {
+	v, err := s.eval(&scriptEnv{doc: doc, params: s.params})
+	if err != nil {
+		return nil, &esError{status: 400, typ: "script_exception", reason: fmt.Sprintf("runtime error in [%s]: %v", s.source, err)}
+	}
+	return v, nil
+}
+
+// update runs an update script against ctx, which holds _source and op.
+func (s *script) update(ctx map[string]interface{}) error {
+	if err := s.exec(&scriptEnv{ctx: ctx, params: s.params}); err != nil {
+		return &esError{status: 400, typ: "script_exception", reason: fmt.Sprintf("runtime error in [%s]: %v", s.source, err)}
+	}
+	return nil
+}
+
+type evalFunc func(env *scriptEnv) (interface{}, error)
+
+type execFunc func(env *scriptEnv) error
+
+type scriptParser struct {
+	src string
+	pos int
+}
+
+func (p *scriptParser) space() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *scriptParser) peek() byte {
+	p.space()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *scriptParser) consume(s string) bool {
+	p.space()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *scriptParser) statements() (execFunc, error) {
+	var stmts []execFunc
+	for {
+		for p.consume(";") {
+		}
+		if p.peek() == 0 {
+			break
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+		if p.peek() != 0 && !p.consume(";") {
+			return nil, fmt.Errorf("expected ; before %q", p.src[p.pos:])
+		}
+	}
+	return func(env *scriptEnv) error {
+		for _, stmt := range stmts {
+			if err := stmt(env); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (p *scriptParser) statement() (execFunc, error) {
+	if p.consume("ctx.op") {
+		if !p.consume("=") {
+			return nil, fmt.Errorf("expected = after ctx.op")
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return func(env *scriptEnv) error {
+			v, err := e(env)
+			if err != nil {
+				return err
+			}
+			env.ctx["op"] = v
+			return nil
+		}, nil
+	}
+	if !p.consume("ctx._source") {
+		return nil, fmt.Errorf("unexpected %q", p.src[p.pos:])
+	}
+	path, method := p.sourcePath()
+
+	switch method {
+	case "add", "remove":
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return func(env *scriptEnv) error {
+			v, err := arg(env)
+			if err != nil {
+				return err
+			}
+			target := lookupPath(env.ctx["_source"], path)
+			switch t := target.(type) {
+			case map[string]interface{}:
+				if method == "remove" {
+					delete(t, fmt.Sprint(v))
+					return nil
+				}
+			case []interface{}:
+				if method == "add" {
+					return setPath(env.ctx["_source"], path, append(t, v))
+				}
+			case nil:
+				return fmt.Errorf("cannot invoke %s() on null", method)
+			}
+			return fmt.Errorf("cannot invoke %s() on %T", method, target)
+		}, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown method %s()", method)
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot assign ctx._source")
+	}
+	var op byte
+	switch {
+	case p.consume("+="):
+		op = '+'
+	case p.consume("-="):
+		op = '-'
+	case p.consume("="):
+	default:
+		return nil, fmt.Errorf("expected an assignment after ctx._source.%s", strings.Join(path, "."))
+	}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if op != 0 {
+		e = binary(op, func(env *scriptEnv) (interface{}, error) {
+			return lookupPath(env.ctx["_source"], path), nil
+		}, e)
+	}
+	return func(env *scriptEnv) error {
+		v, err := e(env)
+		if err != nil {
+			return err
+		}
+		return setPath(env.ctx["_source"], path, v)
+	}, nil
+}
+
+// sourcePath reads the .<name> segments following ctx._source, stopping at
+// a method call whose name it returns with the opening parenthesis consumed.
+func (p *scriptParser) sourcePath() ([]string, string) {
+	var path []string
+	for {
+		start := p.pos
+		if !p.consume(".") {
+			return path, ""
+		}
+		name := p.ident()
+		if name == "" {
+			p.pos = start
+			return path, ""
+		}
+		if p.consume("(") {
+			return path, name
+		}
+		path = append(path, name)
+	}
+}
+
+func lookupPath(source interface{}, path []string) interface{} {
+	v := source
+	for _, name := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+func setPath(source interface{}, path []string, v interface{}) error {
+	m, ok := source.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("ctx._source is not an object")
+	}
+	for _, name := range path[:len(path)-1] {
+		next, ok := m[name].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[name] = next
+		}
+		m = next
+	}
+	m[path[len(path)-1]] = v
+	return nil
+}
+
+func (p *scriptParser) expr() (evalFunc, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(op, left, right)
+	}
+}
+
+func (p *scriptParser) term() (evalFunc, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = binary(op, left, right)
+	}
+}
+
+func (p *scriptParser) factor() (evalFunc, error) {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	case c == '-':
+		p.pos++
+		e, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return binary('-', func(*scriptEnv) (interface{}, error) { return 0.0, nil }, e), nil
+	case c == '\'' || c == '"':
+		s, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return func(*scriptEnv) (interface{}, error) { return s, nil }, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		f, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(*scriptEnv) (interface{}, error) { return f, nil }, nil
+	case p.consume("ctx._source"):
+		path, method := p.sourcePath()
+		if method != "" {
+			return nil, fmt.Errorf("unknown method %s()", method)
+		}
+		return func(env *scriptEnv) (interface{}, error) {
+			if env.ctx == nil {
+				return nil, fmt.Errorf("ctx is only available in update scripts")
+			}
+			return lookupPath(env.ctx["_source"], path), nil
+		}, nil
+	case p.consume("params."):
+		name := p.ident()
+		return func(env *scriptEnv) (interface{}, error) {
+			v, ok := env.params[name]
+			if !ok {
+				return nil, fmt.Errorf("params.%s is not set", name)
+			}
+			return v, nil
+		}, nil
+	case p.consume("doc["):
+		field, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume("]") {
+			return nil, fmt.Errorf("missing ]")
+		}
+		switch {
+		case p.consume(".value"):
+			return func(env *scriptEnv) (interface{}, error) {
+				vals := values(env.doc, field)
+				if len(vals) == 0 {
+					return nil, fmt.Errorf("a document doesn't have a value for field [%s]", field)
+				}
+				return normalize(vals[0]), nil
+			}, nil
+		case p.consume(".size()"):
+			return func(env *scriptEnv) (interface{}, error) {
+				return float64(len(values(env.doc, field))), nil
+			}, nil
+		}
+		return nil, fmt.Errorf("expected .value or .size() after doc['%s']", field)
+	}
+	return nil, fmt.Errorf("unexpected %q", p.src[p.pos:])
+}
+
+func (p *scriptParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r := rune(p.src[p.pos])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *scriptParser) quoted() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	end := strings.IndexByte(p.src[p.pos:], quote)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func binary(op byte, left, right evalFunc) evalFunc {
+	return func(env *scriptEnv) (interface{}, error) {
+		a, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		fa, aok := numeric(a)
+		fb, bok := numeric(b)
+		if !aok || !bok {
+			if op == '+' {
+				return fmt.Sprint(a) + fmt.Sprint(b), nil
+			}
+			return nil, fmt.Errorf("cannot apply [%c] to %v and %v", op, a, b)
+		}
+		switch op {
+		case '+':
+			return fa + fb, nil
+		case '-':
+			return fa - fb, nil
+		case '*':
+			return fa * fb, nil
+		}
+		if fb == 0 {
+			return nil, fmt.Errorf("/ by zero")
+		}
+		return fa / fb, nil
+	}
+}
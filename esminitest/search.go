@@ -0,0 +1,1414 @@
+package esminitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type searchBody struct {
+	Query            map[string]interface{} `json:"query"`
+	Version          bool                   `json:"version"`
+	SeqNoPrimaryTerm bool                   `json:"seq_no_primary_term"`
+	From             *int                   `json:"from"`
+	Size             *int                   `json:"size"`
+	Sort             []interface{}          `json:"sort"`
+	SearchAfter      []interface{}          `json:"search_after"`
+	PIT              *struct {
+		ID string `json:"id"`
+	} `json:"pit"`
+	Slice *struct {
+		ID  int `json:"id"`
+		Max int `json:"max"`
+	} `json:"slice"`
+	Aggs           map[string]interface{} `json:"aggs"`
+	Aggregations   map[string]interface{} `json:"aggregations"`
+	Highlight      map[string]interface{} `json:"highlight"`
+	Source         interface{}            `json:"_source"`
+	StoredFields   interface{}            `json:"stored_fields"`
+	DocvalueFields []interface{}          `json:"docvalue_fields"`
+
+	highlighter *highlighter
+	fetch       *fetchSpec
+}
+
+type scrollContext struct {
+	req   *searchBody
+	hits  []*hit
+	total int
+	size  int
+}
+
+type hit struct {
+	idx   *index
+	doc   *document
+	score float64
+	sort  []interface{}
+}
+
+type matcher func(idx *index, doc *document) (bool, float64)
+
+func (s *Server) search(r *http.Request, expr string, body []byte) (int, interface{}, error) {
+	var req searchBody
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := decodeBody(body, &req); err != nil {
+			return 0, nil, parsingError("failed to parse search source: %v", err)
+		}
+	}
+	from, size := 0, 10
+	if req.From != nil {
+		from = *req.From
+	}
+	if req.Size != nil {
+		size = *req.Size
+	}
+	q := r.URL.Query()
+	if v := q.Get("from"); v != "" {
+		from, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("size"); v != "" {
+		size, _ = strconv.Atoi(v)
+	}
+	if v := q.Get("seq_no_primary_term"); v != "" {
+		req.SeqNoPrimaryTerm = v == "true"
+	}
+
+	var indices []*index
+	var filters map[*index]matcher
+	var err error
+	if req.Highlight != nil {
+		if req.highlighter, err = newHighlighter(req.Highlight, req.Query); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if req.PIT != nil {
+		if expr != "_all" {
+			return 0, nil, badRequest("[indices] cannot be used with point in time")
+		}
+		var ok bool
+		if indices, ok = s.pits[req.PIT.ID]; !ok {
+			return 0, nil, &esError{
+				status: http.StatusNotFound,
+				typ:    "search_context_missing_exception",
+				reason: "No search context found for id [" + req.PIT.ID + "]",
+			}
+		}
+	} else if indices, err = s.resolve(expr); err != nil {
+		return 0, nil, err
+	} else if filters, err = s.aliasFilters(expr); err != nil {
+		return 0, nil, err
+	}
+	if req.fetch, err = newFetchSpec(&req, indices); err != nil {
+		return 0, nil, err
+	}
+
+	hits, err := queryIndices(indices, req.Query, filters)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := sortHits(hits, req.Sort); err != nil {
+		return 0, nil, err
+	}
+	total := len(hits)
+	aggs := req.Aggregations
+	if aggs == nil {
+		aggs = req.Aggs
+	}
+	var aggResults map[string]interface{}
+	if aggs != nil {
+		docs := make([]map[string]interface{}, len(hits))
+		for j, h := range hits {
+			docs[j] = h.doc.fields
+		}
+		if aggResults, err = aggregate(aggs, docs); err != nil {
+			return 0, nil, err
+		}
+	}
+	if req.SearchAfter != nil {
+		if len(req.Sort) == 0 {
+			return 0, nil, badRequest("Sort must contain at least one field.")
+		}
+		if hits, err = searchAfter(hits, req.Sort, req.SearchAfter); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if req.Slice != nil {
+		if hits, err = slice(hits, req.Slice.ID, req.Slice.Max); err != nil {
+			return 0, nil, err
+		}
+		total = len(hits)
+	}
+
+	if keepAlive := q.Get("scroll"); keepAlive != "" {
+		if from > 0 {
+			return 0, nil, badRequest("Validation Failed: 1: using [from] is not allowed in a scroll context;")
+		}
+		sc := &scrollContext{req: &req, total: total, size: size}
+		for _, h := range hits {
+			doc := *h.doc
+			sc.hits = append(sc.hits, &hit{idx: h.idx, doc: &doc, score: h.score, sort: h.sort})
+		}
+		id := newID()
+		s.scrolls[id] = sc
+		res := sc.next()
+		res["_scroll_id"] = id
+		return http.StatusOK, res, nil
+	}
+
+	if from > len(hits) {
+		from = len(hits)
+	}
+	page := hits[from:]
+	if size < len(page) {
+		page = page[:size]
+	}
+
+	res := renderHits(&req, page, total, maxScore(&req, hits))
+	if req.PIT != nil {
+		res["pit_id"] = req.PIT.ID
+	}
+	if aggResults != nil {
+		res["aggregations"] = aggResults
+	}
+	return http.StatusOK, res, nil
+}
+
+func (sc *scrollContext) next() map[string]interface{} {
+	page := sc.hits
+	if sc.size < len(page) {
+		page = page[:sc.size]
+	}
+	res := renderHits(sc.req, page, sc.total, maxScore(sc.req, sc.hits))
+	sc.hits = sc.hits[len(page):]
+	return res
+}
+
+func (s *Server) scroll(method string, body []byte) (int, interface{}, error) {
+	if method == http.MethodDelete {
+		var req struct {
+			ScrollID interface{} `json:"scroll_id"`
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				return 0, nil, parsingError("failed to parse clear scroll request: %v", err)
+			}
+		}
+		var ids []string
+		switch t := req.ScrollID.(type) {
+		case string:
+			ids = strings.Split(t, ",")
+		case []interface{}:
+			for _, id := range t {
+				ids = append(ids, fmt.Sprint(id))
+			}
+		}
+		freed := 0
+		for _, id := range ids {
+			if id == "_all" {
+				freed += len(s.scrolls)
+				s.scrolls = map[string]*scrollContext{}
+				continue
+			}
+			if _, ok := s.scrolls[id]; ok {
+				delete(s.scrolls, id)
+				freed++
+			}
+		}
+		status := http.StatusOK
+		if freed == 0 {
+			status = http.StatusNotFound
+		}
+		return status, map[string]interface{}{"succeeded": true, "num_freed": freed}, nil
+	}
+
+	var req struct {
+		ScrollID string `json:"scroll_id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parsingError("failed to parse scroll request: %v", err)
+	}
+	sc, ok := s.scrolls[req.ScrollID]
+	if !ok {
+		return 0, nil, &esError{
+			status: http.StatusNotFound,
+			typ:    "search_context_missing_exception",
+			reason: "No search context found for id [" + req.ScrollID + "]",
+		}
+	}
+	res := sc.next()
+	res["_scroll_id"] = req.ScrollID
+	return http.StatusOK, res, nil
+}
+
+// slice keeps the hits of slice id out of max, like a sliced scroll does.
+func slice(hits []*hit, id, max int) ([]*hit, error) {
+	if max <= 1 {
+		return nil, badRequest("max must be greater than 1")
+	}
+	if id < 0 || id >= max {
+		return nil, badRequest("id must be lower than max")
+	}
+	var out []*hit
+	for _, h := range hits {
+		f := fnv.New32a()
+		_, _ = f.Write([]byte(h.doc.id))
+		if int(f.Sum32()%uint32(max)) == id {
+			out = append(out, h)
+		}
+	}
+	return out, nil
+}
+
+func maxScore(req *searchBody, hits []*hit) interface{} {
+	if len(req.Sort) > 0 || len(hits) == 0 {
+		return nil
+	}
+	return hits[0].score
+}
+
+func renderHits(req *searchBody, hits []*hit, total int, maxScore interface{}) map[string]interface{} {
+	out := make([]interface{}, 0, len(hits))
+	for _, h := range hits {
+		m := map[string]interface{}{
+			"_index": h.idx.name,
+			"_type":  "_doc",
+			"_id":    h.doc.id,
+			"_score": h.score,
+		}
+		req.fetch.apply(m, h.idx, h.doc)
+		if len(req.Sort) > 0 {
+			m["_score"] = nil
+			m["sort"] = h.sort
+		}
+		if h.doc.routing != "" {
+			m["_routing"] = h.doc.routing
+		}
+		if req.Version {
+			m["_version"] = h.doc.version
+		}
+		if req.SeqNoPrimaryTerm {
+			m["_seq_no"] = h.doc.seqNo
+			m["_primary_term"] = h.doc.primaryTerm
+		}
+		if req.highlighter != nil {
+			if hl := req.highlighter.highlight(h.doc); len(hl) > 0 {
+				m["highlight"] = hl
+			}
+		}
+		out = append(out, m)
+	}
+
+	return map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   map[string]interface{}{"total": 1, "successful": 1, "skipped": 0, "failed": 0},
+		"hits": map[string]interface{}{
+			"total":     map[string]interface{}{"value": total, "relation": "eq"},
+			"max_score": maxScore,
+			"hits":      out,
+		},
+	}
+}
+
+func (s *Server) count(expr string, body []byte) (int, interface{}, error) {
+	var req searchBody
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := decodeBody(body, &req); err != nil {
+			return 0, nil, parsingError("failed to parse count source: %v", err)
+		}
+	}
+	hits, err := s.query(expr, req.Query)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, map[string]interface{}{
+		"count":   len(hits),
+		"_shards": shards(),
+	}, nil
+}
+
+func (s *Server) query(expr string, query map[string]interface{}) ([]*hit, error) {
+	indices, err := s.resolve(expr)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := s.aliasFilters(expr)
+	if err != nil {
+		return nil, err
+	}
+	return queryIndices(indices, query, filters)
+}
+
+// queryIndices returns the documents of indices matching query and the
+// alias filter of their index, if any.
+func queryIndices(indices []*index, query map[string]interface{}, filters map[*index]matcher) ([]*hit, error) {
+	var err error
+	match := matchAll
+	if query != nil {
+		if match, err = compile(query); err != nil {
+			return nil, err
+		}
+	}
+	var hits []*hit
+	for _, idx := range indices {
+		for _, id := range idx.order {
+			doc := idx.docs[id]
+			if filter, ok := filters[idx]; ok {
+				if ok, _ := filter(idx, doc); !ok {
+					continue
+				}
+			}
+			if ok, score := match(idx, doc); ok {
+				hits = append(hits, &hit{idx: idx, doc: doc, score: score})
+			}
+		}
+	}
+	return hits, nil
+}
+
+func matchAll(*index, *document) (bool, float64) {
+	return true, 1
+}
+
+func compile(query map[string]interface{}) (matcher, error) {
+	if len(query) != 1 {
+		return nil, parsingError("query malformed, expected a single query type but found %d", len(query))
+	}
+	for typ, body := range query {
+		params, ok := body.(map[string]interface{})
+		if !ok {
+			return nil, parsingError("[%s] query malformed, no start_object after query name", typ)
+		}
+		switch typ {
+		case "match_all":
+			return matchAll, nil
+		case "match_none":
+			return func(*index, *document) (bool, float64) { return false, 0 }, nil
+		case "bool":
+			return compileBool(params)
+		case "term":
+			return compileTerm(params)
+		case "terms":
+			return compileTerms(params)
+		case "ids":
+			return compileIDs(params)
+		case "exists":
+			return compileExists(params)
+		case "match":
+			return compileMatch(params)
+		case "match_phrase":
+			return compileMatchPhrase(params)
+		case "range":
+			return compileRange(params)
+		case "prefix", "wildcard", "regexp":
+			return compilePattern(typ, params)
+		case "multi_match":
+			return compileMultiMatch(params)
+		}
+		return nil, parsingError("unknown query [%s]", typ)
+	}
+	return nil, nil
+}
+
+func compileClauses(v interface{}) ([]matcher, error) {
+	var raw []interface{}
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		raw = t
+	default:
+		raw = []interface{}{t}
+	}
+	matchers := make([]matcher, 0, len(raw))
+	for _, c := range raw {
+		q, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, parsingError("[bool] query malformed, expected a query object")
+		}
+		m, err := compile(q)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func compileBool(params map[string]interface{}) (matcher, error) {
+	must, err := compileClauses(params["must"])
+	if err != nil {
+		return nil, err
+	}
+	should, err := compileClauses(params["should"])
+	if err != nil {
+		return nil, err
+	}
+	mustNot, err := compileClauses(params["must_not"])
+	if err != nil {
+		return nil, err
+	}
+	filter, err := compileClauses(params["filter"])
+	if err != nil {
+		return nil, err
+	}
+
+	minShould := 0
+	if len(should) > 0 && len(must) == 0 && len(filter) == 0 {
+		minShould = 1
+	}
+	if v, ok := params["minimum_should_match"]; ok {
+		minShould = minimumShouldMatch(fmt.Sprint(v), len(should))
+	}
+
+	return func(idx *index, doc *document) (bool, float64) {
+		score := 0.0
+		for _, m := range must {
+			ok, s := m(idx, doc)
+			if !ok {
+				return false, 0
+			}
+			score += s
+		}
+		for _, m := range filter {
+			if ok, _ := m(idx, doc); !ok {
+				return false, 0
+			}
+		}
+		for _, m := range mustNot {
+			if ok, _ := m(idx, doc); ok {
+				return false, 0
+			}
+		}
+		matched := 0
+		for _, m := range should {
+			if ok, s := m(idx, doc); ok {
+				matched++
+				score += s
+			}
+		}
+		if matched < minShould {
+			return false, 0
+		}
+		if len(must) == 0 && len(should) == 0 {
+			score = 0
+		}
+		return true, score
+	}, nil
+}
+
+// minimumShouldMatch understands the integer and percentage forms, both
+// positive and negative.
+func minimumShouldMatch(spec string, optional int) int {
+	spec = strings.TrimSpace(spec)
+	var n int
+	if strings.HasSuffix(spec, "%") {
+		p, err := strconv.Atoi(strings.TrimSuffix(spec, "%"))
+		if err != nil {
+			return 1
+		}
+		n = optional * p / 100
+		if p < 0 {
+			n = optional + n
+		}
+	} else {
+		v, err := strconv.Atoi(spec)
+		if err != nil {
+			return 1
+		}
+		n = v
+		if v < 0 {
+			n = optional + v
+		}
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > optional {
+		n = optional
+	}
+	return n
+}
+
+func singleField(typ string, params map[string]interface{}) (string, interface{}, error) {
+	if len(params) != 1 {
+		var fields []string
+		for k := range params {
+			if k != "boost" && k != "_name" {
+				fields = append(fields, k)
+			}
+		}
+		if len(fields) != 1 {
+			return "", nil, parsingError("[%s] query doesn't support multiple fields", typ)
+		}
+		return fields[0], params[fields[0]], nil
+	}
+	for k, v := range params {
+		return k, v, nil
+	}
+	return "", nil, nil
+}
+
+func compileTerm(params map[string]interface{}) (matcher, error) {
+	field, v, err := singleField("term", params)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		v = m["value"]
+	}
+	return func(idx *index, doc *document) (bool, float64) {
+		if termMatches(idx, doc, field, v) {
+			return true, 1
+		}
+		return false, 0
+	}, nil
+}
+
+func compileTerms(params map[string]interface{}) (matcher, error) {
+	field, v, err := singleField("terms", params)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := v.([]interface{})
+	if !ok {
+		return nil, parsingError("[terms] query does not support [%s]", field)
+	}
+	return func(idx *index, doc *document) (bool, float64) {
+		for _, value := range values {
+			if termMatches(idx, doc, field, value) {
+				return true, 1
+			}
+		}
+		return false, 0
+	}, nil
+}
+
+func compileIDs(params map[string]interface{}) (matcher, error) {
+	raw, _ := params["values"].([]interface{})
+	ids := map[string]bool{}
+	for _, v := range raw {
+		ids[fmt.Sprint(v)] = true
+	}
+	return func(idx *index, doc *document) (bool, float64) {
+		return ids[doc.id], 1
+	}, nil
+}
+
+func compileExists(params map[string]interface{}) (matcher, error) {
+	field, ok := params["field"].(string)
+	if !ok {
+		return nil, parsingError("[exists] must be provided with a [field]")
+	}
+	return func(idx *index, doc *document) (bool, float64) {
+		for _, v := range values(doc.fields, field) {
+			if v != nil {
+				return true, 1
+			}
+		}
+		return false, 0
+	}, nil
+}
+
+func compileMatch(params map[string]interface{}) (matcher, error) {
+	field, v, err := singleField("match", params)
+	if err != nil {
+		return nil, err
+	}
+	opts := map[string]interface{}{"fields": []interface{}{field}}
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, e := range m {
+			opts[k] = e
+		}
+	} else {
+		opts["query"] = v
+	}
+	return compileMultiMatch(opts)
+}
+
+func compileMatchPhrase(params map[string]interface{}) (matcher, error) {
+	field, v, err := singleField("match_phrase", params)
+	if err != nil {
+		return nil, err
+	}
+	opts := map[string]interface{}{"fields": []interface{}{field}, "type": "phrase"}
+	if m, ok := v.(map[string]interface{}); ok {
+		opts["query"] = m["query"]
+	} else {
+		opts["query"] = v
+	}
+	return compileMultiMatch(opts)
+}
+
+// compilePattern handles prefix, wildcard and regexp queries, which match
+// whole values of keyword fields and single tokens of text fields.
+func compilePattern(typ string, params map[string]interface{}) (matcher, error) {
+	field, v, err := singleField(typ, params)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		if v, ok = m["value"]; !ok {
+			v = m[typ]
+		}
+	}
+	pattern := fmt.Sprint(v)
+
+	var fn func(string) bool
+	switch typ {
+	case "prefix":
+		fn = func(s string) bool { return strings.HasPrefix(s, pattern) }
+	case "wildcard":
+		var expr strings.Builder
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		re := regexp.MustCompile("^(?s:" + expr.String() + ")$")
+		fn = re.MatchString
+	case "regexp":
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, badRequest("failed to parse regexp [%s]: %v", pattern, err)
+		}
+		fn = re.MatchString
+	}
+
+	return func(idx *index, doc *document) (bool, float64) {
+		typ := idx.fieldType(field)
+		exact := typ != "" && typ != "text" || strings.HasSuffix(field, ".keyword")
+		for _, v := range values(doc.fields, field) {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if exact {
+				if fn(s) {
+					return true, 1
+				}
+				continue
+			}
+			for _, tok := range analyze(s) {
+				if fn(tok) {
+					return true, 1
+				}
+			}
+		}
+		return false, 0
+	}, nil
+}
+
+type textMatch struct {
+	fields    []string
+	boosts    []float64
+	tokens    []string
+	raw       string
+	typ       string
+	and       bool
+	fuzziness string
+	minShould string
+}
+
+func compileMultiMatch(params map[string]interface{}) (matcher, error) {
+	rawFields, _ := params["fields"].([]interface{})
+	if len(rawFields) == 0 {
+		return nil, parsingError("[multi_match] requires fields at the moment")
+	}
+	query, ok := params["query"]
+	if !ok {
+		return nil, parsingError("[multi_match] requires query value")
+	}
+	tm := &textMatch{
+		raw:    fmt.Sprint(query),
+		tokens: analyze(fmt.Sprint(query)),
+		typ:    "best_fields",
+	}
+	for _, f := range rawFields {
+		name, boost := fmt.Sprint(f), 1.0
+		if i := strings.LastIndex(name, "^"); i >= 0 {
+			if b, err := strconv.ParseFloat(name[i+1:], 64); err == nil {
+				boost = b
+			}
+			name = name[:i]
+		}
+		tm.fields = append(tm.fields, name)
+		tm.boosts = append(tm.boosts, boost)
+	}
+	if v, ok := params["type"].(string); ok && v != "" {
+		tm.typ = v
+	}
+	switch tm.typ {
+	case "best_fields", "most_fields", "cross_fields", "phrase", "phrase_prefix", "bool_prefix":
+	default:
+		return nil, badRequest("No type found for name: %s", tm.typ)
+	}
+	if v, ok := params["operator"].(string); ok {
+		tm.and = strings.EqualFold(v, "and")
+	}
+	if v, ok := params["fuzziness"]; ok {
+		tm.fuzziness = fmt.Sprint(v)
+	}
+	if v, ok := params["minimum_should_match"]; ok {
+		tm.minShould = fmt.Sprint(v)
+	}
+	return tm.match, nil
+}
+
+func (tm *textMatch) required() int {
+	n := len(tm.tokens)
+	if tm.and {
+		return n
+	}
+	if tm.minShould != "" {
+		if r := minimumShouldMatch(tm.minShould, n); r > 0 {
+			return r
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return 1
+}
+
+func (tm *textMatch) match(idx *index, doc *document) (bool, float64) {
+	if len(tm.tokens) == 0 {
+		return false, 0
+	}
+	required := tm.required()
+
+	if tm.typ == "cross_fields" {
+		matched := make([]bool, len(tm.tokens))
+		score := 0.0
+		for i, field := range tm.fields {
+			for j, ok := range tm.fieldTokens(idx, doc, field) {
+				if ok {
+					matched[j] = true
+					score += tm.boosts[i]
+				}
+			}
+		}
+		if count(matched) < required {
+			return false, 0
+		}
+		return true, score
+	}
+
+	best, sum, found := 0.0, 0.0, false
+	for i, field := range tm.fields {
+		var ok bool
+		var score float64
+		switch tm.typ {
+		case "phrase", "phrase_prefix":
+			ok = tm.phrase(idx, doc, field)
+			score = float64(len(tm.tokens))
+		default:
+			n := count(tm.fieldTokens(idx, doc, field))
+			ok = n >= required
+			score = float64(n)
+		}
+		if !ok {
+			continue
+		}
+		found = true
+		score *= tm.boosts[i]
+		sum += score
+		if score > best {
+			best = score
+		}
+	}
+	if !found {
+		return false, 0
+	}
+	if tm.typ == "most_fields" {
+		return true, sum
+	}
+	return true, best
+}
+
+// fieldTokens reports, for each query token, whether it occurs in field.
+func (tm *textMatch) fieldTokens(idx *index, doc *document, field string) []bool {
+	matched := make([]bool, len(tm.tokens))
+	vals := values(doc.fields, field)
+	if len(vals) == 0 {
+		return matched
+	}
+	if idx.fieldType(field) == "keyword" {
+		for _, v := range vals {
+			if fmt.Sprint(v) == tm.raw {
+				for i := range matched {
+					matched[i] = true
+				}
+			}
+		}
+		return matched
+	}
+	var docTokens []string
+	for _, v := range vals {
+		docTokens = append(docTokens, analyze(fmt.Sprint(v))...)
+	}
+	for i, qt := range tm.tokens {
+		prefix := tm.typ == "bool_prefix" && i == len(tm.tokens)-1
+		for _, dt := range docTokens {
+			if prefix && strings.HasPrefix(dt, qt) || fuzzyEqual(qt, dt, tm.fuzziness) {
+				matched[i] = true
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func (tm *textMatch) phrase(idx *index, doc *document, field string) bool {
+	for _, v := range values(doc.fields, field) {
+		docTokens := analyze(fmt.Sprint(v))
+		for start := 0; start+len(tm.tokens) <= len(docTokens); start++ {
+			ok := true
+			for i, qt := range tm.tokens {
+				dt := docTokens[start+i]
+				last := i == len(tm.tokens)-1
+				if last && tm.typ == "phrase_prefix" {
+					ok = strings.HasPrefix(dt, qt)
+				} else {
+					ok = dt == qt
+				}
+				if !ok {
+					break
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func count(bs []bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// analyze approximates the standard analyzer: lowercase and split on
+// anything that is not a letter or a digit.
+func analyze(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func fuzzyEqual(query, term, fuzziness string) bool {
+	if query == term {
+		return true
+	}
+	edits := 0
+	switch strings.ToUpper(fuzziness) {
+	case "", "0":
+		return false
+	case "AUTO":
+		switch n := len([]rune(query)); {
+		case n <= 2:
+			edits = 0
+		case n <= 5:
+			edits = 1
+		default:
+			edits = 2
+		}
+	default:
+		edits, _ = strconv.Atoi(fuzziness)
+	}
+	if edits == 0 {
+		return false
+	}
+	return levenshtein([]rune(query), []rune(term)) <= edits
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	m := a
+	if b < m {
+		m = b
+	}
+	if c < m {
+		m = c
+	}
+	return m
+}
+
+// values collects every value stored under a dotted field path, flattening
+// arrays along the way. A trailing ".keyword" sub-field resolves to its
+// parent, as it does with Elasticsearch's dynamic mapping.
+func values(fields map[string]interface{}, field string) []interface{} {
+	out := collect(fields, strings.Split(field, "."))
+	if len(out) == 0 && strings.HasSuffix(field, ".keyword") {
+		out = collect(fields, strings.Split(strings.TrimSuffix(field, ".keyword"), "."))
+	}
+	return out
+}
+
+func collect(v interface{}, path []string) []interface{} {
+	switch t := v.(type) {
+	case []interface{}:
+		var out []interface{}
+		for _, e := range t {
+			out = append(out, collect(e, path)...)
+		}
+		return out
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return []interface{}{t}
+		}
+		return collect(t[path[0]], path[1:])
+	case nil:
+		return nil
+	}
+	if len(path) > 0 {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// fieldType returns the mapped type of field, or "" when it is unmapped.
+func (idx *index) fieldType(field string) string {
+	props := idx.properties
+	parts := strings.Split(field, ".")
+	for i, part := range parts {
+		def, ok := props[part].(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if i == len(parts)-1 {
+			typ, _ := def["type"].(string)
+			return typ
+		}
+		if sub, ok := def["properties"].(map[string]interface{}); ok {
+			props = sub
+			continue
+		}
+		if sub, ok := def["fields"].(map[string]interface{}); ok {
+			props = sub
+			continue
+		}
+		return ""
+	}
+	return ""
+}
+
+// termMatches compares value against the exact stored values of keyword,
+// numeric and boolean fields, and against the analyzed tokens of text fields.
+func termMatches(idx *index, doc *document, field string, value interface{}) bool {
+	typ := idx.fieldType(field)
+	exact := typ != "" && typ != "text" || strings.HasSuffix(field, ".keyword")
+	for _, v := range values(doc.fields, field) {
+		s, isString := v.(string)
+		if isString && !exact {
+			for _, tok := range analyze(s) {
+				if tok == fmt.Sprint(value) {
+					return true
+				}
+			}
+			continue
+		}
+		if equalValues(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalValues(a, b interface{}) bool {
+	fa, aok := toFloat(a)
+	fb, bok := toFloat(b)
+	if aok && bok {
+		return fa == fb
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	case bool:
+		return 0, false
+	}
+	return 0, false
+}
+
+type sortSpec struct {
+	field   string
+	desc    bool
+	missing interface{}
+	mode    string
+	geo     *geoSort
+	script  *script
+}
+
+type geoSort struct {
+	lat, lon float64
+	unit     float64
+}
+
+func parseSort(raw []interface{}) ([]sortSpec, error) {
+	var specs []sortSpec
+	for _, r := range raw {
+		switch t := r.(type) {
+		case string:
+			specs = append(specs, sortSpec{field: t, desc: t == "_score"})
+		case map[string]interface{}:
+			for field, v := range t {
+				spec := sortSpec{field: field, desc: field == "_score"}
+				switch o := v.(type) {
+				case string:
+					spec.desc = o == "desc"
+				case map[string]interface{}:
+					if order, ok := o["order"].(string); ok {
+						spec.desc = order == "desc"
+					}
+					spec.missing = o["missing"]
+					if mode, ok := o["mode"].(string); ok {
+						switch mode {
+						case "min", "max", "avg", "sum", "median":
+							spec.mode = mode
+						default:
+							return nil, badRequest("Unknown SortMode [%s]", mode)
+						}
+					}
+					var err error
+					switch field {
+					case "_geo_distance":
+						spec.field, spec.geo, err = parseGeoSort(o)
+					case "_script":
+						typ, _ := o["type"].(string)
+						if typ != "number" && typ != "string" {
+							return nil, parsingError("[_script] unknown type [%s]", typ)
+						}
+						spec.script, err = compileScript(o["script"])
+					}
+					if err != nil {
+						return nil, err
+					}
+				}
+				specs = append(specs, spec)
+			}
+		default:
+			return nil, parsingError("malformed sort format")
+		}
+	}
+	return specs, nil
+}
+
+var distanceUnits = map[string]float64{
+	"m": 1, "km": 1000, "cm": 0.01, "mm": 0.001,
+	"mi": 1609.344, "yd": 0.9144, "ft": 0.3048, "in": 0.0254, "nmi": 1852,
+}
+
+func parseGeoSort(params map[string]interface{}) (string, *geoSort, error) {
+	g := &geoSort{unit: 1}
+	if unit, ok := params["unit"].(string); ok {
+		if g.unit, ok = distanceUnits[unit]; !ok {
+			return "", nil, badRequest("No distance unit match [%s]", unit)
+		}
+	}
+	for field, v := range params {
+		switch field {
+		case "order", "unit", "mode", "distance_type", "ignore_unmapped", "validation_method", "missing":
+			continue
+		}
+		if points, ok := v.([]interface{}); ok && len(points) > 0 {
+			if _, isNumber := toFloat(points[0]); !isNumber || len(points) != 2 {
+				v = points[0]
+			}
+		}
+		lat, lon, ok := geoPoint(v)
+		if !ok {
+			return "", nil, parsingError("failed to parse geo point for [%s]", field)
+		}
+		g.lat, g.lon = lat, lon
+		return field, g, nil
+	}
+	return "", nil, parsingError("[_geo_distance] requires a field and a point")
+}
+
+// geoPoint reads a point given as {"lat":..,"lon":..}, "lat,lon" or
+// [lon, lat].
+func geoPoint(v interface{}) (float64, float64, bool) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		lat, latOK := toFloat(t["lat"])
+		lon, lonOK := toFloat(t["lon"])
+		return lat, lon, latOK && lonOK
+	case string:
+		parts := strings.Split(t, ",")
+		if len(parts) != 2 {
+			return 0, 0, false
+		}
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		return lat, lon, err1 == nil && err2 == nil
+	case []interface{}:
+		if len(t) != 2 {
+			return 0, 0, false
+		}
+		lon, lonOK := toFloat(t[0])
+		lat, latOK := toFloat(t[1])
+		return lat, lon, latOK && lonOK
+	}
+	return 0, 0, false
+}
+
+// distance is the arc distance in meters between two points.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371008.7714
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+func sortValue(h *hit, spec sortSpec) (interface{}, error) {
+	switch {
+	case spec.script != nil:
+		return spec.script.run(h.doc.fields)
+	case spec.field == "_score":
+		return h.score, nil
+	case spec.field == "_doc", spec.field == "_shard_doc":
+		return float64(h.doc.seqNo), nil
+	case spec.field == "_id":
+		return h.doc.id, nil
+	}
+
+	var vals []interface{}
+	if spec.geo != nil {
+		raw := values(h.doc.fields, spec.field)
+		// A point stored as [lon, lat] is flattened by values.
+		if len(raw) == 2 {
+			if _, ok := toFloat(raw[0]); ok {
+				raw = []interface{}{raw}
+			}
+		}
+		for _, v := range raw {
+			if lat, lon, ok := geoPoint(v); ok {
+				vals = append(vals, distance(spec.geo.lat, spec.geo.lon, lat, lon)/spec.geo.unit)
+			}
+		}
+	} else {
+		for _, v := range values(h.doc.fields, spec.field) {
+			if v = normalize(v); v != nil {
+				vals = append(vals, v)
+			}
+		}
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	mode := spec.mode
+	if mode == "" {
+		mode = "min"
+		if spec.desc {
+			mode = "max"
+		}
+	}
+	switch mode {
+	case "min", "max":
+		best := vals[0]
+		for _, v := range vals[1:] {
+			if c := compareValues(v, best); c < 0 && mode == "min" || c > 0 && mode == "max" {
+				best = v
+			}
+		}
+		return best, nil
+	case "median":
+		sorted := append([]interface{}(nil), vals...)
+		sort.Slice(sorted, func(i, j int) bool { return compareValues(sorted[i], sorted[j]) < 0 })
+		mid := len(sorted) / 2
+		if len(sorted)%2 == 1 {
+			return sorted[mid], nil
+		}
+		a, _ := numeric(sorted[mid-1])
+		b, _ := numeric(sorted[mid])
+		return (a + b) / 2, nil
+	}
+	sum := 0.0
+	for _, v := range vals {
+		f, ok := numeric(v)
+		if !ok {
+			return nil, badRequest("sort mode [%s] is only supported on numeric fields", mode)
+		}
+		sum += f
+	}
+	if mode == "avg" {
+		return sum / float64(len(vals)), nil
+	}
+	return sum, nil
+}
+
+// normalize turns RFC 3339 timestamps into epoch milliseconds, the way
+// Elasticsearch reports sort values of date fields.
+func normalize(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return float64(t.UnixNano() / int64(time.Millisecond))
+		}
+	}
+	return v
+}
+
+func numeric(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareValues(a, b interface{}) int {
+	fa, aok := numeric(a)
+	fb, bok := numeric(b)
+	if aok && bok {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// searchAfter drops the sorted hits up to and including the position
+// described by after.
+func searchAfter(hits []*hit, raw []interface{}, after []interface{}) ([]*hit, error) {
+	specs, err := parseSort(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(after) != len(specs) {
+		return nil, badRequest("search_after has %d value(s) but sort has %d.", len(after), len(specs))
+	}
+	for j, h := range hits {
+		for k, spec := range specs {
+			c := compareValues(normalize(h.sort[k]), normalize(after[k]))
+			if spec.desc {
+				c = -c
+			}
+			if c > 0 {
+				return hits[j:], nil
+			}
+			if c < 0 {
+				break
+			}
+		}
+	}
+	return nil, nil
+}
+
+func sortHits(hits []*hit, raw []interface{}) error {
+	specs, err := parseSort(raw)
+	if err != nil {
+		return err
+	}
+	if len(specs) == 0 {
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].score > hits[j].score
+		})
+		return nil
+	}
+
+	for _, h := range hits {
+		h.sort = make([]interface{}, len(specs))
+		for i, spec := range specs {
+			v, err := sortValue(h, spec)
+			if err != nil {
+				return err
+			}
+			if v == nil && spec.missing != nil && spec.missing != "_first" && spec.missing != "_last" {
+				v = normalize(spec.missing)
+			}
+			h.sort[i] = v
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		for k, spec := range specs {
+			a, b := hits[i].sort[k], hits[j].sort[k]
+			if a == nil || b == nil {
+				if a == nil && b == nil {
+					continue
+				}
+				// Missing values sort last unless "_first" was requested.
+				first := spec.missing == "_first"
+				return (a == nil) == first
+			}
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != spec.desc
+		}
+		return false
+	})
+	for _, h := range hits {
+		for i, v := range h.sort {
+			if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+				h.sort[i] = int64(f)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1267 @@
+// Package esminitest provides an in-process stand-in for Elasticsearch so
+// code built on esmini can be tested without a running cluster.
+//
+// The server speaks enough of the REST API for esmini.IndexClient and
+// esmini.SearchClient: index create/delete/exists, _mapping, document
+// index/get/update/delete with source filtering, scripted updates and
+// if_seq_no or external version checks, _bulk, _mget, _refresh,
+// _update_by_query, _delete_by_query and _reindex with background tasks
+// under _tasks, ingest pipelines applied by _reindex, aliases with filters
+// and write indices, legacy templates, composable index templates built from
+// component templates, which are applied to new indices and can be
+// simulated, and _search with bool, multi_match, match, term, terms, ids,
+// exists and match_all queries, sorting, from/size paging, search_after,
+// points in time, sliced scrolls and terms, range, histogram,
+// date_histogram, nested, cardinality and stats aggregations, and
+// highlighting. Documents are kept in memory per index.
+package esminitest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	ClusterName = "esminitest"
+	NodeName    = "esminitest-node"
+	// Version is the Elasticsearch version the server reports, the first
+	// to support every API it emulates, down to the _shard_doc sort.
+	Version = "7.12.1"
+)
+
+type document struct {
+	id          string
+	source      json.RawMessage
+	fields      map[string]interface{}
+	routing     string
+	version     int64
+	seqNo       int64
+	primaryTerm int64
+}
+
+type index struct {
+	name       string
+	mappings   map[string]interface{}
+	settings   map[string]interface{}
+	docs       map[string]*document
+	order      []string
+	nextSeqNo  int64
+	properties map[string]interface{}
+	aliases    map[string]*alias
+}
+
+func newIndex(name string) *index {
+	return &index{
+		name:     name,
+		mappings: map[string]interface{}{},
+		settings: map[string]interface{}{},
+		docs:     map[string]*document{},
+		aliases:  map[string]*alias{},
+	}
+}
+
+// Server is a fake Elasticsearch node listening on a local loopback address.
+type Server struct {
+	URL string
+
+	srv       *httptest.Server
+	mu        sync.Mutex
+	indices   map[string]*index
+	templates map[string]json.RawMessage
+	failures  []*esError
+	pits      map[string][]*index
+	scrolls   map[string]*scrollContext
+	refreshes int
+	tasks     map[int64]*task
+	nextTask  int64
+	pipelines map[string]*pipeline
+
+	indexTemplates     map[string]*indexTemplate
+	componentTemplates map[string]*componentTemplate
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		indices:   map[string]*index{},
+		templates: map[string]json.RawMessage{},
+		pits:      map[string][]*index{},
+		scrolls:   map[string]*scrollContext{},
+		tasks:     map[int64]*task{},
+		pipelines: map[string]*pipeline{},
+
+		indexTemplates:     map[string]*indexTemplate{},
+		componentTemplates: map[string]*componentTemplate{},
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close shuts down the server and blocks until all outstanding requests
+// on this server have completed.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Reset drops every index and template held by the server.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.indices = map[string]*index{}
+	s.templates = map[string]json.RawMessage{}
+	s.failures = nil
+	s.pits = map[string][]*index{}
+	s.scrolls = map[string]*scrollContext{}
+	s.refreshes = 0
+	s.tasks = map[int64]*task{}
+	s.pipelines = map[string]*pipeline{}
+	s.indexTemplates = map[string]*indexTemplate{}
+	s.componentTemplates = map[string]*componentTemplate{}
+}
+
+// OpenScrolls returns the number of scroll contexts not cleared yet.
+func (s *Server) OpenScrolls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.scrolls)
+}
+
+// OpenPointsInTime returns the number of points in time not closed yet.
+func (s *Server) OpenPointsInTime() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pits)
+}
+
+// Refreshes returns how many refreshes were requested, by _refresh or by
+// writes with refresh=true or refresh=wait_for. Documents are searchable
+// right away either way.
+func (s *Server) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+// FailNextBulkItems makes the next n bulk items fail with status and error
+// type typ, e.g. 429 and "es_rejected_execution_exception", without being
+// applied.
+func (s *Server) FailNextBulkItems(n, status int, typ, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for j := 0; j < n; j++ {
+		s.failures = append(s.failures, &esError{status: status, typ: typ, reason: reason})
+	}
+}
+
+// Indices returns the names of the existing indices in sorted order.
+func (s *Server) Indices() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.indices))
+	for name := range s.indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DocCount returns the number of documents stored in index.
+func (s *Server) DocCount(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx, ok := s.indices[name]; ok {
+		return len(idx.docs)
+	}
+	return 0
+}
+
+type esError struct {
+	status int
+	typ    string
+	reason string
+	index  string
+}
+
+func (e *esError) Error() string {
+	return fmt.Sprintf("%s: %s", e.typ, e.reason)
+}
+
+func (e *esError) body() map[string]interface{} {
+	details := map[string]interface{}{
+		"type":   e.typ,
+		"reason": e.reason,
+	}
+	if e.index != "" {
+		details["index"] = e.index
+	}
+	root := map[string]interface{}{}
+	for k, v := range details {
+		root[k] = v
+	}
+	details["root_cause"] = []interface{}{root}
+	return map[string]interface{}{
+		"error":  details,
+		"status": e.status,
+	}
+}
+
+func badRequest(format string, args ...interface{}) *esError {
+	return &esError{status: http.StatusBadRequest, typ: "illegal_argument_exception", reason: fmt.Sprintf(format, args...)}
+}
+
+func parsingError(format string, args ...interface{}) *esError {
+	return &esError{status: http.StatusBadRequest, typ: "parsing_exception", reason: fmt.Sprintf(format, args...)}
+}
+
+// decodeBody decodes the JSON object at the start of a request body into v.
+// Like Elasticsearch 7, it ignores whatever follows the object, such as a
+// stray closing brace.
+func decodeBody(body []byte, v interface{}) error {
+	return json.NewDecoder(bytes.NewReader(body)).Decode(v)
+}
+
+func indexNotFound(name string) *esError {
+	return &esError{status: http.StatusNotFound, typ: "index_not_found_exception", reason: "no such index [" + name + "]", index: name}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if v != nil {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*esError); ok {
+		writeJSON(w, e.status, e.body())
+		return
+	}
+	writeJSON(w, http.StatusInternalServerError, (&esError{
+		status: http.StatusInternalServerError,
+		typ:    "exception",
+		reason: err.Error(),
+	}).body())
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var segs []string
+	for _, seg := range strings.Split(strings.Trim(r.URL.Path, "/"), "/") {
+		if seg != "" {
+			segs = append(segs, seg)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refresh, err := refreshParam(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	status, res, err := s.route(r, segs, body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if refresh {
+		s.refreshes++
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, res)
+}
+
+// refreshParam validates the refresh parameter of a write and reports
+// whether it asks for a refresh.
+func refreshParam(r *http.Request) (bool, error) {
+	q := r.URL.Query()
+	if _, ok := q["refresh"]; !ok {
+		return false, nil
+	}
+	switch v := q.Get("refresh"); v {
+	case "", "true", "wait_for":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, &esError{status: http.StatusBadRequest, typ: "illegal_argument_exception", reason: "Unknown value for refresh: [" + v + "]."}
+	}
+}
+
+func (s *Server) route(r *http.Request, segs []string, body []byte) (int, interface{}, error) {
+	m := r.Method
+	switch {
+	case len(segs) == 0 && (m == http.MethodGet || m == http.MethodHead):
+		return s.info()
+	case len(segs) == 2 && segs[0] == "_nodes":
+		return s.nodes(r)
+	case len(segs) == 1 && segs[0] == "_bulk":
+		return s.bulk(r, "", body)
+	case len(segs) == 2 && segs[1] == "_bulk":
+		return s.bulk(r, segs[0], body)
+	case len(segs) == 2 && segs[0] == "_search" && segs[1] == "scroll":
+		return s.scroll(m, body)
+	case len(segs) == 1 && segs[0] == "_search":
+		return s.search(r, "_all", body)
+	case len(segs) == 2 && segs[1] == "_search":
+		return s.search(r, segs[0], body)
+	case len(segs) == 2 && segs[1] == "_pit" && m == http.MethodPost:
+		return s.openPIT(segs[0])
+	case len(segs) == 1 && segs[0] == "_pit" && m == http.MethodDelete:
+		return s.closePIT(body)
+	case len(segs) == 1 && segs[0] == "_count":
+		return s.count("_all", body)
+	case len(segs) == 2 && segs[1] == "_count":
+		return s.count(segs[0], body)
+	case len(segs) == 1 && segs[0] == "_mget":
+		return s.mget("", r.URL.Query(), body)
+	case len(segs) == 2 && segs[1] == "_mget":
+		return s.mget(segs[0], r.URL.Query(), body)
+	case len(segs) == 1 && segs[0] == "_refresh":
+		return s.refresh("_all")
+	case len(segs) == 2 && segs[1] == "_refresh":
+		return s.refresh(segs[0])
+	case len(segs) == 2 && segs[1] == "_delete_by_query" && m == http.MethodPost:
+		return s.byQuery("delete", segs[0], r.URL.Query(), body)
+	case len(segs) == 2 && segs[1] == "_update_by_query" && m == http.MethodPost:
+		return s.byQuery("update", segs[0], r.URL.Query(), body)
+	case len(segs) == 1 && segs[0] == "_reindex" && m == http.MethodPost:
+		return s.reindex(r.URL.Query(), body)
+	case len(segs) == 3 && segs[0] == "_ingest" && segs[1] == "pipeline":
+		return s.pipelineAPI(m, segs[2], body)
+	case len(segs) == 2 && segs[0] == "_tasks" && m == http.MethodGet:
+		return s.getTask(segs[1], r.URL.Query())
+	case len(segs) == 3 && segs[0] == "_tasks" && segs[2] == "_cancel" && m == http.MethodPost:
+		return s.cancelTask(segs[1])
+	case len(segs) == 3 && segs[2] == "_rethrottle" && m == http.MethodPost:
+		return s.rethrottle(segs[1], r.URL.Query())
+	case len(segs) == 1 && segs[0] == "_aliases" && m == http.MethodPost:
+		return s.updateAliases(body)
+	case len(segs) == 1 && segs[0] == "_alias" && (m == http.MethodGet || m == http.MethodHead):
+		return s.aliasAPI(m, "", "", body)
+	case len(segs) == 2 && segs[0] == "_alias" && (m == http.MethodGet || m == http.MethodHead):
+		return s.aliasAPI(m, "", segs[1], body)
+	case len(segs) == 2 && segs[1] == "_alias" && (m == http.MethodGet || m == http.MethodHead):
+		return s.aliasAPI(m, segs[0], "", body)
+	case len(segs) == 3 && (segs[1] == "_alias" || segs[1] == "_aliases"):
+		return s.aliasAPI(m, segs[0], segs[2], body)
+	case len(segs) == 1 && segs[0] == "_index_template" && (m == http.MethodGet || m == http.MethodHead):
+		return s.indexTemplateAPI(m, "", r.URL.Query(), body)
+	case len(segs) == 3 && segs[0] == "_index_template" && segs[1] == "_simulate_index" && m == http.MethodPost:
+		return s.simulateIndex(segs[2])
+	case len(segs) == 2 && segs[0] == "_index_template" && segs[1] == "_simulate" && m == http.MethodPost:
+		return s.simulateTemplate("", body)
+	case len(segs) == 3 && segs[0] == "_index_template" && segs[1] == "_simulate" && m == http.MethodPost:
+		return s.simulateTemplate(segs[2], body)
+	case len(segs) == 2 && segs[0] == "_index_template":
+		return s.indexTemplateAPI(m, segs[1], r.URL.Query(), body)
+	case len(segs) == 1 && segs[0] == "_component_template" && (m == http.MethodGet || m == http.MethodHead):
+		return s.componentTemplateAPI(m, "", r.URL.Query(), body)
+	case len(segs) == 2 && segs[0] == "_component_template":
+		return s.componentTemplateAPI(m, segs[1], r.URL.Query(), body)
+	case len(segs) == 2 && segs[0] == "_template":
+		return s.template(m, segs[1], body)
+	case len(segs) == 1 && !strings.HasPrefix(segs[0], "_"):
+		return s.indexAPI(m, segs[0], body)
+	case len(segs) >= 2 && segs[1] == "_mapping":
+		return s.mapping(m, segs[0], body)
+	case len(segs) == 2 && segs[1] == "_doc" && m == http.MethodPost:
+		return s.indexDoc(segs[0], "", r.URL.Query(), false, body)
+	case len(segs) == 3 && segs[1] == "_doc":
+		switch m {
+		case http.MethodPut, http.MethodPost:
+			return s.indexDoc(segs[0], segs[2], r.URL.Query(), r.URL.Query().Get("op_type") == "create", body)
+		case http.MethodGet, http.MethodHead:
+			return s.getDoc(segs[0], segs[2], r.URL.Query())
+		case http.MethodDelete:
+			return s.deleteDoc(segs[0], segs[2], r.URL.Query())
+		}
+	case len(segs) == 3 && segs[1] == "_create" && (m == http.MethodPut || m == http.MethodPost):
+		return s.indexDoc(segs[0], segs[2], r.URL.Query(), true, body)
+	case len(segs) == 3 && segs[1] == "_update" && m == http.MethodPost:
+		return s.updateDoc(segs[0], segs[2], r.URL.Query(), body)
+	}
+	return 0, nil, badRequest("no handler found for uri [%s] and method [%s]", r.URL.Path, m)
+}
+
+func (s *Server) info() (int, interface{}, error) {
+	return http.StatusOK, map[string]interface{}{
+		"name":         NodeName,
+		"cluster_name": ClusterName,
+		"version": map[string]interface{}{
+			"number":         Version,
+			"lucene_version": "8.2.0",
+		},
+		"tagline": "You Know, for Search",
+	}, nil
+}
+
+func (s *Server) nodes(r *http.Request) (int, interface{}, error) {
+	return http.StatusOK, map[string]interface{}{
+		"cluster_name": ClusterName,
+		"nodes": map[string]interface{}{
+			NodeName: map[string]interface{}{
+				"name":    NodeName,
+				"version": Version,
+				"roles":   []string{"master", "data", "ingest"},
+				"http": map[string]interface{}{
+					"publish_address": r.Host,
+				},
+			},
+		},
+	}, nil
+}
+
+func (s *Server) resolve(expr string) ([]*index, error) {
+	var out []*index
+	seen := map[string]bool{}
+	for _, name := range strings.Split(expr, ",") {
+		if name == "_all" || strings.ContainsAny(name, "*?") {
+			pattern := name
+			if pattern == "_all" {
+				pattern = "*"
+			}
+			var names []string
+			for n := range s.indices {
+				if ok, _ := path.Match(pattern, n); ok && !seen[n] {
+					names = append(names, n)
+				}
+			}
+			sort.Strings(names)
+			for _, n := range names {
+				seen[n] = true
+				out = append(out, s.indices[n])
+			}
+			continue
+		}
+		idx, ok := s.indices[name]
+		if !ok {
+			aliased := s.aliased(name)
+			if len(aliased) == 0 {
+				return nil, indexNotFound(name)
+			}
+			for _, idx := range aliased {
+				if !seen[idx.name] {
+					seen[idx.name] = true
+					out = append(out, idx)
+				}
+			}
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, idx)
+		}
+	}
+	return out, nil
+}
+
+func (s *Server) indexAPI(method, name string, body []byte) (int, interface{}, error) {
+	switch method {
+	case http.MethodHead, http.MethodGet:
+		idx, ok := s.indices[name]
+		if !ok {
+			return 0, nil, indexNotFound(name)
+		}
+		return http.StatusOK, map[string]interface{}{
+			name: map[string]interface{}{
+				"aliases":  idx.aliases,
+				"mappings": idx.mappings,
+				"settings": map[string]interface{}{"index": idx.settings},
+			},
+		}, nil
+	case http.MethodPut:
+		if _, ok := s.indices[name]; ok {
+			return 0, nil, &esError{
+				status: http.StatusBadRequest,
+				typ:    "resource_already_exists_exception",
+				reason: "index [" + name + "] already exists",
+				index:  name,
+			}
+		}
+		if len(s.aliased(name)) > 0 {
+			return 0, nil, &esError{
+				status: http.StatusBadRequest,
+				typ:    "invalid_index_name_exception",
+				reason: "Invalid index name [" + name + "], already exists as alias",
+				index:  name,
+			}
+		}
+		idx := s.newTemplatedIndex(name)
+		if len(bytes.TrimSpace(body)) > 0 {
+			var def struct {
+				Settings map[string]interface{} `json:"settings"`
+				Mappings map[string]interface{} `json:"mappings"`
+				Aliases  map[string]*alias      `json:"aliases"`
+			}
+			if err := decodeBody(body, &def); err != nil {
+				return 0, nil, parsingError("failed to parse index definition: %v", err)
+			}
+			if def.Settings != nil {
+				idx.settings = merge(idx.settings, normalizeSettings(def.Settings))
+			}
+			if def.Mappings != nil {
+				idx.mappings = merge(idx.mappings, def.Mappings)
+				idx.properties, _ = idx.mappings["properties"].(map[string]interface{})
+			}
+			for aliasName, a := range def.Aliases {
+				if a == nil {
+					a = &alias{}
+				}
+				idx.aliases[aliasName] = a
+			}
+		}
+		s.indices[name] = idx
+		return http.StatusOK, map[string]interface{}{
+			"acknowledged":        true,
+			"shards_acknowledged": true,
+			"index":               name,
+		}, nil
+	case http.MethodDelete:
+		if _, ok := s.indices[name]; !ok && len(s.aliased(name)) > 0 {
+			return 0, nil, badRequest("The provided expression [%s] matches an alias, specify the corresponding concrete indices instead.", name)
+		}
+		indices, err := s.resolve(name)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, idx := range indices {
+			delete(s.indices, idx.name)
+		}
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+	return 0, nil, badRequest("no handler found for uri [/%s] and method [%s]", name, method)
+}
+
+func (s *Server) mapping(method, expr string, body []byte) (int, interface{}, error) {
+	indices, err := s.resolve(expr)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch method {
+	case http.MethodGet:
+		res := map[string]interface{}{}
+		for _, idx := range indices {
+			res[idx.name] = map[string]interface{}{"mappings": idx.mappings}
+		}
+		return http.StatusOK, res, nil
+	case http.MethodPut, http.MethodPost:
+		var def map[string]interface{}
+		if err := json.Unmarshal(body, &def); err != nil {
+			return 0, nil, parsingError("failed to parse mapping: %v", err)
+		}
+		for _, idx := range indices {
+			idx.mappings = merge(idx.mappings, deepCopy(def).(map[string]interface{}))
+			idx.properties, _ = idx.mappings["properties"].(map[string]interface{})
+		}
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+	return 0, nil, badRequest("no handler found for uri [/%s/_mapping] and method [%s]", expr, method)
+}
+
+func (s *Server) template(method, name string, body []byte) (int, interface{}, error) {
+	switch method {
+	case http.MethodPut, http.MethodPost:
+		if !json.Valid(body) {
+			return 0, nil, parsingError("failed to parse template [%s]", name)
+		}
+		s.templates[name] = json.RawMessage(body)
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	case http.MethodGet, http.MethodHead:
+		tmpl, ok := s.templates[name]
+		if !ok {
+			return http.StatusNotFound, map[string]interface{}{}, nil
+		}
+		return http.StatusOK, map[string]interface{}{name: tmpl}, nil
+	case http.MethodDelete:
+		if _, ok := s.templates[name]; !ok {
+			return 0, nil, &esError{
+				status: http.StatusNotFound,
+				typ:    "index_template_missing_exception",
+				reason: "index_template [" + name + "] missing",
+			}
+		}
+		delete(s.templates, name)
+		return http.StatusOK, map[string]interface{}{"acknowledged": true}, nil
+	}
+	return 0, nil, badRequest("no handler found for uri [/_template/%s] and method [%s]", name, method)
+}
+
+func (s *Server) refresh(expr string) (int, interface{}, error) {
+	if _, err := s.resolve(expr); err != nil {
+		return 0, nil, err
+	}
+	s.refreshes++
+	return http.StatusOK, map[string]interface{}{
+		"_shards": shards(),
+	}, nil
+}
+
+func shards() map[string]interface{} {
+	return map[string]interface{}{"total": 1, "successful": 1, "failed": 0}
+}
+
+func (idx *index) snapshot() *index {
+	c := *idx
+	c.docs = make(map[string]*document, len(idx.docs))
+	for id, doc := range idx.docs {
+		d := *doc
+		c.docs[id] = &d
+	}
+	c.order = append([]string(nil), idx.order...)
+	return &c
+}
+
+func (s *Server) openPIT(expr string) (int, interface{}, error) {
+	indices, err := s.resolve(expr)
+	if err != nil {
+		return 0, nil, err
+	}
+	snapshot := make([]*index, len(indices))
+	for j, idx := range indices {
+		snapshot[j] = idx.snapshot()
+	}
+	id := newID()
+	s.pits[id] = snapshot
+	return http.StatusOK, map[string]interface{}{"id": id}, nil
+}
+
+func (s *Server) closePIT(body []byte) (int, interface{}, error) {
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return 0, nil, parsingError("failed to parse point in time: %v", err)
+	}
+	if _, ok := s.pits[req.ID]; !ok {
+		return http.StatusNotFound, map[string]interface{}{"succeeded": true, "num_freed": 0}, nil
+	}
+	delete(s.pits, req.ID)
+	return http.StatusOK, map[string]interface{}{"succeeded": true, "num_freed": 1}, nil
+}
+
+func newID() string {
+	b := make([]byte, 15)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Server) autoCreate(name string) *index {
+	idx, ok := s.indices[name]
+	if !ok {
+		idx = s.newTemplatedIndex(name)
+		s.indices[name] = idx
+	}
+	return idx
+}
+
+func decodeSource(body []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, &esError{
+			status: http.StatusBadRequest,
+			typ:    "mapper_parsing_exception",
+			reason: "failed to parse: " + err.Error(),
+		}
+	}
+	if fields == nil {
+		return nil, &esError{
+			status: http.StatusBadRequest,
+			typ:    "mapper_parsing_exception",
+			reason: "failed to parse: document is empty",
+		}
+	}
+	return fields, nil
+}
+
+func (idx *index) put(id string, source []byte, fields map[string]interface{}) (*document, string) {
+	doc, ok := idx.docs[id]
+	result := "updated"
+	if !ok {
+		doc = &document{id: id, primaryTerm: 1}
+		idx.docs[id] = doc
+		idx.order = append(idx.order, id)
+		result = "created"
+	}
+	doc.source = json.RawMessage(append([]byte(nil), source...))
+	doc.fields = fields
+	doc.version++
+	doc.seqNo = idx.nextSeqNo
+	idx.nextSeqNo++
+	return doc, result
+}
+
+func (idx *index) remove(id string) (*document, bool) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return nil, false
+	}
+	delete(idx.docs, id)
+	for i, v := range idx.order {
+		if v == id {
+			idx.order = append(idx.order[:i], idx.order[i+1:]...)
+			break
+		}
+	}
+	doc.version++
+	doc.seqNo = idx.nextSeqNo
+	idx.nextSeqNo++
+	return doc, true
+}
+
+func writeResult(idx *index, doc *document, result string) map[string]interface{} {
+	return map[string]interface{}{
+		"_index":        idx.name,
+		"_type":         "_doc",
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"result":        result,
+		"_shards":       shards(),
+		"_seq_no":       doc.seqNo,
+		"_primary_term": doc.primaryTerm,
+	}
+}
+
+func statusFor(result string) int {
+	switch result {
+	case "created":
+		return http.StatusCreated
+	case "not_found":
+		return http.StatusNotFound
+	}
+	return http.StatusOK
+}
+
+func versionConflict(idx *index, id, reason string) *esError {
+	return &esError{
+		status: http.StatusConflict,
+		typ:    "version_conflict_engine_exception",
+		reason: "[" + id + "]: version conflict, " + reason,
+		index:  idx.name,
+	}
+}
+
+func (s *Server) indexDoc(name, id string, q url.Values, create bool, body []byte) (int, interface{}, error) {
+	fields, err := decodeSource(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	wc, err := writeControlParams(q)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := wc.validate(false); err != nil {
+		return 0, nil, err
+	}
+	if name, err = s.writeTarget(name); err != nil {
+		return 0, nil, err
+	}
+	idx := s.autoCreate(name)
+	if id == "" {
+		id = newID()
+	}
+	existing, exists := idx.docs[id]
+	if exists && create {
+		return 0, nil, versionConflict(idx, id, "document already exists")
+	}
+	if err := wc.check(idx, id, existing); err != nil {
+		return 0, nil, err
+	}
+	doc, result := idx.put(id, body, fields)
+	doc.routing = q.Get("routing")
+	wc.stamp(doc)
+	res := writeResult(idx, doc, result)
+	return statusFor(result), res, nil
+}
+
+func (s *Server) getDoc(name, id string, q url.Values) (int, interface{}, error) {
+	name, err := s.writeTarget(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	idx, ok := s.indices[name]
+	if !ok {
+		return 0, nil, indexNotFound(name)
+	}
+	doc, ok := idx.docs[id]
+	if !ok {
+		return http.StatusNotFound, map[string]interface{}{
+			"_index": name,
+			"_type":  "_doc",
+			"_id":    id,
+			"found":  false,
+		}, nil
+	}
+	return http.StatusOK, getResult(idx, doc, sourceParams(q)), nil
+}
+
+func getResult(idx *index, doc *document, fetch *fetchSpec) map[string]interface{} {
+	res := map[string]interface{}{
+		"_index":        idx.name,
+		"_type":         "_doc",
+		"_id":           doc.id,
+		"_version":      doc.version,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": doc.primaryTerm,
+		"found":         true,
+	}
+	fetch.apply(res, idx, doc)
+	if doc.routing != "" {
+		res["_routing"] = doc.routing
+	}
+	return res
+}
+
+func (s *Server) deleteDoc(name, id string, q url.Values) (int, interface{}, error) {
+	wc, err := writeControlParams(q)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := wc.validate(false); err != nil {
+		return 0, nil, err
+	}
+	if name, err = s.writeTarget(name); err != nil {
+		return 0, nil, err
+	}
+	idx, ok := s.indices[name]
+	if !ok {
+		return 0, nil, indexNotFound(name)
+	}
+	if err := wc.check(idx, id, idx.docs[id]); err != nil {
+		return 0, nil, err
+	}
+	doc, ok := idx.remove(id)
+	if !ok {
+		doc = &document{id: id, primaryTerm: 1, seqNo: idx.nextSeqNo}
+		wc.stamp(doc)
+		return http.StatusNotFound, writeResult(idx, doc, "not_found"), nil
+	}
+	wc.stamp(doc)
+	return http.StatusOK, writeResult(idx, doc, "deleted"), nil
+}
+
+type updateBody struct {
+	Doc            map[string]interface{} `json:"doc"`
+	DocAsUpsert    bool                   `json:"doc_as_upsert"`
+	Upsert         map[string]interface{} `json:"upsert"`
+	ScriptedUpsert bool                   `json:"scripted_upsert"`
+	Script         interface{}            `json:"script"`
+	DetectNoop     *bool                  `json:"detect_noop"`
+	Source         interface{}            `json:"_source"`
+}
+
+func (s *Server) updateDoc(name, id string, q url.Values, body []byte) (int, interface{}, error) {
+	var u updateBody
+	if err := decodeBody(body, &u); err != nil {
+		return 0, nil, parsingError("failed to parse update request: %v", err)
+	}
+	wc, err := writeControlParams(q)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := wc.validate(true); err != nil {
+		return 0, nil, err
+	}
+	if name, err = s.writeTarget(name); err != nil {
+		return 0, nil, err
+	}
+	idx := s.autoCreate(name)
+	if err := wc.check(idx, id, idx.docs[id]); err != nil {
+		return 0, nil, err
+	}
+	doc, result, err := idx.update(id, &u)
+	if err != nil {
+		return 0, nil, err
+	}
+	res := writeResult(idx, doc, result)
+
+	// The updated source comes back under "get" when asked for.
+	fetch := sourceParams(q)
+	if _, ok := q["_source"]; !ok {
+		fetch.source = false
+	}
+	if err := fetch.parseSource(u.Source); err != nil {
+		return 0, nil, err
+	}
+	if fetch.source && result != "deleted" {
+		res["get"] = getResult(idx, doc, fetch)
+	}
+	return statusFor(result), res, nil
+}
+
+func (idx *index) update(id string, u *updateBody) (*document, string, error) {
+	if u.Script != nil && u.Doc != nil {
+		return nil, "", badRequest("Validation Failed: 1: can't provide both script and doc;")
+	}
+	var sc *script
+	if u.Script != nil {
+		var err error
+		if sc, err = compileUpdateScript(u.Script); err != nil {
+			return nil, "", err
+		}
+	}
+
+	doc, ok := idx.docs[id]
+	if !ok {
+		var fields map[string]interface{}
+		switch {
+		case u.Upsert != nil:
+			fields = u.Upsert
+		case u.DocAsUpsert && u.Doc != nil:
+			fields = u.Doc
+		default:
+			return nil, "", &esError{
+				status: http.StatusNotFound,
+				typ:    "document_missing_exception",
+				reason: "[_doc][" + id + "]: document missing",
+				index:  idx.name,
+			}
+		}
+		if sc != nil && u.ScriptedUpsert {
+			return idx.runUpdateScript(id, nil, deepCopy(fields).(map[string]interface{}), sc, "create")
+		}
+		source, err := json.Marshal(fields)
+		if err != nil {
+			return nil, "", err
+		}
+		doc, result := idx.put(id, source, fields)
+		return doc, result, nil
+	}
+	if sc != nil {
+		return idx.runUpdateScript(id, doc, deepCopy(doc.fields).(map[string]interface{}), sc, "index")
+	}
+	if u.Doc == nil {
+		return nil, "", badRequest("Validation Failed: 1: script or doc is missing;")
+	}
+
+	merged := merge(deepCopy(doc.fields).(map[string]interface{}), u.Doc)
+	source, err := json.Marshal(merged)
+	if err != nil {
+		return nil, "", err
+	}
+	var before, after interface{}
+	_ = json.Unmarshal(doc.source, &before)
+	_ = json.Unmarshal(source, &after)
+	if (u.DetectNoop == nil || *u.DetectNoop) && jsonEqual(before, after) {
+		return doc, "noop", nil
+	}
+	doc, _ = idx.put(id, source, merged)
+	return doc, "updated", nil
+}
+
+// runUpdateScript runs sc on fields, the source of doc or of an upsert when
+// doc is nil, and applies the operation the script leaves in ctx.op.
+func (idx *index) runUpdateScript(id string, doc *document, fields map[string]interface{}, sc *script, op string) (*document, string, error) {
+	ctx := map[string]interface{}{"_source": fields, "op": op}
+	if err := sc.update(ctx); err != nil {
+		return nil, "", err
+	}
+	switch ctx["op"] {
+	case "noop", "none":
+		if doc == nil {
+			doc = &document{id: id, primaryTerm: 1, seqNo: idx.nextSeqNo}
+		}
+		return doc, "noop", nil
+	case "delete":
+		if doc == nil {
+			return &document{id: id, primaryTerm: 1, seqNo: idx.nextSeqNo}, "noop", nil
+		}
+		doc, _ = idx.remove(id)
+		return doc, "deleted", nil
+	case "index", "create":
+	default:
+		return nil, "", badRequest("Operation type [%v] not allowed, only [noop, index, delete] are allowed", ctx["op"])
+	}
+	source, err := json.Marshal(fields)
+	if err != nil {
+		return nil, "", err
+	}
+	fields, err = decodeSource(source)
+	if err != nil {
+		return nil, "", err
+	}
+	updated, result := idx.put(id, source, fields)
+	return updated, result, nil
+}
+
+func merge(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		sv, srcIsMap := v.(map[string]interface{})
+		dv, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			dst[k] = merge(dv, sv)
+		} else {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, e := range t {
+			a[i] = deepCopy(e)
+		}
+		return a
+	}
+	return v
+}
+
+func jsonEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
+
+type bulkMeta struct {
+	Index           string `json:"_index"`
+	ID              string `json:"_id"`
+	Routing         string `json:"routing"`
+	Pipeline        string `json:"pipeline"`
+	RetryOnConflict int    `json:"retry_on_conflict"`
+	writeControl
+}
+
+func (s *Server) bulk(r *http.Request, defaultIndex string, body []byte) (int, interface{}, error) {
+	reader := bufio.NewReader(bytes.NewReader(body))
+	readLine := func() ([]byte, error) {
+		for {
+			line, err := reader.ReadBytes('\n')
+			line = bytes.TrimSpace(line)
+			if len(line) > 0 {
+				return line, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var items []interface{}
+	hasErrors := false
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		var action map[string]bulkMeta
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return 0, nil, badRequest("Malformed action/metadata line [%d]", len(items)+1)
+		}
+		for op, meta := range action {
+			if meta.Index == "" {
+				meta.Index = defaultIndex
+			}
+			if meta.Index == "" {
+				return 0, nil, badRequest("Validation Failed: 1: index is missing;")
+			}
+			var source []byte
+			if op != "delete" {
+				if source, err = readLine(); err != nil {
+					return 0, nil, badRequest("Validation Failed: 1: source is missing for [%s];", op)
+				}
+			}
+			var item map[string]interface{}
+			if len(s.failures) > 0 {
+				err = s.failures[0]
+				s.failures = s.failures[1:]
+			} else {
+				item, err = s.bulkItem(op, meta, source)
+			}
+			if err != nil {
+				e, ok := err.(*esError)
+				if !ok {
+					return 0, nil, err
+				}
+				hasErrors = true
+				item = map[string]interface{}{
+					"_index": meta.Index,
+					"_type":  "_doc",
+					"_id":    meta.ID,
+					"status": e.status,
+					"error":  e.body()["error"],
+				}
+			}
+			items = append(items, map[string]interface{}{op: item})
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"took":   1,
+		"errors": hasErrors,
+		"items":  items,
+	}, nil
+}
+
+func (s *Server) bulkItem(op string, meta bulkMeta, source []byte) (map[string]interface{}, error) {
+	var err error
+	if meta.Index, err = s.writeTarget(meta.Index); err != nil {
+		return nil, err
+	}
+	switch op {
+	case "index", "create":
+		fields, err := decodeSource(source)
+		if err != nil {
+			return nil, err
+		}
+		if err := meta.validate(false); err != nil {
+			return nil, err
+		}
+		idx := s.autoCreate(meta.Index)
+		id := meta.ID
+		if id == "" {
+			id = newID()
+		}
+		existing, exists := idx.docs[id]
+		if exists && op == "create" {
+			return nil, versionConflict(idx, id, "document already exists")
+		}
+		if err := meta.check(idx, id, existing); err != nil {
+			return nil, err
+		}
+		doc, result := idx.put(id, source, fields)
+		doc.routing = meta.Routing
+		meta.stamp(doc)
+		res := writeResult(idx, doc, result)
+		res["status"] = statusFor(result)
+		return res, nil
+	case "update":
+		var u updateBody
+		if err := json.Unmarshal(source, &u); err != nil {
+			return nil, parsingError("failed to parse update request: %v", err)
+		}
+		if err := meta.validate(true); err != nil {
+			return nil, err
+		}
+		idx := s.autoCreate(meta.Index)
+		if err := meta.check(idx, meta.ID, idx.docs[meta.ID]); err != nil {
+			return nil, err
+		}
+		doc, result, err := idx.update(meta.ID, &u)
+		if err != nil {
+			return nil, err
+		}
+		if meta.Routing != "" {
+			doc.routing = meta.Routing
+		}
+		res := writeResult(idx, doc, result)
+		res["status"] = statusFor(result)
+		return res, nil
+	case "delete":
+		if err := meta.validate(false); err != nil {
+			return nil, err
+		}
+		idx, ok := s.indices[meta.Index]
+		if !ok {
+			return nil, indexNotFound(meta.Index)
+		}
+		if err := meta.check(idx, meta.ID, idx.docs[meta.ID]); err != nil {
+			return nil, err
+		}
+		doc, ok := idx.remove(meta.ID)
+		result := "deleted"
+		if !ok {
+			doc = &document{id: meta.ID, primaryTerm: 1, seqNo: idx.nextSeqNo}
+			result = "not_found"
+		}
+		meta.stamp(doc)
+		res := writeResult(idx, doc, result)
+		res["status"] = statusFor(result)
+		return res, nil
+	}
+	return nil, badRequest("Malformed action/metadata line, expected one of [create, delete, index, update] but found [%s]", op)
+}
+
+type mgetDoc struct {
+	Index  string      `json:"_index"`
+	ID     string      `json:"_id"`
+	Source interface{} `json:"_source"`
+}
+
+func (s *Server) mget(defaultIndex string, q url.Values, body []byte) (int, interface{}, error) {
+	var req struct {
+		Docs []mgetDoc `json:"docs"`
+		IDs  []string  `json:"ids"`
+	}
+	if err := decodeBody(body, &req); err != nil {
+		return 0, nil, parsingError("failed to parse mget request: %v", err)
+	}
+	for _, id := range req.IDs {
+		req.Docs = append(req.Docs, mgetDoc{Index: defaultIndex, ID: id})
+	}
+
+	docs := make([]interface{}, 0, len(req.Docs))
+	for _, d := range req.Docs {
+		name := d.Index
+		if name == "" {
+			name = defaultIndex
+		}
+		if target, err := s.writeTarget(name); err == nil {
+			name = target
+		}
+		idx, ok := s.indices[name]
+		if !ok {
+			docs = append(docs, map[string]interface{}{
+				"_index": name,
+				"_type":  "_doc",
+				"_id":    d.ID,
+				"error":  indexNotFound(name).body()["error"],
+			})
+			continue
+		}
+		doc, ok := idx.docs[d.ID]
+		if !ok {
+			docs = append(docs, map[string]interface{}{
+				"_index": name,
+				"_type":  "_doc",
+				"_id":    d.ID,
+				"found":  false,
+			})
+			continue
+		}
+		fetch := sourceParams(q)
+		if err := fetch.parseSource(d.Source); err != nil {
+			return 0, nil, err
+		}
+		docs = append(docs, getResult(idx, doc, fetch))
+	}
+	return http.StatusOK, map[string]interface{}{"docs": docs}, nil
+}
@@ -0,0 +1,265 @@
+package esminitest
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kazu1029/esmini"
+	"github.com/olivere/elastic/v7"
+)
+
+type tweet struct {
+	ID       int       `json:"id"`
+	Message  string    `json:"message"`
+	Retweets int       `json:"retweets"`
+	Created  time.Time `json:"created,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Category string    `json:"category,omitempty"`
+}
+
+var tweets = []tweet{
+	{ID: 1, Message: "message1", Retweets: 2, Created: time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC), Tags: []string{"tag1", "tag2"}, Category: "Category1"},
+	{ID: 2, Message: "message2", Retweets: 5, Created: time.Date(2019, 10, 10, 10, 0, 0, 0, time.UTC), Tags: []string{"tag3", "tag4"}, Category: "Category2"},
+	{ID: 3, Message: "message3", Retweets: 2, Created: time.Date(2018, 11, 11, 11, 0, 0, 0, time.UTC), Tags: []string{"tag5", "tag6"}, Category: "Category3"},
+}
+
+const mapping = `
+{
+  "mappings":{
+    "properties":{
+      "message":{"type":"text"},
+      "created":{"type":"date"},
+      "tags":{"type":"text"},
+      "category":{"type":"keyword"}
+    }
+  }
+}`
+
+func setup(t *testing.T) (*Server, *esmini.IndexClient) {
+	srv := NewServer()
+	client, err := esmini.New(elastic.SetURL(srv.URL))
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
+func TestPing(t *testing.T) {
+	srv, client := setup(t)
+	defer srv.Close()
+	defer client.Stop()
+
+	info, code, err := client.Ping(context.TODO(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 200 {
+		t.Fatalf("expected %v, but got %v\n", 200, code)
+	}
+	if info.Version.Number != Version {
+		t.Fatalf("expected %v, but got %v\n", Version, info.Version.Number)
+	}
+}
+
+func TestIndexLifecycle(t *testing.T) {
+	srv, client := setup(t)
+	defer srv.Close()
+	defer client.Stop()
+
+	ctx := context.TODO()
+	if _, err := client.CreateIndexWithMapping(ctx, "tweets", mapping); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateIndex(ctx, "tweets"); err == nil {
+		t.Fatal("expected error creating an existing index, but got nil")
+	}
+	// Elasticsearch 7 ignores what follows the index definition.
+	if _, err := client.CreateIndexWithMapping(ctx, "trailing", mapping+"\n}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateIndexWithMapping(ctx, "invalid", "{"); err == nil {
+		t.Fatal("expected error creating an index with an invalid definition, but got nil")
+	}
+	if _, err := client.CreateTemplate(ctx, "tweet-template", `{"index_patterns":["tweet*"]}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteIndex(ctx, "tweets"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteIndex(ctx, "trailing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteIndex(ctx, "tweets"); !elastic.IsNotFound(err) {
+		t.Fatalf("expected not found error, but got %v\n", err)
+	}
+	if len(srv.Indices()) != 0 {
+		t.Fatalf("expected no indices, but got %v\n", srv.Indices())
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	srv, client := setup(t)
+	defer srv.Close()
+	defer client.Stop()
+
+	ctx := context.TODO()
+	index := "tweets"
+	docs := list.New()
+	for _, tw := range tweets {
+		docs.PushBack(tw)
+	}
+	res, err := client.BulkInsert(ctx, index, docs, esmini.DocID("ID"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Errors {
+		t.Fatalf("expected no bulk errors, but got %v\n", res.Failed())
+	}
+	if len(res.Indexed()) != len(tweets) {
+		t.Fatalf("expected %v, but got %v\n", len(tweets), len(res.Indexed()))
+	}
+	if srv.DocCount(index) != len(tweets) {
+		t.Fatalf("expected %v, but got %v\n", len(tweets), srv.DocCount(index))
+	}
+
+	upd, err := client.Update(ctx, index, "1", map[string]interface{}{"message": "message30", "retweets": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upd.Version != 2 {
+		t.Fatalf("expected %v, but got %v\n", 2, upd.Version)
+	}
+
+	var tw tweet
+	if err := json.Unmarshal(srv.indices[index].docs["1"].source, &tw); err != nil {
+		t.Fatal(err)
+	}
+	if tw.Message != "message30" {
+		t.Fatalf("expected %v, but got %v\n", "message30", tw.Message)
+	}
+	if tw.Retweets != 3 {
+		t.Fatalf("expected %v, but got %v\n", 3, tw.Retweets)
+	}
+	if !tw.Created.Equal(tweets[0].Created) {
+		t.Fatalf("expected %v, but got %v\n", tweets[0].Created, tw.Created)
+	}
+
+	if _, err := client.Delete(ctx, index, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Delete(ctx, index, "1"); !elastic.IsNotFound(err) {
+		t.Fatalf("expected not found error, but got %v\n", err)
+	}
+	if srv.DocCount(index) != len(tweets)-1 {
+		t.Fatalf("expected %v, but got %v\n", len(tweets)-1, srv.DocCount(index))
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tweet1, tweet2, tweet3 := tweets[0], tweets[1], tweets[2]
+	testCases := []struct {
+		name   string
+		query  string
+		fields []string
+		tweets []tweet
+		opt    []esmini.SearchOption
+	}{
+		{
+			"simple", "message", []string{"message"}, []tweet{tweet1, tweet2, tweet3}, nil,
+		},
+		{
+			"with multiple query and multiple fields", "message1 tag6", []string{"message", "tags"}, []tweet{tweet1, tweet3}, []esmini.SearchOption{esmini.MatchType("most_fields"), esmini.Fuzziness("0")},
+		},
+		{
+			"with no match query", "messa", []string{"message"}, []tweet{}, nil,
+		},
+		{
+			"with Limit and From options", "message", []string{"message"}, []tweet{tweet2, tweet3}, []esmini.SearchOption{esmini.Limit(2), esmini.From(1)},
+		},
+		{
+			"with SortField option", "message", []string{"message"}, []tweet{tweet1, tweet3, tweet2}, []esmini.SearchOption{esmini.SortField("created")},
+		},
+		{
+			"with SortField and Order options", "message", []string{"message"}, []tweet{tweet2, tweet3, tweet1}, []esmini.SearchOption{esmini.SortField("created"), esmini.Order(esmini.Desc)},
+		},
+		{
+			"with should BoolQueries", "", []string{"message"}, []tweet{tweet1, tweet2},
+			[]esmini.SearchOption{
+				esmini.BoolQueriesWithClause(
+					[]esmini.BoolQueriesWithClauseOption{
+						{Target: "category", Query: "Category1", Clause: "should"},
+						{Target: "category", Query: []interface{}{"Category1", "Category2"}, Clause: "should"},
+					},
+				),
+			},
+		},
+		{
+			"with must_not BoolQueries", "", []string{"message"}, []tweet{tweet2},
+			[]esmini.SearchOption{
+				esmini.BoolQueriesWithClause(
+					[]esmini.BoolQueriesWithClauseOption{
+						{Target: "category", Query: "Category1", Clause: "must_not"},
+						{Target: "retweets", Query: 2, Clause: "must_not"},
+					},
+				),
+			},
+		},
+		{
+			"with query and multiple boolQueries", "message", []string{"message"}, []tweet{tweet1},
+			[]esmini.SearchOption{
+				esmini.BoolQueriesWithClause(
+					[]esmini.BoolQueriesWithClauseOption{
+						{Target: "category", Query: []interface{}{"Category1", "Category2"}, Clause: "filter"},
+						{Target: "retweets", Query: 2, Clause: "filter"},
+					},
+				),
+			},
+		},
+	}
+
+	srv, client := setup(t)
+	defer srv.Close()
+	defer client.Stop()
+
+	ctx := context.TODO()
+	index := "tweets"
+	if _, err := client.CreateIndexWithMapping(ctx, index, mapping); err != nil {
+		t.Fatal(err)
+	}
+	docs := list.New()
+	for _, tw := range tweets {
+		docs.PushBack(tw)
+	}
+	if _, err := client.BulkInsert(ctx, index, docs); err != nil {
+		t.Fatal(err)
+	}
+
+	sClient := esmini.NewSearchClient(client)
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := sClient.Search(ctx, index, tt.query, tt.fields, tt.opt...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.tweets) != int(res.Hits) {
+				t.Fatalf("expected %v, but got %v\n", len(tt.tweets), int(res.Hits))
+			}
+
+			itr := res.NewHitSourceIterator()
+			for itr.HasNext() {
+				j := itr.Index()
+				var tw tweet
+				if err := itr.Next(&tw); err != nil {
+					t.Fatal(err)
+				}
+				if tt.tweets[j].Message != tw.Message {
+					t.Fatalf("expected %v, but got %v\n", tt.tweets[j].Message, tw.Message)
+				}
+			}
+		})
+	}
+}
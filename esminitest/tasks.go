@@ -0,0 +1,372 @@
+package esminitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// task is a by-query or reindex request. Its documents are picked when it
+// starts and written one batch at a time: all at once for a synchronous
+// request, or one batch per GET _tasks/<id> with wait_for_completion=false
+// so that callers polling a task see it progress.
+type task struct {
+	id        int64
+	action    string
+	items     []taskItem
+	pos       int
+	batchSize int
+	proceed   bool
+	rps       float64
+	process   func(it taskItem) (string, error)
+	counts    map[string]int64
+	failures  []interface{}
+	canceled  bool
+	aborted   bool
+	started   time.Time
+}
+
+// taskItem is a document as it was when its task started.
+type taskItem struct {
+	idx *index
+	doc document
+}
+
+// current returns the document it was picked as, or a version conflict if
+// it changed since.
+func (it taskItem) current() (*document, error) {
+	doc, ok := it.idx.docs[it.doc.id]
+	if !ok || doc.seqNo != it.doc.seqNo {
+		return nil, versionConflict(it.idx, it.doc.id, "document changed since the task started")
+	}
+	return doc, nil
+}
+
+// taskParams holds the URL parameters shared by _update_by_query,
+// _delete_by_query and _reindex.
+type taskParams struct {
+	wait      bool
+	batchSize int
+	proceed   bool
+	rps       float64
+}
+
+func parseTaskParams(q url.Values, conflicts string) (taskParams, error) {
+	p := taskParams{wait: true, batchSize: 1000, rps: -1}
+	if v := q.Get("wait_for_completion"); v != "" {
+		p.wait = v != "false"
+	}
+	if v := q.Get("scroll_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return p, badRequest("Failed to parse [scroll_size] value [%s]", v)
+		}
+		p.batchSize = n
+	}
+	if v := q.Get("slices"); v != "" && v != "auto" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			return p, badRequest("[slices] must be at least 1, was [%s]", v)
+		}
+	}
+	var err error
+	if p.rps, err = parseRequestsPerSecond(q.Get("requests_per_second")); err != nil {
+		return p, err
+	}
+	if v := q.Get("conflicts"); v != "" {
+		conflicts = v
+	}
+	switch conflicts {
+	case "", "abort":
+	case "proceed":
+		p.proceed = true
+	default:
+		return p, badRequest("conflicts may only be \"proceed\" or \"abort\" but was [%s]", conflicts)
+	}
+	return p, nil
+}
+
+func parseRequestsPerSecond(v string) (float64, error) {
+	if v == "" || v == "-1" {
+		return -1, nil
+	}
+	rps, err := strconv.ParseFloat(v, 64)
+	if err != nil || rps <= 0 {
+		return 0, badRequest("[requests_per_second] must be a float greater than 0. Use -1 to disable throttling.")
+	}
+	return rps, nil
+}
+
+func (s *Server) startTask(action string, hits []*hit, p taskParams, process func(it taskItem) (string, error)) (int, interface{}, error) {
+	t := &task{
+		action:    action,
+		batchSize: p.batchSize,
+		proceed:   p.proceed,
+		rps:       p.rps,
+		process:   process,
+		counts:    map[string]int64{},
+		started:   time.Now(),
+	}
+	for _, h := range hits {
+		t.items = append(t.items, taskItem{idx: h.idx, doc: *h.doc})
+	}
+
+	if p.wait {
+		for !t.step() {
+		}
+		status := http.StatusOK
+		if t.aborted {
+			status = http.StatusConflict
+		}
+		return status, t.response(), nil
+	}
+
+	s.nextTask++
+	t.id = s.nextTask
+	s.tasks[t.id] = t
+	return http.StatusOK, map[string]interface{}{"task": fmt.Sprintf("%s:%d", NodeName, t.id)}, nil
+}
+
+// step writes the next batch and reports whether the task is done.
+func (t *task) step() bool {
+	if t.done() {
+		return true
+	}
+	end := t.pos + t.batchSize
+	if end > len(t.items) {
+		end = len(t.items)
+	}
+	for _, it := range t.items[t.pos:end] {
+		t.pos++
+		result, err := t.process(it)
+		if err != nil {
+			e, ok := err.(*esError)
+			if !ok {
+				e = &esError{status: http.StatusInternalServerError, typ: "exception", reason: err.Error()}
+			}
+			if e.status == http.StatusConflict {
+				t.counts["version_conflicts"]++
+				if t.proceed {
+					continue
+				}
+			}
+			t.fail(it, e)
+			break
+		}
+		if result == "noop" {
+			result = "noops"
+		}
+		t.counts[result]++
+	}
+	t.counts["batches"]++
+	return t.done()
+}
+
+// fail aborts the task, recording e as the failure of it.
+func (t *task) fail(it taskItem, e *esError) {
+	cause := map[string]interface{}{"type": e.typ, "reason": e.reason, "index": it.idx.name}
+	t.failures = append(t.failures, map[string]interface{}{
+		"index":  it.idx.name,
+		"type":   "_doc",
+		"id":     it.doc.id,
+		"cause":  cause,
+		"status": e.status,
+	})
+	t.aborted = true
+}
+
+func (t *task) done() bool {
+	return t.canceled || t.aborted || t.pos >= len(t.items)
+}
+
+func (t *task) status() map[string]interface{} {
+	status := map[string]interface{}{
+		"total":                  len(t.items),
+		"updated":                t.counts["updated"],
+		"created":                t.counts["created"],
+		"deleted":                t.counts["deleted"],
+		"batches":                t.counts["batches"],
+		"version_conflicts":      t.counts["version_conflicts"],
+		"noops":                  t.counts["noops"],
+		"retries":                map[string]interface{}{"bulk": 0, "search": 0},
+		"throttled_millis":       0,
+		"requests_per_second":    t.rps,
+		"throttled_until_millis": 0,
+	}
+	if t.canceled {
+		status["canceled"] = "by user request"
+	}
+	return status
+}
+
+func (t *task) response() map[string]interface{} {
+	res := t.status()
+	res["took"] = time.Since(t.started).Milliseconds()
+	res["timed_out"] = false
+	failures := t.failures
+	if failures == nil {
+		failures = []interface{}{}
+	}
+	res["failures"] = failures
+	return res
+}
+
+func (t *task) info() map[string]interface{} {
+	return map[string]interface{}{
+		"node":                  NodeName,
+		"id":                    t.id,
+		"type":                  "transport",
+		"action":                t.action,
+		"status":                t.status(),
+		"description":           t.action,
+		"start_time_in_millis":  t.started.UnixNano() / int64(time.Millisecond),
+		"running_time_in_nanos": time.Since(t.started).Nanoseconds(),
+		"cancellable":           true,
+		"headers":               map[string]interface{}{},
+	}
+}
+
+func (s *Server) lookupTask(taskID string) (*task, error) {
+	notFound := &esError{status: http.StatusNotFound, typ: "resource_not_found_exception", reason: "task [" + taskID + "] isn't running and hasn't stored its results"}
+	i := strings.LastIndex(taskID, ":")
+	if i < 0 || taskID[:i] != NodeName {
+		return nil, notFound
+	}
+	id, err := strconv.ParseInt(taskID[i+1:], 10, 64)
+	if err != nil {
+		return nil, badRequest("malformed task id %s", taskID)
+	}
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, notFound
+	}
+	return t, nil
+}
+
+// getTask advances the task by one batch, or to its end with
+// wait_for_completion=true, and reports it.
+func (s *Server) getTask(taskID string, q url.Values) (int, interface{}, error) {
+	t, err := s.lookupTask(taskID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if q.Get("wait_for_completion") == "true" {
+		for !t.step() {
+		}
+	} else {
+		t.step()
+	}
+	res := map[string]interface{}{
+		"completed": t.done(),
+		"task":      t.info(),
+	}
+	if t.done() {
+		res["response"] = t.response()
+	}
+	return http.StatusOK, res, nil
+}
+
+func (s *Server) taskList(tasks ...*task) map[string]interface{} {
+	infos := map[string]interface{}{}
+	for _, t := range tasks {
+		infos[fmt.Sprintf("%s:%d", NodeName, t.id)] = t.info()
+	}
+	if len(infos) == 0 {
+		return map[string]interface{}{"nodes": map[string]interface{}{}}
+	}
+	return map[string]interface{}{
+		"nodes": map[string]interface{}{
+			NodeName: map[string]interface{}{"name": NodeName, "tasks": infos},
+		},
+	}
+}
+
+func (s *Server) cancelTask(taskID string) (int, interface{}, error) {
+	t, err := s.lookupTask(taskID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if t.done() {
+		return http.StatusOK, s.taskList(), nil
+	}
+	t.canceled = true
+	return http.StatusOK, s.taskList(t), nil
+}
+
+func (s *Server) rethrottle(taskID string, q url.Values) (int, interface{}, error) {
+	v := q.Get("requests_per_second")
+	if v == "" {
+		return 0, nil, badRequest("requests_per_second is a required parameter")
+	}
+	rps, err := parseRequestsPerSecond(v)
+	if err != nil {
+		return 0, nil, err
+	}
+	t, err := s.lookupTask(taskID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if t.done() {
+		return http.StatusOK, s.taskList(), nil
+	}
+	t.rps = rps
+	return http.StatusOK, s.taskList(t), nil
+}
+
+type byQueryBody struct {
+	Query     map[string]interface{} `json:"query"`
+	Script    interface{}            `json:"script"`
+	Conflicts string                 `json:"conflicts"`
+}
+
+func (s *Server) byQuery(op, expr string, q url.Values, body []byte) (int, interface{}, error) {
+	var req byQueryBody
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return 0, nil, parsingError("failed to parse %s request: %v", op, err)
+		}
+	}
+	if op == "delete" && req.Query == nil {
+		return 0, nil, badRequest("Validation Failed: 1: query is missing;")
+	}
+	p, err := parseTaskParams(q, req.Conflicts)
+	if err != nil {
+		return 0, nil, err
+	}
+	hits, err := s.query(expr, req.Query)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if op == "delete" {
+		return s.startTask("indices:data/write/delete/byquery", hits, p, func(it taskItem) (string, error) {
+			if _, err := it.current(); err != nil {
+				return "", err
+			}
+			it.idx.remove(it.doc.id)
+			return "deleted", nil
+		})
+	}
+
+	var sc *script
+	if req.Script != nil {
+		if sc, err = compileUpdateScript(req.Script); err != nil {
+			return 0, nil, err
+		}
+	}
+	return s.startTask("indices:data/write/update/byquery", hits, p, func(it taskItem) (string, error) {
+		doc, err := it.current()
+		if err != nil {
+			return "", err
+		}
+		if sc == nil {
+			it.idx.put(doc.id, doc.source, doc.fields)
+			return "updated", nil
+		}
+		_, result, err := it.idx.runUpdateScript(doc.id, doc, deepCopy(doc.fields).(map[string]interface{}), sc, "index")
+		return result, err
+	})
+}
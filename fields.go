@@ -0,0 +1,40 @@
+package esmini
+
+// SourceIncludes limits the _source of each hit to the given fields, which
+// may use wildcards such as "user.*".
+func SourceIncludes(fields ...string) SearchOption {
+	return func(s *searchOption) {
+		s.sourceIncludes = append(s.sourceIncludes, fields...)
+	}
+}
+
+// SourceExcludes drops the given fields from the _source of each hit.
+func SourceExcludes(fields ...string) SearchOption {
+	return func(s *searchOption) {
+		s.sourceExcludes = append(s.sourceExcludes, fields...)
+	}
+}
+
+// NoSource stops Elasticsearch from returning the _source of hits. Read
+// DocValueFields and StoredFields from HitMeta.Fields instead.
+func NoSource() SearchOption {
+	return func(s *searchOption) {
+		s.noSource = true
+	}
+}
+
+// DocValueFields returns the doc values of the given fields per hit, in
+// HitMeta.Fields. Text fields have no doc values.
+func DocValueFields(fields ...string) SearchOption {
+	return func(s *searchOption) {
+		s.docValueFields = append(s.docValueFields, fields...)
+	}
+}
+
+// StoredFields returns the given fields mapped with "store": true per hit,
+// in HitMeta.Fields.
+func StoredFields(fields ...string) SearchOption {
+	return func(s *searchOption) {
+		s.storedFields = append(s.storedFields, fields...)
+	}
+}
@@ -0,0 +1,197 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// ErrNotFound is matched by errors.Is when Get or MultiGet asked for
+// documents that do not exist. A missing index is reported as a regular
+// error instead.
+var ErrNotFound = errors.New("esmini: document not found")
+
+// NotFoundError lists the IDs Get or MultiGet could not find in Index.
+type NotFoundError struct {
+	Index string
+	IDs   []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("esmini: %d documents not found in %s: %s", len(e.IDs), e.Index, strings.Join(e.IDs, ", "))
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// isDocumentMissing tells a missing document, a 404 without error details or
+// a document_missing_exception, from a missing index.
+func isDocumentMissing(err error) bool {
+	e, ok := err.(*elastic.Error)
+	if !ok || e.Status != 404 {
+		return false
+	}
+	return e.Details == nil || e.Details.Type == "document_missing_exception"
+}
+
+type getOption struct {
+	routing  string
+	realtime *bool
+	includes []string
+	excludes []string
+	noSource bool
+}
+
+type GetOption func(*getOption)
+
+func GetRouting(routing string) GetOption {
+	return func(g *getOption) {
+		g.routing = routing
+	}
+}
+
+// Realtime set to false reads documents as of the last refresh instead of
+// the latest version.
+func Realtime(realtime bool) GetOption {
+	return func(g *getOption) {
+		g.realtime = &realtime
+	}
+}
+
+func GetSourceIncludes(fields ...string) GetOption {
+	return func(g *getOption) {
+		g.includes = append(g.includes, fields...)
+	}
+}
+
+func GetSourceExcludes(fields ...string) GetOption {
+	return func(g *getOption) {
+		g.excludes = append(g.excludes, fields...)
+	}
+}
+
+// GetNoSource fetches only the metadata of documents.
+func GetNoSource() GetOption {
+	return func(g *getOption) {
+		g.noSource = true
+	}
+}
+
+func (g *getOption) fetchSource() *elastic.FetchSourceContext {
+	if g.noSource {
+		return elastic.NewFetchSourceContext(false)
+	}
+	if len(g.includes) == 0 && len(g.excludes) == 0 {
+		return nil
+	}
+	return elastic.NewFetchSourceContext(true).Include(g.includes...).Exclude(g.excludes...)
+}
+
+// Get fetches the document id of index and decodes its source into v, unless
+// v is nil. A missing document returns a *NotFoundError.
+func (i *IndexClient) Get(ctx context.Context, index, id string, v interface{}, opts ...GetOption) (*elastic.GetResult, error) {
+	getOpt := &getOption{}
+	for _, opt := range opts {
+		opt(getOpt)
+	}
+
+	svc := i.raw.Get().Index(index).Id(id)
+	if len(getOpt.routing) > 0 {
+		svc = svc.Routing(getOpt.routing)
+	}
+	if getOpt.realtime != nil {
+		svc = svc.Realtime(*getOpt.realtime)
+	}
+	if fsc := getOpt.fetchSource(); fsc != nil {
+		svc = svc.FetchSourceContext(fsc)
+	}
+
+	res, err := svc.Do(ctx)
+	if err != nil {
+		if isDocumentMissing(err) {
+			return nil, &NotFoundError{Index: index, IDs: []string{id}}
+		}
+		return nil, err
+	}
+	if !res.Found {
+		return res, &NotFoundError{Index: index, IDs: []string{id}}
+	}
+	if v != nil && len(res.Source) > 0 {
+		if err := json.Unmarshal(res.Source, v); err != nil {
+			return res, fmt.Errorf("esmini: decode document %s: %w", id, err)
+		}
+	}
+	return res, nil
+}
+
+// MultiGet fetches the documents ids of index in one request. When v is a
+// pointer to a slice, the sources of the documents found are decoded and
+// appended to it in the order of ids. The results hold one entry per id.
+//
+// Missing documents do not stop the others from being decoded: MultiGet
+// then returns the results along with a *NotFoundError listing them.
+func (i *IndexClient) MultiGet(ctx context.Context, index string, ids []string, v interface{}, opts ...GetOption) ([]*elastic.GetResult, error) {
+	getOpt := &getOption{}
+	for _, opt := range opts {
+		opt(getOpt)
+	}
+
+	var slice reflect.Value
+	if v != nil {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+			return nil, fmt.Errorf("esmini: MultiGet needs a pointer to a slice, got %T", v)
+		}
+		slice = rv.Elem()
+	}
+
+	svc := i.raw.MultiGet()
+	if getOpt.realtime != nil {
+		svc = svc.Realtime(*getOpt.realtime)
+	}
+	fsc := getOpt.fetchSource()
+	for _, id := range ids {
+		item := elastic.NewMultiGetItem().Index(index).Id(id)
+		if len(getOpt.routing) > 0 {
+			item = item.Routing(getOpt.routing)
+		}
+		if fsc != nil {
+			item = item.FetchSource(fsc)
+		}
+		svc = svc.Add(item)
+	}
+
+	res, err := svc.Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, doc := range res.Docs {
+		if doc.Error != nil {
+			return res.Docs, fmt.Errorf("esmini: get %s/%s: %s: %s", doc.Index, doc.Id, doc.Error.Type, doc.Error.Reason)
+		}
+		if !doc.Found {
+			missing = append(missing, doc.Id)
+			continue
+		}
+		if !slice.IsValid() || len(doc.Source) == 0 {
+			continue
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if err := json.Unmarshal(doc.Source, elem.Interface()); err != nil {
+			return res.Docs, fmt.Errorf("esmini: decode document %s: %w", doc.Id, err)
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	if len(missing) > 0 {
+		return res.Docs, &NotFoundError{Index: index, IDs: missing}
+	}
+	return res.Docs, nil
+}
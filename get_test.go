@@ -0,0 +1,79 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	index := "products"
+	_, client := setupFake(t, index, products()...)
+
+	var p product
+	res, err := client.Get(context.TODO(), index, "2", &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "blue shirt" || p.Price != 25 || res.Id != "2" {
+		t.Fatalf("expected %v, but got %v (%v)\n", "blue shirt", p, res.Id)
+	}
+
+	var partial product
+	if _, err := client.Get(context.TODO(), index, "1", &partial, GetSourceIncludes("name"), Realtime(false)); err != nil {
+		t.Fatal(err)
+	}
+	if partial.Name != "red shirt" || partial.Price != 0 || partial.Reviews != nil {
+		t.Fatalf("expected only the name, but got %v\n", partial)
+	}
+
+	res, err = client.Get(context.TODO(), index, "1", nil, GetNoSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Found || len(res.Source) != 0 {
+		t.Fatalf("expected no source, but got %s\n", res.Source)
+	}
+
+	_, err = client.Get(context.TODO(), index, "9", &p)
+	var notFound *NotFoundError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &notFound) || !reflect.DeepEqual(notFound.IDs, []string{"9"}) {
+		t.Fatalf("expected %v, but got %v\n", ErrNotFound, err)
+	}
+
+	if _, err := client.Get(context.TODO(), "missing", "1", &p); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected an index error, but got %v\n", err)
+	}
+}
+
+func TestMultiGet(t *testing.T) {
+	index := "products"
+	_, client := setupFake(t, index, products()...)
+
+	var products []product
+	res, err := client.MultiGet(context.TODO(), index, []string{"3", "1"}, &products, GetSourceExcludes("reviews"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || len(products) != 2 {
+		t.Fatalf("expected %v documents, but got %v\n", 2, products)
+	}
+	if products[0].Name != "red shoes" || products[1].Name != "red shirt" || products[1].Reviews != nil {
+		t.Fatalf("expected red shoes and red shirt without reviews, but got %v\n", products)
+	}
+
+	var ptrs []*product
+	res, err = client.MultiGet(context.TODO(), index, []string{"1", "8", "2", "9"}, &ptrs)
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || !reflect.DeepEqual(notFound.IDs, []string{"8", "9"}) {
+		t.Fatalf("expected %v, but got %v\n", []string{"8", "9"}, err)
+	}
+	if len(res) != 4 || len(ptrs) != 2 || ptrs[1].Name != "blue shirt" {
+		t.Fatalf("expected %v documents, but got %v\n", 2, ptrs)
+	}
+
+	if _, err := client.MultiGet(context.TODO(), index, []string{"1"}, products); err == nil {
+		t.Fatal("expected an error for a non-pointer destination")
+	}
+}
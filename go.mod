@@ -1,8 +1,10 @@
 module github.com/kazu1029/esmini
 
-go 1.13
+go 1.18
+
+require github.com/olivere/elastic/v7 v7.0.9
 
 require (
 	github.com/mailru/easyjson v0.7.0 // indirect
-	github.com/olivere/elastic/v7 v7.0.9
+	github.com/pkg/errors v0.8.1 // indirect
 )
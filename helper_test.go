@@ -0,0 +1,38 @@
+package esmini
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kazu1029/esmini/esminitest"
+	"github.com/olivere/elastic/v7"
+)
+
+// setupFake starts an esminitest server and a client connected to it, both
+// stopped when the test ends. With docs, it creates index with the mapping
+// generated from the first doc and indexes them all, using their esmini
+// tags.
+func setupFake(t *testing.T, index string, docs ...interface{}) (*esminitest.Server, *IndexClient) {
+	t.Helper()
+	srv := esminitest.NewServer()
+	client, err := New(elastic.SetURL(srv.URL))
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Stop()
+		srv.Close()
+	})
+	if len(docs) == 0 {
+		return srv, client
+	}
+
+	if _, err := client.CreateIndexFor(context.TODO(), index, docs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BulkInsertSlice(context.TODO(), client, index, docs); err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
@@ -0,0 +1,58 @@
+package esmini
+
+import (
+	"github.com/olivere/elastic/v7"
+)
+
+// HighlightOption configures the Highlight SearchOption. Zero values keep
+// Elasticsearch's defaults.
+type HighlightOption struct {
+	Fields       []string
+	FragmentSize int
+	// NumberOfFragments is the maximum number of fragments per field. Set
+	// WholeField to highlight the whole value as a single fragment instead.
+	NumberOfFragments int
+	WholeField        bool
+	PreTags           []string
+	PostTags          []string
+	Type              string // Type can be "unified", "plain" or "fvh"
+	// RequireFieldMatch only highlights fields the query searched. It is
+	// true unless set otherwise.
+	RequireFieldMatch *bool
+}
+
+// Highlight requests highlighted fragments of the given fields. They are
+// returned per hit in HitMeta.Highlight, keyed by field name.
+func Highlight(opt HighlightOption) SearchOption {
+	return func(s *searchOption) {
+		s.highlight = &opt
+	}
+}
+
+func (opt *HighlightOption) build() *elastic.Highlight {
+	hl := elastic.NewHighlight()
+	for _, field := range opt.Fields {
+		hl = hl.Field(field)
+	}
+	if opt.FragmentSize > 0 {
+		hl = hl.FragmentSize(opt.FragmentSize)
+	}
+	if opt.WholeField {
+		hl = hl.NumOfFragments(0)
+	} else if opt.NumberOfFragments > 0 {
+		hl = hl.NumOfFragments(opt.NumberOfFragments)
+	}
+	if len(opt.PreTags) > 0 {
+		hl = hl.PreTags(opt.PreTags...)
+	}
+	if len(opt.PostTags) > 0 {
+		hl = hl.PostTags(opt.PostTags...)
+	}
+	if len(opt.Type) > 0 {
+		hl = hl.HighlighterType(opt.Type)
+	}
+	if opt.RequireFieldMatch != nil {
+		hl = hl.RequireFieldMatch(*opt.RequireFieldMatch)
+	}
+	return hl
+}
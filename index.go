@@ -3,14 +3,15 @@ package esmini
 import (
 	"container/list"
 	"context"
-	"reflect"
-	"strconv"
+	"errors"
+	"time"
 
 	"github.com/olivere/elastic/v7"
 )
 
 type IndexClient struct {
-	raw *elastic.Client
+	raw     *elastic.Client
+	refresh RefreshPolicy
 }
 
 func New(options ...elastic.ClientOptionFunc) (*IndexClient, error) {
@@ -32,6 +33,9 @@ func (i *IndexClient) CreateIndexWithMapping(ctx context.Context, index, mapping
 		Do(ctx)
 }
 
+// CreateTemplate creates the legacy index template tempName from its JSON
+// body. Legacy templates are deprecated since Elasticsearch 7.8 and lose to
+// composable templates matching the same index; prefer PutIndexTemplate.
 func (i *IndexClient) CreateTemplate(ctx context.Context, tempName, template string) (*elastic.IndicesPutTemplateResponse, error) {
 	return i.raw.IndexPutTemplate(tempName).
 		BodyString(template).
@@ -39,8 +43,16 @@ func (i *IndexClient) CreateTemplate(ctx context.Context, tempName, template str
 }
 
 type bulkOption struct {
-	pipeline string
-	docID    string
+	pipeline      string
+	docID         string
+	workers       int
+	flushDocs     int
+	flushBytes    int
+	flushInterval time.Duration
+	queueSize     int
+	onFlush       func(BulkFlushStats)
+	retryBackoff  elastic.Backoff
+	refresh       RefreshPolicy
 }
 
 type BulkOption func(*bulkOption)
@@ -57,66 +69,214 @@ func DocID(docID string) BulkOption {
 	}
 }
 
+// RetryBackoff retries items rejected with 429 or 503 using exponential
+// backoff between initial and max. Other failures are never retried. A
+// BulkIndexer retries by default, between 200ms and 10s, and also uses the
+// backoff for failed bulk requests.
+func RetryBackoff(initial, max time.Duration) BulkOption {
+	return func(b *bulkOption) {
+		b.retryBackoff = elastic.NewExponentialBackoff(initial, max)
+	}
+}
+
+func newBulkIndexRequest(index string, doc interface{}, bulkOpt *bulkOption) (*elastic.BulkIndexRequest, error) {
+	meta, err := readDocMeta(doc, bulkOpt.docID)
+	if err != nil {
+		return nil, err
+	}
+
+	req := elastic.NewBulkIndexRequest().Index(index).Doc(doc)
+	if meta.hasID {
+		req = req.Id(meta.id)
+	}
+	if len(meta.routing) > 0 {
+		req = req.Routing(meta.routing)
+	} else if len(meta.parent) > 0 {
+		// Join field children must live on their parent's shard.
+		req = req.Routing(meta.parent)
+	}
+	if meta.hasVersion {
+		req = req.Version(meta.version).VersionType("external")
+	}
+	return req, nil
+}
+
+// BulkInsert indexes docs in one bulk request. BulkInsertSlice,
+// BulkInsertChan and BulkInsertNDJSON take typed or streamed input instead.
 func (i *IndexClient) BulkInsert(ctx context.Context, index string, docs *list.List, opts ...BulkOption) (*elastic.BulkResponse, error) {
 	bulkOpt := &bulkOption{}
 	for _, opt := range opts {
 		opt(bulkOpt)
 	}
 
-	bulk := i.raw.Bulk().
-		Index(index).
-		Pipeline(bulkOpt.pipeline)
-
+	var reqs []elastic.BulkableRequest
 	for d := docs.Front(); d != nil; d = d.Next() {
-		if len(bulkOpt.docID) > 0 {
-			var docID string
-			v := reflect.Indirect(reflect.ValueOf(d.Value))
-			t := v.Type()
-			for j := 0; j < t.NumField(); j++ {
-				if t.Field(j).Name == bulkOpt.docID {
-					if value, ok := v.Field(j).Interface().(int); ok {
-						docID = strconv.Itoa(value)
-					} else if value, ok := v.Field(j).Interface().(uint64); ok {
-						docID = strconv.FormatUint(value, 10)
-					} else {
-						docID = v.Field(j).String()
-					}
-					break
+		req, err := newBulkIndexRequest(index, d.Value, bulkOpt)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+
+	return i.bulk(ctx, index, reqs, bulkOpt)
+}
+
+// bulk sends reqs and, when a retry backoff is set, resends only the items
+// rejected with a retryable status until they succeed or the backoff gives
+// up. The returned response holds one item per request, in request order.
+func (i *IndexClient) bulk(ctx context.Context, index string, reqs []elastic.BulkableRequest, bulkOpt *bulkOption) (*elastic.BulkResponse, error) {
+	result := &elastic.BulkResponse{
+		Items: make([]map[string]*elastic.BulkResponseItem, len(reqs)),
+	}
+	pending := make([]int, len(reqs))
+	for j := range reqs {
+		pending[j] = j
+	}
+
+	for retry := 0; ; retry++ {
+		bulk := i.raw.Bulk().
+			Index(index).
+			Pipeline(bulkOpt.pipeline)
+		if refresh := i.refreshPolicy(bulkOpt.refresh, ""); len(refresh) > 0 {
+			bulk = bulk.Refresh(refresh)
+		}
+		for _, pos := range pending {
+			bulk = bulk.Add(reqs[pos])
+		}
+
+		res, err := bulk.Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.Took += res.Took
+
+		var retryable []int
+		for j, item := range res.Items {
+			pos := pending[j]
+			result.Items[pos] = item
+			if bulkOpt.retryBackoff == nil {
+				continue
+			}
+			for _, r := range item {
+				if isRetryableStatus(r.Status) {
+					retryable = append(retryable, pos)
 				}
 			}
-			bulk = bulk.Add(elastic.NewBulkIndexRequest().Index(index).Id(docID).Doc(d.Value))
-		} else {
-			bulk = bulk.Add(elastic.NewBulkIndexRequest().Index(index).Doc(d.Value))
 		}
+		if len(retryable) == 0 {
+			break
+		}
+
+		wait, ok := bulkOpt.retryBackoff.Next(retry)
+		if !ok {
+			break
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		pending = retryable
 	}
 
-	res, err := bulk.Do(ctx)
-	if err != nil {
-		return nil, err
+	bulkErr := &BulkError{}
+	for pos, item := range result.Items {
+		for _, r := range item {
+			if r.Status >= 200 && r.Status <= 299 {
+				continue
+			}
+			result.Errors = true
+			e := BulkItemError{
+				Position: pos,
+				DocID:    r.Id,
+				Status:   r.Status,
+			}
+			if r.Error != nil {
+				e.Type = r.Error.Type
+				e.Reason = r.Error.Reason
+			}
+			bulkErr.Items = append(bulkErr.Items, e)
+		}
 	}
+	if len(bulkErr.Items) > 0 {
+		return result, bulkErr
+	}
+
+	return result, nil
+}
 
-	return res, nil
+// IndexDoc indexes doc, replacing any document with the same ID. The ID,
+// routing and version are read from doc's struct tags, see TagName;
+// documents without an ID get one generated. Conflicts with IfSeqNo or
+// ExternalVersion return a *ConflictError.
+func (i *IndexClient) IndexDoc(ctx context.Context, index string, doc interface{}, opts ...WriteOption) (*elastic.IndexResponse, error) {
+	return i.indexDoc(ctx, index, "", doc, newWriteOption(opts))
 }
 
-func (i *IndexClient) Update(ctx context.Context, index string, id string, doc map[string]interface{}) (*elastic.UpdateResponse, error) {
-	return i.raw.Update().
+// indexDoc indexes doc under id, or the ID read from its tags when id is
+// empty.
+func (i *IndexClient) indexDoc(ctx context.Context, index, id string, doc interface{}, wOpt *writeOption) (*elastic.IndexResponse, error) {
+	meta, err := readDocMeta(doc, "")
+	if err != nil && (len(id) == 0 || !errors.Is(err, ErrZeroDocID)) {
+		return nil, err
+	}
+	if len(id) == 0 && meta.hasID {
+		id = meta.id
+	}
+
+	svc := i.raw.Index().
 		Index(index).
-		Id(id).
-		Doc(doc).
-		Refresh("true").
-		Do(ctx)
+		BodyJson(doc).
+		Refresh(i.refreshPolicy(wOpt.refresh, RefreshTrue))
+	if len(id) > 0 {
+		svc = svc.Id(id)
+	}
+	switch {
+	case len(wOpt.routing) > 0:
+		svc = svc.Routing(wOpt.routing)
+	case len(meta.routing) > 0:
+		svc = svc.Routing(meta.routing)
+	case len(meta.parent) > 0:
+		svc = svc.Routing(meta.parent)
+	}
+	// Elasticsearch rejects versions together with sequence numbers, so
+	// IfSeqNo takes precedence over a version tag.
+	switch {
+	case wOpt.version != nil:
+		svc = svc.Version(*wOpt.version).VersionType("external")
+	case meta.hasVersion && wOpt.ifSeqNo == nil:
+		svc = svc.Version(meta.version).VersionType("external")
+	}
+	if wOpt.ifSeqNo != nil {
+		svc = svc.IfSeqNo(*wOpt.ifSeqNo).IfPrimaryTerm(*wOpt.ifPrimaryTerm)
+	}
+	res, err := svc.Do(ctx)
+	return res, asConflict(index, id, err)
 }
 
 func (i *IndexClient) DeleteIndex(ctx context.Context, index string) (*elastic.IndicesDeleteResponse, error) {
 	return i.raw.DeleteIndex(index).Do(ctx)
 }
 
-func (i *IndexClient) Delete(ctx context.Context, index, id string) (*elastic.DeleteResponse, error) {
-	return i.raw.Delete().
+// Delete removes the document id. With IfSeqNo or ExternalVersion,
+// conflicting writes return a *ConflictError.
+func (i *IndexClient) Delete(ctx context.Context, index, id string, opts ...WriteOption) (*elastic.DeleteResponse, error) {
+	wOpt := newWriteOption(opts)
+	svc := i.raw.Delete().
 		Index(index).
 		Id(id).
-		Refresh("true").
-		Do(ctx)
+		Refresh(i.refreshPolicy(wOpt.refresh, RefreshTrue))
+	if len(wOpt.routing) > 0 {
+		svc = svc.Routing(wOpt.routing)
+	}
+	if wOpt.version != nil {
+		svc = svc.Version(*wOpt.version).VersionType("external")
+	}
+	if wOpt.ifSeqNo != nil {
+		svc = svc.IfSeqNo(*wOpt.ifSeqNo).IfPrimaryTerm(*wOpt.ifPrimaryTerm)
+	}
+	res, err := svc.Do(ctx)
+	return res, asConflict(index, id, err)
 }
 
 func (i *IndexClient) Ping(ctx context.Context, host string) (*elastic.PingResult, int, error) {
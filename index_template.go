@@ -0,0 +1,369 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// IndexTemplate is a composable index template: the settings, mappings and
+// aliases given to new indices whose names match its patterns, built from
+// component templates and its own Template. Build it like:
+//
+//	esmini.NewIndexTemplate("logs-*").
+//		ComposedOf("logs-mappings", "logs-settings").
+//		Priority(100).
+//		Template(esmini.NewTemplate().Settings(esmini.NewSettings().Replicas(0)))
+//
+// When several templates match an index name, the one with the highest
+// priority is used alone. Composable templates need Elasticsearch 7.8 or
+// later and take precedence over templates created with CreateTemplate.
+type IndexTemplate struct {
+	patterns   []string
+	composedOf []string
+	priority   *int64
+	version    *int64
+	dataStream bool
+	template   *Template
+	meta       map[string]interface{}
+}
+
+// NewIndexTemplate returns a template for indices whose names match one of
+// patterns, which may contain wildcards.
+func NewIndexTemplate(patterns ...string) *IndexTemplate {
+	return &IndexTemplate{patterns: patterns}
+}
+
+// ComposedOf builds the template from the component templates of those
+// names, merged in order, before its own Template.
+func (t *IndexTemplate) ComposedOf(names ...string) *IndexTemplate {
+	t.composedOf = names
+	return t
+}
+
+// Priority decides between templates matching the same index name. Two
+// templates with the same priority may not have overlapping patterns.
+func (t *IndexTemplate) Priority(priority int64) *IndexTemplate {
+	t.priority = &priority
+	return t
+}
+
+// Version sets a version number for managing the template externally.
+func (t *IndexTemplate) Version(version int64) *IndexTemplate {
+	t.version = &version
+	return t
+}
+
+// DataStream makes matching names create data streams instead of indices.
+func (t *IndexTemplate) DataStream() *IndexTemplate {
+	t.dataStream = true
+	return t
+}
+
+// Template sets the settings, mappings and aliases applied after those of
+// the component templates.
+func (t *IndexTemplate) Template(template *Template) *IndexTemplate {
+	t.template = template
+	return t
+}
+
+// Meta attaches user metadata to the template.
+func (t *IndexTemplate) Meta(meta map[string]interface{}) *IndexTemplate {
+	t.meta = meta
+	return t
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *IndexTemplate) MarshalJSON() ([]byte, error) {
+	source := map[string]interface{}{"index_patterns": t.patterns}
+	if len(t.composedOf) > 0 {
+		source["composed_of"] = t.composedOf
+	}
+	if t.priority != nil {
+		source["priority"] = *t.priority
+	}
+	if t.version != nil {
+		source["version"] = *t.version
+	}
+	if t.dataStream {
+		source["data_stream"] = map[string]interface{}{}
+	}
+	if t.template != nil {
+		source["template"] = t.template
+	}
+	if len(t.meta) > 0 {
+		source["_meta"] = t.meta
+	}
+	return json.Marshal(source)
+}
+
+// ComponentTemplate is a reusable part of index templates, such as the
+// mappings shared by several of them.
+type ComponentTemplate struct {
+	template *Template
+	version  *int64
+	meta     map[string]interface{}
+}
+
+// NewComponentTemplate returns a component template applying template.
+func NewComponentTemplate(template *Template) *ComponentTemplate {
+	return &ComponentTemplate{template: template}
+}
+
+// Version sets a version number for managing the template externally.
+func (c *ComponentTemplate) Version(version int64) *ComponentTemplate {
+	c.version = &version
+	return c
+}
+
+// Meta attaches user metadata to the template.
+func (c *ComponentTemplate) Meta(meta map[string]interface{}) *ComponentTemplate {
+	c.meta = meta
+	return c
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c *ComponentTemplate) MarshalJSON() ([]byte, error) {
+	template := c.template
+	if template == nil {
+		template = NewTemplate()
+	}
+	source := map[string]interface{}{"template": template}
+	if c.version != nil {
+		source["version"] = *c.version
+	}
+	if len(c.meta) > 0 {
+		source["_meta"] = c.meta
+	}
+	return json.Marshal(source)
+}
+
+// TemplateContent is the settings, mappings and aliases of a template as
+// stored by Elasticsearch.
+type TemplateContent struct {
+	Settings map[string]interface{}            `json:"settings"`
+	Mappings map[string]interface{}            `json:"mappings"`
+	Aliases  map[string]map[string]interface{} `json:"aliases"`
+}
+
+// IndexTemplateInfo is an index template, as listed by IndexTemplates.
+type IndexTemplateInfo struct {
+	Name          string
+	IndexPatterns []string
+	ComposedOf    []string
+	Priority      int64
+	Version       int64
+	DataStream    bool
+	Template      TemplateContent
+	Meta          map[string]interface{}
+}
+
+// ComponentTemplateInfo is a component template, as listed by
+// ComponentTemplates.
+type ComponentTemplateInfo struct {
+	Name     string
+	Version  int64
+	Template TemplateContent
+	Meta     map[string]interface{}
+}
+
+// PutIndexTemplate creates or replaces the index template name. It fails
+// if a component template it is composed of does not exist.
+func (i *IndexClient) PutIndexTemplate(ctx context.Context, name string, template *IndexTemplate) error {
+	return i.putTemplate(ctx, "/_index_template/", name, template)
+}
+
+// PutComponentTemplate creates or replaces the component template name.
+// Index templates composed of it apply the change to indices created
+// afterwards.
+func (i *IndexClient) PutComponentTemplate(ctx context.Context, name string, template *ComponentTemplate) error {
+	return i.putTemplate(ctx, "/_component_template/", name, template)
+}
+
+func (i *IndexClient) putTemplate(ctx context.Context, path, name string, body interface{}) error {
+	_, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPut,
+		Path:   path + url.PathEscape(name),
+		Body:   body,
+	})
+	return err
+}
+
+// IndexTemplates lists the index templates with the given names, which may
+// contain wildcards, or every index template without names. Names without
+// a template are left out rather than reported as an error. The result is
+// sorted by name.
+func (i *IndexClient) IndexTemplates(ctx context.Context, names ...string) ([]IndexTemplateInfo, error) {
+	var res struct {
+		IndexTemplates []struct {
+			Name          string `json:"name"`
+			IndexTemplate struct {
+				IndexPatterns []string               `json:"index_patterns"`
+				ComposedOf    []string               `json:"composed_of"`
+				Priority      int64                  `json:"priority"`
+				Version       int64                  `json:"version"`
+				DataStream    json.RawMessage        `json:"data_stream"`
+				Template      TemplateContent        `json:"template"`
+				Meta          map[string]interface{} `json:"_meta"`
+			} `json:"index_template"`
+		} `json:"index_templates"`
+	}
+	if err := i.getTemplates(ctx, "/_index_template", names, &res); err != nil {
+		return nil, err
+	}
+	templates := make([]IndexTemplateInfo, 0, len(res.IndexTemplates))
+	for _, t := range res.IndexTemplates {
+		templates = append(templates, IndexTemplateInfo{
+			Name:          t.Name,
+			IndexPatterns: t.IndexTemplate.IndexPatterns,
+			ComposedOf:    t.IndexTemplate.ComposedOf,
+			Priority:      t.IndexTemplate.Priority,
+			Version:       t.IndexTemplate.Version,
+			DataStream:    len(t.IndexTemplate.DataStream) > 0 && string(t.IndexTemplate.DataStream) != "null",
+			Template:      t.IndexTemplate.Template,
+			Meta:          t.IndexTemplate.Meta,
+		})
+	}
+	sort.Slice(templates, func(a, b int) bool { return templates[a].Name < templates[b].Name })
+	return templates, nil
+}
+
+// ComponentTemplates lists the component templates like IndexTemplates.
+func (i *IndexClient) ComponentTemplates(ctx context.Context, names ...string) ([]ComponentTemplateInfo, error) {
+	var res struct {
+		ComponentTemplates []struct {
+			Name              string `json:"name"`
+			ComponentTemplate struct {
+				Version  int64                  `json:"version"`
+				Template TemplateContent        `json:"template"`
+				Meta     map[string]interface{} `json:"_meta"`
+			} `json:"component_template"`
+		} `json:"component_templates"`
+	}
+	if err := i.getTemplates(ctx, "/_component_template", names, &res); err != nil {
+		return nil, err
+	}
+	templates := make([]ComponentTemplateInfo, 0, len(res.ComponentTemplates))
+	for _, t := range res.ComponentTemplates {
+		templates = append(templates, ComponentTemplateInfo{
+			Name:     t.Name,
+			Version:  t.ComponentTemplate.Version,
+			Template: t.ComponentTemplate.Template,
+			Meta:     t.ComponentTemplate.Meta,
+		})
+	}
+	sort.Slice(templates, func(a, b int) bool { return templates[a].Name < templates[b].Name })
+	return templates, nil
+}
+
+func (i *IndexClient) getTemplates(ctx context.Context, path string, names []string, v interface{}) error {
+	if len(names) > 0 {
+		path += "/" + url.PathEscape(strings.Join(names, ","))
+	}
+	res, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:       http.MethodGet,
+		Path:         path,
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return json.Unmarshal(res.Body, v)
+}
+
+// IndexTemplateExists reports whether the index template name exists.
+func (i *IndexClient) IndexTemplateExists(ctx context.Context, name string) (bool, error) {
+	return i.templateExists(ctx, "/_index_template/", name)
+}
+
+// ComponentTemplateExists reports whether the component template name
+// exists.
+func (i *IndexClient) ComponentTemplateExists(ctx context.Context, name string) (bool, error) {
+	return i.templateExists(ctx, "/_component_template/", name)
+}
+
+func (i *IndexClient) templateExists(ctx context.Context, path, name string) (bool, error) {
+	res, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method:       http.MethodHead,
+		Path:         path + url.PathEscape(name),
+		IgnoreErrors: []int{http.StatusNotFound},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.StatusCode == http.StatusOK, nil
+}
+
+// DeleteIndexTemplate deletes the index template name. Indices created
+// from it keep their settings, mappings and aliases.
+func (i *IndexClient) DeleteIndexTemplate(ctx context.Context, name string) error {
+	_, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodDelete,
+		Path:   "/_index_template/" + url.PathEscape(name),
+	})
+	return err
+}
+
+// DeleteComponentTemplate deletes the component template name. It fails
+// while an index template is composed of it.
+func (i *IndexClient) DeleteComponentTemplate(ctx context.Context, name string) error {
+	_, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodDelete,
+		Path:   "/_component_template/" + url.PathEscape(name),
+	})
+	return err
+}
+
+// SimulatedTemplate is the outcome of SimulateIndex or
+// SimulateIndexTemplate.
+type SimulatedTemplate struct {
+	// Template is what a new index gets, or nil if no template applies.
+	Template *TemplateContent `json:"template"`
+	// Overlapping are the other templates matching the same names, which
+	// lose to the simulated one by priority.
+	Overlapping []OverlappingTemplate `json:"overlapping"`
+}
+
+// OverlappingTemplate is an index template reported by a simulation.
+type OverlappingTemplate struct {
+	Name          string   `json:"name"`
+	IndexPatterns []string `json:"index_patterns"`
+}
+
+// SimulateIndex returns the settings, mappings and aliases an index named
+// index would be created with by the index templates currently stored,
+// without creating it. It needs Elasticsearch 7.9 or later.
+func (i *IndexClient) SimulateIndex(ctx context.Context, index string) (*SimulatedTemplate, error) {
+	return i.simulate(ctx, "/_index_template/_simulate_index/"+url.PathEscape(index), nil)
+}
+
+// SimulateIndexTemplate returns what template would apply to new indices
+// once merged with its component templates, without storing it. It needs
+// Elasticsearch 7.9 or later.
+func (i *IndexClient) SimulateIndexTemplate(ctx context.Context, template *IndexTemplate) (*SimulatedTemplate, error) {
+	return i.simulate(ctx, "/_index_template/_simulate", template)
+}
+
+func (i *IndexClient) simulate(ctx context.Context, path string, body interface{}) (*SimulatedTemplate, error) {
+	res, err := i.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   path,
+		Body:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var simulated SimulatedTemplate
+	if err := json.Unmarshal(res.Body, &simulated); err != nil {
+		return nil, err
+	}
+	return &simulated, nil
+}
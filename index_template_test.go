@@ -0,0 +1,178 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTemplateBuilders(t *testing.T) {
+	mapping, err := NewMappingFor(counter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := NewIndexTemplate("counters-*").
+		ComposedOf("base").
+		Priority(10).
+		Version(3).
+		DataStream().
+		Template(NewTemplate().
+			Settings(NewSettings().Shards(1).Replicas(0).RefreshInterval(-1)).
+			Mapping(mapping.
+				Dynamic("strict").
+				Property("title", NewProperty("text").Analyzer("english").Field("raw", NewProperty("keyword"))).
+				Property("author", NewProperty("object").Property("name", NewProperty("keyword").Index(false)))).
+			Alias("even", []BoolQueriesWithClauseOption{{Target: "tags", Query: "even", Type: "term"}}))
+
+	b, err := json.Marshal(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, expected map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{
+		"index_patterns": ["counters-*"],
+		"composed_of": ["base"],
+		"priority": 10,
+		"version": 3,
+		"data_stream": {},
+		"template": {
+			"settings": {"number_of_shards": 1, "number_of_replicas": 0, "refresh_interval": "-1"},
+			"mappings": {
+				"dynamic": "strict",
+				"properties": {
+					"id": {"type": "text"},
+					"count": {"type": "long"},
+					"tags": {"type": "text"},
+					"title": {"type": "text", "analyzer": "english", "fields": {"raw": {"type": "keyword"}}},
+					"author": {"type": "object", "properties": {"name": {"type": "keyword", "index": false}}}
+				}
+			},
+			"aliases": {"even": {"filter": {"bool": {"filter": {"term": {"tags": "even"}}}}}}
+		}
+	}`), &expected); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %s, but got %s\n", expected, b)
+	}
+
+	settings, _ := json.Marshal(NewSettings().RefreshInterval(30 * time.Second).DefaultPipeline("lowercase"))
+	if string(settings) != `{"default_pipeline":"lowercase","refresh_interval":"30000ms"}` {
+		t.Fatalf("expected %v, but got %s\n", "30000ms", settings)
+	}
+}
+
+func TestIndexTemplates(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	logs := NewIndexTemplate("logs-*").
+		ComposedOf("logs-mappings", "logs-settings").
+		Priority(100).
+		Template(NewTemplate().Settings(NewSettings().Replicas(0)).Alias("logs", nil))
+	if err := client.PutIndexTemplate(ctx, "logs", logs); err == nil {
+		t.Fatal("expected an error for missing component templates")
+	}
+
+	mappings := NewComponentTemplate(NewTemplate().Mapping(NewMapping().
+		Property("message", NewProperty("text")).
+		Property("level", NewProperty("keyword")))).Version(1)
+	if err := client.PutComponentTemplate(ctx, "logs-mappings", mappings); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PutComponentTemplate(ctx, "logs-settings", NewComponentTemplate(NewTemplate().Settings(NewSettings().Shards(2).Replicas(1)))); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PutIndexTemplate(ctx, "logs", logs); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.PutIndexTemplate(ctx, "all-logs", NewIndexTemplate("logs-*", "audit").Priority(100)); err == nil {
+		t.Fatal("expected an error for overlapping templates with the same priority")
+	}
+	if err := client.PutIndexTemplate(ctx, "all-logs", NewIndexTemplate("logs-*", "audit").Template(NewTemplate().Settings(NewSettings().Shards(5)))); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := client.IndexTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 2 || templates[1].Name != "logs" || templates[1].Priority != 100 || len(templates[1].ComposedOf) != 2 || templates[1].DataStream {
+		t.Fatalf("expected %v templates, but got %v\n", 2, templates)
+	}
+	if templates, err = client.IndexTemplates(ctx, "missing"); err != nil || len(templates) != 0 {
+		t.Fatalf("expected %v templates, but got %v (%v)\n", 0, templates, err)
+	}
+	components, err := client.ComponentTemplates(ctx, "logs-m*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 1 || components[0].Version != 1 || components[0].Template.Mappings["properties"] == nil {
+		t.Fatalf("expected %v, but got %v\n", "logs-mappings", components)
+	}
+	if ok, err := client.IndexTemplateExists(ctx, "logs"); err != nil || !ok {
+		t.Fatalf("expected %v to exist, but got %v (%v)\n", "logs", ok, err)
+	}
+	if ok, err := client.ComponentTemplateExists(ctx, "missing"); err != nil || ok {
+		t.Fatalf("expected %v not to exist, but got %v (%v)\n", "missing", ok, err)
+	}
+
+	simulated, err := client.SimulateIndex(ctx, "logs-2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := simulated.Template.Settings["index"].(map[string]interface{})
+	if settings["number_of_shards"] != 2.0 || settings["number_of_replicas"] != 0.0 || simulated.Template.Aliases["logs"] == nil {
+		t.Fatalf("expected %v shards and %v replicas, but got %v\n", 2, 0, simulated.Template)
+	}
+	if len(simulated.Overlapping) != 1 || simulated.Overlapping[0].Name != "all-logs" {
+		t.Fatalf("expected %v to overlap, but got %v\n", "all-logs", simulated.Overlapping)
+	}
+	if simulated, err = client.SimulateIndex(ctx, "metrics"); err != nil || simulated.Template != nil {
+		t.Fatalf("expected no template, but got %v (%v)\n", simulated, err)
+	}
+	simulated, err = client.SimulateIndexTemplate(ctx, NewIndexTemplate("logs-*").ComposedOf("logs-mappings").Priority(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulated.Template.Mappings["properties"] == nil || len(simulated.Overlapping) != 2 {
+		t.Fatalf("expected the mappings of %v, but got %v\n", "logs-mappings", simulated)
+	}
+
+	if _, err := client.CreateIndexWithMapping(ctx, "logs-2024", `{"mappings": {"properties": {"host": {"type": "keyword"}}}}`); err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := client.raw.GetMapping().Index("logs-2024").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := mapping["logs-2024"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	if props["level"] == nil || props["host"] == nil {
+		t.Fatalf("expected the template and request mappings, but got %v\n", props)
+	}
+	aliases, err := client.Aliases(ctx, "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || aliases[0].Index != "logs-2024" {
+		t.Fatalf("expected %v on %v, but got %v\n", "logs", "logs-2024", aliases)
+	}
+
+	if err := client.DeleteComponentTemplate(ctx, "logs-mappings"); err == nil {
+		t.Fatal("expected an error for deleting a component template in use")
+	}
+	if err := client.DeleteIndexTemplate(ctx, "logs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteComponentTemplate(ctx, "logs-mappings"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteIndexTemplate(ctx, "logs"); err == nil {
+		t.Fatal("expected an error for deleting a missing template")
+	}
+}
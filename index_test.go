@@ -4,10 +4,12 @@ import (
 	"container/list"
 	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/kazu1029/esmini/esminitest"
 	"github.com/olivere/elastic/v7"
 )
 
@@ -399,3 +401,101 @@ func TestDelete(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type taggedTweet struct {
+	ID      int    `json:"id" esmini:"id"`
+	Message string `json:"message"`
+}
+
+func TestBulkInsertErrors(t *testing.T) {
+	srv := esminitest.NewServer()
+	defer srv.Close()
+
+	client, err := New(elastic.SetURL(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+
+	index := "tweets_with_id"
+	newTweets := func() *list.List {
+		tweets := list.New()
+		tweets.PushBack(tweetWithID{ID: 1, Message: "message1"})
+		tweets.PushBack("not a document")
+		tweets.PushBack(tweetWithID{ID: 3, Message: "message3"})
+		return tweets
+	}
+
+	_, err = client.BulkInsert(context.TODO(), index, newTweets(), DocID("ID"))
+	bulkErr, ok := err.(*BulkError)
+	if !ok {
+		t.Fatalf("expected *BulkError, but got %v\n", err)
+	}
+	if len(bulkErr.Items) != 1 {
+		t.Fatalf("expected %v, but got %v\n", 1, len(bulkErr.Items))
+	}
+	if bulkErr.Items[0].Position != 1 || bulkErr.Items[0].Status != 400 || bulkErr.Items[0].Retryable() {
+		t.Fatalf("unexpected item error %v\n", bulkErr.Items[0])
+	}
+
+	srv.FailNextBulkItems(2, 429, "es_rejected_execution_exception", "rejected execution")
+	res, err := client.BulkInsert(context.TODO(), index, newTweets(), DocID("ID"))
+	if bulkErr, ok = err.(*BulkError); !ok {
+		t.Fatalf("expected *BulkError, but got %v\n", err)
+	}
+	if len(bulkErr.Items) != 2 || !bulkErr.Items[0].Retryable() || bulkErr.Items[0].DocID != "1" {
+		t.Fatalf("unexpected item errors %v\n", bulkErr.Items)
+	}
+	if !res.Errors || len(res.Items) != 3 {
+		t.Fatalf("unexpected response %v\n", res)
+	}
+
+	srv.FailNextBulkItems(2, 429, "es_rejected_execution_exception", "rejected execution")
+	res, err = client.BulkInsert(context.TODO(), index, newTweets(), DocID("ID"), RetryBackoff(time.Millisecond, time.Second))
+	if bulkErr, ok = err.(*BulkError); !ok {
+		t.Fatalf("expected *BulkError, but got %v\n", err)
+	}
+	if len(bulkErr.Items) != 1 || bulkErr.Items[0].Position != 1 || bulkErr.Items[0].Retryable() {
+		t.Fatalf("unexpected item errors %v\n", bulkErr.Items)
+	}
+	if res.Items[0]["index"].Id != "1" || res.Items[2]["index"].Id != "3" {
+		t.Fatalf("unexpected response items %v\n", res.Items)
+	}
+	if srv.DocCount(index) != 2 {
+		t.Fatalf("expected %v, but got %v\n", 2, srv.DocCount(index))
+	}
+}
+
+func TestBulkInsertDocIDErrors(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	index := "tweets_with_id"
+	testCases := []struct {
+		name  string
+		doc   interface{}
+		docID string
+		err   error
+	}{
+		{"missing field", tweetWithID{ID: 1}, "UUID", ErrMissingDocID},
+		{"zero field", tweetWithID{}, "ID", ErrZeroDocID},
+		{"zero tag", taggedTweet{}, "", ErrZeroDocID},
+		{"nil doc", nil, "ID", ErrMissingDocID},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := list.New()
+			docs.PushBack(tweetWithID{ID: 2, Message: "message2"})
+			docs.PushBack(tt.doc)
+			var opts []BulkOption
+			if len(tt.docID) > 0 {
+				opts = append(opts, DocID(tt.docID))
+			}
+			if _, err := client.BulkInsert(context.TODO(), index, docs, opts...); !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, but got %v\n", tt.err, err)
+			}
+		})
+	}
+	if srv.DocCount(index) != 0 {
+		t.Fatalf("expected %v, but got %v\n", 0, srv.DocCount(index))
+	}
+}
@@ -0,0 +1,228 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// MappingTagName is the struct tag GenerateMapping reads field mapping
+// parameters from, as comma separated key=value pairs:
+//
+//	type tweet struct {
+//		Message  string `json:"message" es:"analyzer=kuromoji"`
+//		Category string `json:"category" es:"type=keyword"`
+//		Raw      string `json:"raw" es:"type=keyword,index=false"`
+//		Title    string `json:"title" es:"fields.raw=keyword"`
+//		Secret   string `json:"secret" es:"-"`
+//	}
+//
+// Values of true, false and numbers are emitted as JSON booleans and
+// numbers. A key of the form fields.<name> adds a multi-field of that type.
+const MappingTagName = "es"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// GenerateMapping builds the mapping of an index holding documents of v's
+// type, using the json tags for field names.
+func GenerateMapping(v interface{}) (map[string]interface{}, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("esmini: cannot generate a mapping for %v, it is not a struct", t)
+	}
+
+	props, err := mappingProperties(t, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"properties": props}, nil
+}
+
+func (i *IndexClient) CreateIndexFor(ctx context.Context, index string, v interface{}) (*elastic.IndicesCreateResult, error) {
+	mapping, err := GenerateMapping(v)
+	if err != nil {
+		return nil, err
+	}
+	return i.raw.CreateIndex(index).
+		BodyJson(map[string]interface{}{"mappings": mapping}).
+		Do(ctx)
+}
+
+func mappingProperties(t reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("esmini: cannot generate a mapping for recursive type %s", t)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	props := map[string]interface{}{}
+	for j := 0; j < t.NumField(); j++ {
+		f := t.Field(j)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name, skip := jsonFieldName(f)
+		tag := f.Tag.Get(MappingTagName)
+		if skip || tag == "-" {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" {
+			if ft.Kind() != reflect.Struct {
+				continue
+			}
+			embedded, err := mappingProperties(ft, visiting)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range embedded {
+				if _, ok := props[k]; !ok {
+					props[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field, err := fieldMapping(f.Type, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("esmini: field %s: %w", f.Name, err)
+		}
+		if err := applyMappingTag(field, tag); err != nil {
+			return nil, fmt.Errorf("esmini: field %s: %w", f.Name, err)
+		}
+		if len(field) == 0 {
+			continue
+		}
+		props[name] = field
+	}
+	return props, nil
+}
+
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name := strings.Split(tag, ",")[0]
+	return name, false
+}
+
+func fieldMapping(t reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "date"}, nil
+	case t == rawJSONType:
+		return map[string]interface{}{"type": "object", "enabled": false}, nil
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "keyword"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "text"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int8:
+		return map[string]interface{}{"type": "byte"}, nil
+	case reflect.Int16, reflect.Uint8:
+		return map[string]interface{}{"type": "short"}, nil
+	case reflect.Int32, reflect.Uint16:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "long"}, nil
+	case reflect.Float32:
+		return map[string]interface{}{"type": "float"}, nil
+	case reflect.Float64:
+		return map[string]interface{}{"type": "double"}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if t.Kind() == reflect.Array || t.Implements(stringerType) {
+				return map[string]interface{}{"type": "keyword"}, nil
+			}
+			return map[string]interface{}{"type": "binary"}, nil
+		}
+		// Elasticsearch has no array type, any field may hold several values.
+		return fieldMapping(t.Elem(), visiting)
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}, nil
+	case reflect.Struct:
+		props, err := mappingProperties(t, visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"properties": props}, nil
+	case reflect.Interface:
+		// Leave it to dynamic mapping.
+		return map[string]interface{}{}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func applyMappingTag(field map[string]interface{}, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("malformed %s tag option %q, expected key=value", MappingTagName, opt)
+		}
+		key, value := kv[0], kv[1]
+
+		if strings.HasPrefix(key, "fields.") {
+			fields, _ := field["fields"].(map[string]interface{})
+			if fields == nil {
+				fields = map[string]interface{}{}
+				field["fields"] = fields
+			}
+			fields[strings.TrimPrefix(key, "fields.")] = map[string]interface{}{"type": value}
+			continue
+		}
+		if key == "type" && value != "object" && value != "nested" {
+			// e.g. a struct stored as flattened or a custom marshaled keyword.
+			delete(field, "properties")
+		}
+		field[key] = mappingTagValue(value)
+	}
+	return nil
+}
+
+func mappingTagValue(s string) interface{} {
+	if b, err := strconv.ParseBool(s); err == nil && (s == "true" || s == "false") {
+		return b
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
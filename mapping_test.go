@@ -0,0 +1,129 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type mappedUser struct {
+	Name string `json:"name" es:"type=keyword"`
+}
+
+type mappedAudit struct {
+	Updated time.Time `json:"updated"`
+}
+
+type mappedTweet struct {
+	mappedAudit
+	Message  string                 `json:"message" es:"analyzer=kuromoji,fields.raw=keyword"`
+	Retweets int                    `json:"retweets"`
+	Score    float64                `json:"score,omitempty"`
+	Created  time.Time              `json:"created,omitempty"`
+	Tags     []string               `json:"tags,omitempty" es:"type=keyword,ignore_above=256"`
+	Category string                 `json:"category,omitempty" es:"type=keyword,index=false"`
+	Draft    *bool                  `json:"draft"`
+	User     mappedUser             `json:"user"`
+	Replies  []mappedUser           `json:"replies" es:"type=nested"`
+	Labels   map[string]string      `json:"labels" es:"type=flattened"`
+	Extra    map[string]interface{} `json:"extra"`
+	Secret   string                 `json:"-"`
+	Internal string                 `json:"internal" es:"-"`
+	Raw      json.RawMessage        `json:"raw"`
+	Any      interface{}            `json:"any"`
+	NoTag    string
+	private  string
+}
+
+func TestGenerateMapping(t *testing.T) {
+	mapping, err := GenerateMapping(&mappedTweet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{
+  "properties": {
+    "NoTag": {"type": "text"},
+    "category": {"index": false, "type": "keyword"},
+    "created": {"type": "date"},
+    "draft": {"type": "boolean"},
+    "extra": {"type": "object"},
+    "labels": {"type": "flattened"},
+    "message": {"analyzer": "kuromoji", "fields": {"raw": {"type": "keyword"}}, "type": "text"},
+    "raw": {"enabled": false, "type": "object"},
+    "replies": {"properties": {"name": {"type": "keyword"}}, "type": "nested"},
+    "retweets": {"type": "long"},
+    "score": {"type": "double"},
+    "tags": {"ignore_above": 256, "type": "keyword"},
+    "updated": {"type": "date"},
+    "user": {"properties": {"name": {"type": "keyword"}}}
+  }
+}`
+	var want, got interface{}
+	if err := json.Unmarshal([]byte(expected), &want); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if string(wantJSON) != string(gotJSON) {
+		t.Fatalf("expected %s, but got %s\n", wantJSON, gotJSON)
+	}
+}
+
+type recursiveDoc struct {
+	Parent *recursiveDoc `json:"parent"`
+}
+
+func TestGenerateMappingErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		v    interface{}
+	}{
+		{"not a struct", "tweet"},
+		{"recursive", recursiveDoc{}},
+		{"malformed tag", struct {
+			Message string `es:"keyword"`
+		}{}},
+		{"unsupported type", struct {
+			C chan int
+		}{}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := GenerateMapping(tt.v); err == nil {
+				t.Fatal("expected error, but got nil")
+			}
+		})
+	}
+}
+
+func TestCreateIndexFor(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	res, err := client.CreateIndexFor(context.TODO(), "tweets", tweet{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Acknowledged {
+		t.Errorf("expected Acknowledged true, but got false")
+	}
+
+	mapping, err := client.raw.GetMapping().Index("tweets").Do(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(mapping["tweets"])
+	expected := `{"mappings":{"properties":{"category":{"type":"text"},"created":{"type":"date"},"message":{"type":"text"},"retweets":{"type":"long"},"tags":{"type":"text"}}}}`
+	if string(b) != expected {
+		t.Fatalf("expected %s, but got %s\n", expected, b)
+	}
+}
@@ -0,0 +1,198 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultMigratePollInterval is how often Migrate polls its reindex task.
+const DefaultMigratePollInterval = time.Second
+
+// ErrCountMismatch is returned by Migrate when the new index does not hold
+// the number of documents that were copied or loaded into it.
+var ErrCountMismatch = errors.New("esmini: document count mismatch")
+
+type migrateOption struct {
+	mapping   string
+	load      func(ctx context.Context, index string) (int64, error)
+	reindex   []ByQueryOption
+	deleteOld bool
+	interval  time.Duration
+	progress  func(*TaskStatus)
+}
+
+// MigrateOption configures Migrate.
+type MigrateOption func(*migrateOption)
+
+// MigrateMapping creates the new index with mapping, a body accepted by
+// CreateIndexWithMapping.
+func MigrateMapping(mapping string) MigrateOption {
+	return func(m *migrateOption) {
+		m.mapping = mapping
+	}
+}
+
+// MigrateLoad fills the new index with load instead of reindexing the old
+// one, e.g. by bulk loading from the source of truth. load returns how many
+// documents it indexed.
+func MigrateLoad(load func(ctx context.Context, index string) (int64, error)) MigrateOption {
+	return func(m *migrateOption) {
+		m.load = load
+	}
+}
+
+// MigrateReindex configures the reindex from the old index, e.g. with
+// ReindexScript to transform documents or BatchSize.
+func MigrateReindex(opts ...ByQueryOption) MigrateOption {
+	return func(m *migrateOption) {
+		m.reindex = opts
+	}
+}
+
+// MigrateProgress polls the reindex task every interval and passes each
+// status to progress, if not nil.
+func MigrateProgress(interval time.Duration, progress func(*TaskStatus)) MigrateOption {
+	return func(m *migrateOption) {
+		m.interval = interval
+		m.progress = progress
+	}
+}
+
+// DeleteOldIndex deletes the index the alias pointed at, in the same
+// atomic step that moves the alias.
+func DeleteOldIndex() MigrateOption {
+	return func(m *migrateOption) {
+		m.deleteOld = true
+	}
+}
+
+// MigrateResult describes a completed Migrate.
+type MigrateResult struct {
+	Alias           string
+	OldIndex        string
+	NewIndex        string
+	Docs            int64
+	OldIndexDeleted bool
+}
+
+// Migrate moves alias to newIndex without downtime: it creates newIndex,
+// copies the documents of the index alias points at with Reindex, or loads
+// them with MigrateLoad, checks that newIndex holds as many documents as
+// were written, and atomically swaps the alias, keeping its filter and
+// write index flag. If alias does not exist yet, it is created. On failure
+// after newIndex was created, including a cancelled ctx, the reindex is
+// cancelled, newIndex is deleted and the alias left untouched.
+//
+// Documents written through the alias while the reindex runs go to the old
+// index and are not copied.
+func (i *IndexClient) Migrate(ctx context.Context, alias, newIndex string, opts ...MigrateOption) (*MigrateResult, error) {
+	mOpt := &migrateOption{interval: DefaultMigratePollInterval}
+	for _, opt := range opts {
+		opt(mOpt)
+	}
+
+	aliases, err := i.Aliases(ctx, alias)
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrateResult{Alias: alias, NewIndex: newIndex}
+	var old *Alias
+	switch len(aliases) {
+	case 0:
+		exists, err := i.raw.IndexExists(alias).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, fmt.Errorf("esmini: migrate %s: it is an index, not an alias", alias)
+		}
+	case 1:
+		old = &aliases[0]
+		result.OldIndex = old.Index
+	default:
+		return nil, fmt.Errorf("esmini: migrate %s: alias points at %d indices", alias, len(aliases))
+	}
+
+	if len(mOpt.mapping) > 0 {
+		_, err = i.CreateIndexWithMapping(ctx, newIndex, mOpt.mapping)
+	} else {
+		_, err = i.CreateIndex(ctx, newIndex)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := i.migrate(ctx, result, old, mOpt)
+	if err != nil {
+		rollbackCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if task != nil {
+			// A reindex left running would recreate newIndex after it is
+			// deleted. Cancelling fails if it completed already.
+			if task.Cancel(rollbackCtx) == nil {
+				_, _ = task.Wait(rollbackCtx, mOpt.interval, nil)
+			}
+		}
+		if _, rollbackErr := i.DeleteIndex(rollbackCtx, newIndex); rollbackErr != nil {
+			return nil, fmt.Errorf("esmini: migrate %s: %w (deleting %s failed: %v)", alias, err, newIndex, rollbackErr)
+		}
+		return nil, fmt.Errorf("esmini: migrate %s: %w", alias, err)
+	}
+	return result, nil
+}
+
+// migrate fills result.NewIndex, verifies it and moves the alias, old if
+// it exists, keeping its filter and write index flag. It returns the
+// reindex task it started, if any.
+func (i *IndexClient) migrate(ctx context.Context, result *MigrateResult, old *Alias, mOpt *migrateOption) (*Task, error) {
+	var task *Task
+	var expected int64
+	switch {
+	case mOpt.load != nil:
+		n, err := mOpt.load(ctx, result.NewIndex)
+		if err != nil {
+			return nil, err
+		}
+		expected = n
+	case old != nil:
+		var err error
+		if task, err = i.Reindex(ctx, result.OldIndex, result.NewIndex, mOpt.reindex...); err != nil {
+			return nil, err
+		}
+		res, err := task.Wait(ctx, mOpt.interval, mOpt.progress)
+		if err != nil {
+			return task, err
+		}
+		expected = res.Total - res.Noops
+	}
+
+	if _, err := i.Refresh(ctx, result.NewIndex); err != nil {
+		return task, err
+	}
+	count, err := i.raw.Count(result.NewIndex).Do(ctx)
+	if err != nil {
+		return task, err
+	}
+	if count != expected {
+		return task, fmt.Errorf("%w: %s has %d documents, expected %d", ErrCountMismatch, result.NewIndex, count, expected)
+	}
+	result.Docs = count
+
+	add := AddAliasAction(result.NewIndex, result.Alias)
+	var actions []*AliasAction
+	if old != nil {
+		actions = append(actions, RemoveAliasAction(old.Index, old.Name))
+		add.rawFilter = old.Filter
+		if old.WriteIndex {
+			add.WriteIndex(true)
+		}
+	}
+	actions = append(actions, add)
+	if mOpt.deleteOld && old != nil {
+		actions = append(actions, RemoveIndexAction(old.Index))
+		result.OldIndexDeleted = true
+	}
+	return task, i.UpdateAliases(ctx, actions...)
+}
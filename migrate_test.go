@@ -0,0 +1,117 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigrate(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(6)...)
+
+	ctx := context.TODO()
+	if _, err := client.Migrate(ctx, "counters", "counters_v2"); err == nil {
+		t.Fatal("expected an error for migrating an index")
+	}
+
+	var polls int
+	res, err := client.Migrate(ctx, "tally", "tally_v1", MigrateLoad(func(ctx context.Context, index string) (int64, error) {
+		task, err := client.Reindex(ctx, "counters", index)
+		if err != nil {
+			return 0, err
+		}
+		res, err := task.Wait(ctx, time.Millisecond, nil)
+		if err != nil {
+			return 0, err
+		}
+		return res.Created, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OldIndex != "" || res.Docs != 6 {
+		t.Fatalf("expected %v documents, but got %v\n", 6, res)
+	}
+
+	res, err = client.Migrate(ctx, "tally", "tally_v2",
+		MigrateMapping(`{"mappings": {"properties": {"count": {"type": "long"}}}}`),
+		MigrateReindex(
+			ReindexQuery([]BoolQueriesWithClauseOption{{Target: "count", Query: Range{Lte: 4}, Type: "range"}}),
+			ReindexScript(Script{Source: "ctx._source.count += 100"}),
+			BatchSize(2),
+		),
+		MigrateProgress(time.Millisecond, func(*TaskStatus) { polls++ }),
+		DeleteOldIndex(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.OldIndex != "tally_v1" || res.Docs != 4 || !res.OldIndexDeleted || polls != 2 {
+		t.Fatalf("expected %v documents after %v polls, but got %v after %v\n", 4, 2, res, polls)
+	}
+	aliases, err := client.Aliases(ctx, "tally")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || aliases[0].Index != "tally_v2" || srv.DocCount("tally_v1") != 0 {
+		t.Fatalf("expected %v on %v, but got %v\n", "tally", "tally_v2", aliases)
+	}
+
+	_, err = client.Migrate(ctx, "tally", "tally_v3", MigrateLoad(func(ctx context.Context, index string) (int64, error) {
+		_, err := client.IndexDoc(ctx, index, counter{ID: "1", Count: 1})
+		return 2, err
+	}))
+	if !errors.Is(err, ErrCountMismatch) {
+		t.Fatalf("expected %v, but got %v\n", ErrCountMismatch, err)
+	}
+	for _, name := range srv.Indices() {
+		if name == "tally_v3" {
+			t.Fatal("expected tally_v3 to be rolled back")
+		}
+	}
+	if aliases, _ := client.Aliases(ctx, "tally"); len(aliases) != 1 || aliases[0].Index != "tally_v2" {
+		t.Fatalf("expected %v on %v, but got %v\n", "tally", "tally_v2", aliases)
+	}
+}
+
+func TestMigrateAliasProperties(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(4)...)
+
+	ctx := context.TODO()
+	filter := []BoolQueriesWithClauseOption{{Target: "tags", Query: "even", Type: "term"}}
+	if err := client.UpdateAliases(ctx, AddAliasAction("counters", "evens").Filter(filter).WriteIndex(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Migrate(ctx, "evens", "counters_v2", MigrateProgress(0, nil)); err != nil {
+		t.Fatal(err)
+	}
+	aliases, err := client.Aliases(ctx, "evens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 1 || aliases[0].Index != "counters_v2" || aliases[0].Filter == nil || !aliases[0].WriteIndex {
+		t.Fatalf("expected a filtered write alias on %v, but got %v\n", "counters_v2", aliases)
+	}
+	res, err := client.raw.Search("evens").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalHits() != 2 {
+		t.Fatalf("expected %v hits, but got %v\n", 2, res.TotalHits())
+	}
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	_, err = client.Migrate(cancelCtx, "evens", "counters_v3",
+		MigrateReindex(BatchSize(1)),
+		MigrateProgress(time.Millisecond, func(*TaskStatus) { cancel() }),
+	)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, but got %v\n", context.Canceled, err)
+	}
+	for _, name := range srv.Indices() {
+		if name == "counters_v3" {
+			t.Fatal("expected counters_v3 to be rolled back")
+		}
+	}
+}
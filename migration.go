@@ -0,0 +1,567 @@
+package esmini
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// DefaultMigrationsIndex is the index a Migrator records applied
+// migrations in.
+const DefaultMigrationsIndex = "esmini_migrations"
+
+const migrationLockID = "lock"
+
+const migrationsMapping = `{
+	"mappings": {
+		"properties": {
+			"version": {"type": "long"},
+			"description": {"type": "text"},
+			"checksum": {"type": "keyword"},
+			"applied_at": {"type": "date"},
+			"duration_ms": {"type": "long"},
+			"owner": {"type": "keyword"},
+			"acquired_at": {"type": "date"}
+		}
+	}
+}`
+
+var (
+	// ErrMigrationLocked is returned by Migrator.Run when another run holds
+	// the lock.
+	ErrMigrationLocked = errors.New("esmini: migrations locked")
+	// ErrMigrationModified is returned by Migrator.Run when a migration
+	// loaded from a file changed since it was applied.
+	ErrMigrationModified = errors.New("esmini: applied migration modified")
+)
+
+// Migration is one versioned change to the cluster, such as a new mapping
+// or template. Migrations are applied once, in ascending Version order.
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(ctx context.Context, client *IndexClient) error
+
+	checksum string
+}
+
+// LoadMigrations reads the migrations stored as JSON files at the root of
+// fsys, e.g. os.DirFS("migrations") or an embed.FS. A file is named after
+// its version and description, like 0002_add_tweet_template.json, and
+// holds a list of steps run in order:
+//
+//	{"steps": [
+//		{"create_index": {"index": "tweets_v2", "body": {"mappings": {...}}}},
+//		{"put_mapping": {"index": "tweets", "body": {"properties": {...}}}},
+//		{"put_component_template": {"name": "tweet_mappings", "body": {"template": {...}}}},
+//		{"put_index_template": {"name": "tweets", "body": {"index_patterns": ["tweets_*"], ...}}},
+//		{"put_template": {"name": "tweets", "body": {...}}},
+//		{"put_pipeline": {"id": "lowercase", "body": {"processors": [...]}}},
+//		{"reindex": {"source": "tweets", "dest": "tweets_v2", "script": {"source": "...", "params": {...}}}}
+//	]}
+//
+// A "description" field overrides the one taken from the file name.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseMigration(name, b)
+		if err != nil {
+			return nil, fmt.Errorf("esmini: migration %s: %w", name, err)
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+type migrationFile struct {
+	Description string                       `json:"description"`
+	Steps       []map[string]json.RawMessage `json:"steps"`
+}
+
+type migrationStep struct {
+	Index  string          `json:"index"`
+	Name   string          `json:"name"`
+	ID     string          `json:"id"`
+	Source string          `json:"source"`
+	Dest   string          `json:"dest"`
+	Body   json.RawMessage `json:"body"`
+	Script *Script         `json:"script"`
+}
+
+func parseMigration(name string, b []byte) (Migration, error) {
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	prefix, desc, _ := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return Migration{}, errors.New("file name must start with a version number")
+	}
+
+	var file migrationFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return Migration{}, err
+	}
+	if len(file.Description) > 0 {
+		desc = file.Description
+	}
+	var steps []func(context.Context, *IndexClient) error
+	for n, s := range file.Steps {
+		if len(s) != 1 {
+			return Migration{}, fmt.Errorf("step %d must hold exactly one action", n+1)
+		}
+		for action, raw := range s {
+			var step migrationStep
+			if err := json.Unmarshal(raw, &step); err != nil {
+				return Migration{}, fmt.Errorf("step %d: %w", n+1, err)
+			}
+			run, err := step.build(action)
+			if err != nil {
+				return Migration{}, fmt.Errorf("step %d: %w", n+1, err)
+			}
+			steps = append(steps, run)
+		}
+	}
+
+	sum := sha256.Sum256(b)
+	return Migration{
+		Version:     version,
+		Description: strings.ReplaceAll(desc, "_", " "),
+		Up: func(ctx context.Context, client *IndexClient) error {
+			for _, run := range steps {
+				if err := run(ctx, client); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		checksum: hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+func (s migrationStep) build(action string) (func(context.Context, *IndexClient) error, error) {
+	switch action {
+	case "create_index":
+		return func(ctx context.Context, client *IndexClient) error {
+			if len(s.Body) == 0 {
+				_, err := client.CreateIndex(ctx, s.Index)
+				return err
+			}
+			_, err := client.CreateIndexWithMapping(ctx, s.Index, string(s.Body))
+			return err
+		}, nil
+	case "put_mapping":
+		return func(ctx context.Context, client *IndexClient) error {
+			_, err := client.raw.PutMapping().Index(s.Index).BodyString(string(s.Body)).Do(ctx)
+			return err
+		}, nil
+	case "put_template":
+		return func(ctx context.Context, client *IndexClient) error {
+			_, err := client.CreateTemplate(ctx, s.Name, string(s.Body))
+			return err
+		}, nil
+	case "put_index_template":
+		return func(ctx context.Context, client *IndexClient) error {
+			return client.putTemplate(ctx, "/_index_template/", s.Name, s.Body)
+		}, nil
+	case "put_component_template":
+		return func(ctx context.Context, client *IndexClient) error {
+			return client.putTemplate(ctx, "/_component_template/", s.Name, s.Body)
+		}, nil
+	case "put_pipeline":
+		return func(ctx context.Context, client *IndexClient) error {
+			_, err := client.raw.IngestPutPipeline(s.ID).BodyString(string(s.Body)).Do(ctx)
+			return err
+		}, nil
+	case "reindex":
+		return func(ctx context.Context, client *IndexClient) error {
+			var opts []ByQueryOption
+			if s.Script != nil {
+				opts = append(opts, ReindexScript(*s.Script))
+			}
+			task, err := client.Reindex(ctx, s.Source, s.Dest, opts...)
+			if err != nil {
+				return err
+			}
+			_, err = task.Wait(ctx, DefaultMigratePollInterval, nil)
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown action %q", action)
+}
+
+// MigrationStatus reports whether a migration was applied.
+type MigrationStatus struct {
+	Version     int64
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+	Duration    time.Duration
+	// Modified is set when the file of an applied migration changed since.
+	Modified bool
+}
+
+type migrationRecord struct {
+	Version        int64     `json:"version"`
+	Description    string    `json:"description"`
+	Checksum       string    `json:"checksum,omitempty"`
+	AppliedAt      time.Time `json:"applied_at"`
+	DurationMillis int64     `json:"duration_ms"`
+}
+
+type migrationLock struct {
+	Owner      string    `json:"owner"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// Migrator applies migrations and records them in an index of the
+// cluster, so that each is applied once per cluster.
+type Migrator struct {
+	client  *IndexClient
+	index   string
+	owner   string
+	lockTTL time.Duration
+	dryRun  bool
+}
+
+// MigratorOption configures a Migrator.
+type MigratorOption func(*Migrator)
+
+// MigrationsIndex records migrations in index instead of
+// DefaultMigrationsIndex.
+func MigrationsIndex(index string) MigratorOption {
+	return func(m *Migrator) {
+		m.index = index
+	}
+}
+
+// DryRun makes Run report the migrations it would apply without applying
+// them or taking the lock.
+func DryRun() MigratorOption {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// LockTTL lets Run take over a lock held for longer than ttl, left behind
+// by a run that crashed. Run renews its own lock every third of ttl, so that
+// migrations running longer than ttl keep it. By default a lock is only
+// released by its run.
+func LockTTL(ttl time.Duration) MigratorOption {
+	return func(m *Migrator) {
+		m.lockTTL = ttl
+	}
+}
+
+// LockOwner names the lock holder in ErrMigrationLocked errors. Defaults
+// to the host name and process ID.
+func LockOwner(owner string) MigratorOption {
+	return func(m *Migrator) {
+		m.owner = owner
+	}
+}
+
+// NewMigrator returns a Migrator recording migrations through client.
+func NewMigrator(client *IndexClient, opts ...MigratorOption) *Migrator {
+	host, _ := os.Hostname()
+	m := &Migrator{
+		client: client,
+		index:  DefaultMigrationsIndex,
+		owner:  fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Run applies the migrations not applied yet, in ascending version order,
+// and returns their status. It stops at the first failing migration, which
+// is not recorded and is retried by the next run. Run holds a lock in the
+// migrations index while it works, and fails with ErrMigrationLocked if
+// another run holds it or takes it over, which cancels the context passed
+// to the running migration.
+func (m *Migrator) Run(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+	if m.dryRun {
+		status, err := m.Status(ctx, migrations)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkModified(status); err != nil {
+			return nil, err
+		}
+		return pendingMigrations(status), nil
+	}
+
+	if err := m.ensureIndex(ctx); err != nil {
+		return nil, err
+	}
+	ctx, release, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := m.apply(ctx, migrations)
+	if lost := release(); lost != nil {
+		return applied, lost
+	}
+	return applied, err
+}
+
+// apply runs the pending migrations while Run holds the lock.
+func (m *Migrator) apply(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	status, err := m.Status(ctx, migrations)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModified(status); err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]Migration, len(migrations))
+	for _, mig := range migrations {
+		byVersion[mig.Version] = mig
+	}
+	var applied []MigrationStatus
+	for _, s := range pendingMigrations(status) {
+		mig := byVersion[s.Version]
+		start := time.Now()
+		if err := mig.Up(ctx, m.client); err != nil {
+			return applied, fmt.Errorf("esmini: migration %d (%s): %w", mig.Version, mig.Description, err)
+		}
+		rec := migrationRecord{
+			Version:        mig.Version,
+			Description:    mig.Description,
+			Checksum:       mig.checksum,
+			AppliedAt:      start.UTC(),
+			DurationMillis: time.Since(start).Milliseconds(),
+		}
+		if _, err := m.client.indexDoc(ctx, m.index, strconv.FormatInt(mig.Version, 10), rec, newWriteOption([]WriteOption{Refresh(RefreshTrue)})); err != nil {
+			return applied, fmt.Errorf("esmini: recording migration %d: %w", mig.Version, err)
+		}
+		applied = append(applied, rec.status(mig.checksum))
+	}
+	return applied, nil
+}
+
+// Status reports every migration given or recorded as applied, sorted by
+// version.
+func (m *Migrator) Status(ctx context.Context, migrations []Migration) ([]MigrationStatus, error) {
+	migrations, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, mig := range migrations {
+		if rec, ok := records[mig.Version]; ok {
+			status = append(status, rec.status(mig.checksum))
+			delete(records, mig.Version)
+			continue
+		}
+		status = append(status, MigrationStatus{Version: mig.Version, Description: mig.Description})
+	}
+	for _, rec := range records {
+		status = append(status, rec.status(rec.Checksum))
+	}
+	sort.Slice(status, func(a, b int) bool { return status[a].Version < status[b].Version })
+	return status, nil
+}
+
+func (r migrationRecord) status(checksum string) MigrationStatus {
+	return MigrationStatus{
+		Version:     r.Version,
+		Description: r.Description,
+		Applied:     true,
+		AppliedAt:   r.AppliedAt,
+		Duration:    time.Duration(r.DurationMillis) * time.Millisecond,
+		Modified:    len(r.Checksum) > 0 && r.Checksum != checksum,
+	}
+}
+
+func checkModified(status []MigrationStatus) error {
+	for _, s := range status {
+		if s.Modified {
+			return fmt.Errorf("%w: version %d", ErrMigrationModified, s.Version)
+		}
+	}
+	return nil
+}
+
+func pendingMigrations(status []MigrationStatus) []MigrationStatus {
+	var pending []MigrationStatus
+	for _, s := range status {
+		if !s.Applied {
+			pending = append(pending, s)
+		}
+	}
+	return pending
+}
+
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].Version < sorted[b].Version })
+	for n, mig := range sorted {
+		switch {
+		case mig.Version <= 0:
+			return nil, fmt.Errorf("esmini: migration version %d must be positive", mig.Version)
+		case mig.Up == nil:
+			return nil, fmt.Errorf("esmini: migration %d has no Up func", mig.Version)
+		case n > 0 && sorted[n-1].Version == mig.Version:
+			return nil, fmt.Errorf("esmini: duplicate migration version %d", mig.Version)
+		}
+	}
+	return sorted, nil
+}
+
+// records returns the applied migrations by version, none if the
+// migrations index does not exist yet.
+func (m *Migrator) records(ctx context.Context) (map[int64]migrationRecord, error) {
+	res, err := m.client.raw.Search(m.index).
+		Query(elastic.NewBoolQuery().MustNot(elastic.NewIdsQuery().Ids(migrationLockID))).
+		Size(10000).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return map[int64]migrationRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[int64]migrationRecord, len(res.Hits.Hits))
+	for _, hit := range res.Hits.Hits {
+		var rec migrationRecord
+		if err := json.Unmarshal(hit.Source, &rec); err != nil {
+			return nil, err
+		}
+		records[rec.Version] = rec
+	}
+	return records, nil
+}
+
+func (m *Migrator) ensureIndex(ctx context.Context) error {
+	exists, err := m.client.raw.IndexExists(m.index).Do(ctx)
+	if err != nil || exists {
+		return err
+	}
+	_, err = m.client.CreateIndexWithMapping(ctx, m.index, migrationsMapping)
+	if e, ok := err.(*elastic.Error); ok && e.Details != nil && e.Details.Type == "resource_already_exists_exception" {
+		return nil
+	}
+	return err
+}
+
+// lock takes the migrations lock, or a lock older than the TTL, and
+// returns a context canceled if the lock is lost and the func releasing
+// it. With a TTL, the lock is renewed until released; if another run took
+// it over meanwhile, release returns ErrMigrationLocked.
+func (m *Migrator) lock(ctx context.Context) (context.Context, func() error, error) {
+	lock := migrationLock{Owner: m.owner, AcquiredAt: time.Now().UTC()}
+	res, err := m.client.raw.Index().
+		Index(m.index).
+		Id(migrationLockID).
+		OpType("create").
+		BodyJson(lock).
+		Refresh(string(RefreshTrue)).
+		Do(ctx)
+	if e, ok := err.(*elastic.Error); ok && e.Status == http.StatusConflict {
+		res, err = m.takeOverLock(ctx, lock)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	seqNo, primaryTerm := res.SeqNo, res.PrimaryTerm
+	lost := false
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		if m.lockTTL <= 0 {
+			return
+		}
+		interval := m.lockTTL / 3
+		if interval < time.Millisecond {
+			interval = time.Millisecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			lock.AcquiredAt = time.Now().UTC()
+			res, err := m.client.indexDoc(ctx, m.index, migrationLockID, lock,
+				newWriteOption([]WriteOption{Refresh(RefreshTrue), IfSeqNo(seqNo, primaryTerm)}))
+			if errors.Is(err, ErrConflict) {
+				// Taken over by another run, which may be applying the
+				// same migrations: stop the running one.
+				lost = true
+				cancel()
+				return
+			}
+			if err == nil {
+				seqNo, primaryTerm = res.SeqNo, res.PrimaryTerm
+			}
+		}
+	}()
+	return ctx, func() error {
+		close(stop)
+		<-done
+		cancel()
+		if lost {
+			return fmt.Errorf("%w: taken over by another run", ErrMigrationLocked)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, _ = m.client.Delete(ctx, m.index, migrationLockID, IfSeqNo(seqNo, primaryTerm))
+		return nil
+	}, nil
+}
+
+func (m *Migrator) takeOverLock(ctx context.Context, lock migrationLock) (*elastic.IndexResponse, error) {
+	var held migrationLock
+	current, err := m.client.Get(ctx, m.index, migrationLockID, &held)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: released while acquiring it, try again", ErrMigrationLocked)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.lockTTL <= 0 || time.Since(held.AcquiredAt) < m.lockTTL {
+		return nil, fmt.Errorf("%w: held by %s since %s", ErrMigrationLocked, held.Owner, held.AcquiredAt.Format(time.RFC3339))
+	}
+	res, err := m.client.indexDoc(ctx, m.index, migrationLockID, lock,
+		newWriteOption([]WriteOption{Refresh(RefreshTrue), IfSeqNo(*current.SeqNo, *current.PrimaryTerm)}))
+	if errors.Is(err, ErrConflict) {
+		return nil, fmt.Errorf("%w: taken over by another run", ErrMigrationLocked)
+	}
+	return res, err
+}
@@ -0,0 +1,228 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var migrationFiles = fstest.MapFS{
+	"0001_create_tweets.json": {Data: []byte(`{"steps": [
+		{"create_index": {"index": "tweets", "body": {"mappings": {"properties": {"user": {"type": "keyword"}}}}}},
+		{"put_pipeline": {"id": "lowercase", "body": {"processors": [{"lowercase": {"field": "user"}}]}}}
+	]}`)},
+	"0002_add_tweet_template.json": {Data: []byte(`{"description": "tweet template", "steps": [
+		{"put_template": {"name": "tweets", "body": {"index_patterns": ["tweets_*"]}}},
+		{"put_component_template": {"name": "tweet_mappings", "body": {"template": {"mappings": {"properties": {"likes": {"type": "long"}}}}}}},
+		{"put_index_template": {"name": "tweets", "body": {"index_patterns": ["tweets_*"], "composed_of": ["tweet_mappings"]}}},
+		{"put_mapping": {"index": "tweets", "body": {"properties": {"likes": {"type": "long"}}}}}
+	]}`)},
+	"README.md": {Data: []byte("not a migration")},
+}
+
+func TestMigratorRun(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	migrations, err := LoadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Description != "create tweets" || migrations[1].Description != "tweet template" {
+		t.Fatalf("expected %v migrations, but got %v\n", 2, migrations)
+	}
+
+	pending, err := NewMigrator(client, DryRun()).Run(ctx, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Applied || len(srv.Indices()) != 0 {
+		t.Fatalf("expected %v pending migrations and no index, but got %v and %v\n", 2, pending, srv.Indices())
+	}
+
+	migrator := NewMigrator(client)
+	applied, err := migrator.Run(ctx, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[1].Version != 2 || !applied[1].Applied {
+		t.Fatalf("expected %v applied migrations, but got %v\n", 2, applied)
+	}
+	mapping, err := client.raw.GetMapping().Index("tweets").Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := mapping["tweets"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := props["likes"]; !ok {
+		t.Fatalf("expected %v in the mapping, but got %v\n", "likes", props)
+	}
+	if _, err := client.raw.IngestGetPipeline("lowercase").Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := client.IndexTemplateExists(ctx, "tweets"); err != nil || !ok {
+		t.Fatalf("expected %v to exist, but got %v (%v)\n", "tweets", ok, err)
+	}
+
+	applied, err = migrator.Run(ctx, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected %v applied migrations, but got %v\n", 0, applied)
+	}
+
+	var calls int
+	migrations = append(migrations, Migration{
+		Version:     3,
+		Description: "fails",
+		Up: func(ctx context.Context, client *IndexClient) error {
+			calls++
+			return errors.New("boom")
+		},
+	})
+	if _, err := migrator.Run(ctx, migrations); err == nil {
+		t.Fatal("expected the failing migration to fail the run")
+	}
+	status, err := migrator.Status(ctx, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 3 || !status[0].Applied || status[2].Applied || calls != 1 {
+		t.Fatalf("expected %v to be pending, but got %v\n", 3, status)
+	}
+	// The failed run released its lock, so the next one retries.
+	if _, err := migrator.Run(ctx, migrations); err == nil || errors.Is(err, ErrMigrationLocked) || calls != 2 {
+		t.Fatalf("expected the migration to be retried, but got %v after %v calls\n", err, calls)
+	}
+
+	modified := fstest.MapFS{"0001_create_tweets.json": {Data: []byte(`{"steps": []}`)}}
+	changed, err := LoadMigrations(modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Run(ctx, changed); !errors.Is(err, ErrMigrationModified) {
+		t.Fatalf("expected %v, but got %v\n", ErrMigrationModified, err)
+	}
+	if _, err := NewMigrator(client, DryRun()).Run(ctx, changed); !errors.Is(err, ErrMigrationModified) {
+		t.Fatalf("expected %v, but got %v\n", ErrMigrationModified, err)
+	}
+}
+
+func TestMigratorLock(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	var nested error
+	migrations := []Migration{{
+		Version: 1,
+		Up: func(ctx context.Context, client *IndexClient) error {
+			_, nested = NewMigrator(client, LockOwner("other")).Run(ctx, []Migration{{Version: 1, Up: func(context.Context, *IndexClient) error { return nil }}})
+			return nil
+		},
+	}}
+	if _, err := NewMigrator(client).Run(ctx, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(nested, ErrMigrationLocked) {
+		t.Fatalf("expected %v, but got %v\n", ErrMigrationLocked, nested)
+	}
+
+	stale := migrationLock{Owner: "crashed", AcquiredAt: time.Now().Add(-time.Hour).UTC()}
+	if _, err := client.indexDoc(ctx, DefaultMigrationsIndex, migrationLockID, stale, newWriteOption(nil)); err != nil {
+		t.Fatal(err)
+	}
+	migrations = append(migrations, Migration{Version: 2, Up: func(context.Context, *IndexClient) error { return nil }})
+	if _, err := NewMigrator(client).Run(ctx, migrations); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("expected %v, but got %v\n", ErrMigrationLocked, err)
+	}
+	applied, err := NewMigrator(client, LockTTL(time.Minute)).Run(ctx, migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Fatalf("expected version %v to be applied, but got %v\n", 2, applied)
+	}
+	if _, err := NewMigrator(client).Run(ctx, migrations); err != nil {
+		t.Fatalf("expected the taken over lock to be released, but got %v\n", err)
+	}
+
+	// A migration outliving the TTL keeps the lock, as Run renews it.
+	migrations = append(migrations, Migration{
+		Version: 3,
+		Up: func(ctx context.Context, client *IndexClient) error {
+			time.Sleep(200 * time.Millisecond)
+			_, nested = NewMigrator(client, LockOwner("other"), LockTTL(100*time.Millisecond)).Run(ctx, []Migration{{Version: 1, Up: func(context.Context, *IndexClient) error { return nil }}})
+			return nil
+		},
+	})
+	if _, err := NewMigrator(client, LockTTL(100*time.Millisecond)).Run(ctx, migrations); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(nested, ErrMigrationLocked) {
+		t.Fatalf("expected %v, but got %v\n", ErrMigrationLocked, nested)
+	}
+	if _, err := NewMigrator(client).Run(ctx, migrations); err != nil {
+		t.Fatalf("expected the renewed lock to be released, but got %v\n", err)
+	}
+
+	// Losing the lock to another run cancels the running migration and
+	// skips the rest.
+	var calls int
+	takenOver := []Migration{
+		{Version: 1, Up: func(context.Context, *IndexClient) error { return nil }},
+		{Version: 2, Up: func(context.Context, *IndexClient) error { return nil }},
+		{Version: 3, Up: func(context.Context, *IndexClient) error { return nil }},
+		{Version: 4, Up: func(ctx context.Context, client *IndexClient) error {
+			calls++
+			other := migrationLock{Owner: "other", AcquiredAt: time.Now().UTC()}
+			if _, err := client.indexDoc(context.TODO(), DefaultMigrationsIndex, migrationLockID, other, newWriteOption(nil)); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		}},
+		{Version: 5, Up: func(context.Context, *IndexClient) error {
+			calls++
+			return nil
+		}},
+	}
+	if _, err := NewMigrator(client, LockTTL(30*time.Millisecond)).Run(ctx, takenOver); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("expected %v, but got %v\n", ErrMigrationLocked, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected %v call, but got %v\n", 1, calls)
+	}
+	var held migrationLock
+	if _, err := client.Get(ctx, DefaultMigrationsIndex, migrationLockID, &held); err != nil || held.Owner != "other" {
+		t.Fatalf("expected the lock of %v to be kept, but got %v (%v)\n", "other", held, err)
+	}
+
+	if _, err := NewMigrator(client, LockTTL(time.Nanosecond)).Run(ctx, takenOver[:3]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"create_tweets.json": `{"steps": []}`,
+		"0001_bad.json":      `{"steps": [{"drop_cluster": {}}]}`,
+		"0001_two.json":      `{"steps": [{"put_mapping": {}, "put_template": {}}]}`,
+	} {
+		if _, err := LoadMigrations(fstest.MapFS{name: {Data: []byte(data)}}); err == nil {
+			t.Fatalf("expected an error for %v\n", name)
+		}
+	}
+	dup := []Migration{
+		{Version: 1, Up: func(context.Context, *IndexClient) error { return nil }},
+		{Version: 1, Up: func(context.Context, *IndexClient) error { return nil }},
+	}
+	if _, err := NewMigrator(nil, DryRun()).Run(context.TODO(), dup); err == nil {
+		t.Fatal("expected an error for duplicate versions")
+	}
+}
@@ -0,0 +1,242 @@
+package esmini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	DefaultKeepAlive  = "1m"
+	DefaultTiebreaker = "_shard_doc"
+)
+
+// KeepAlive is how long Elasticsearch keeps a point in time or scroll
+// context alive between two pages, e.g. "1m".
+func KeepAlive(keepAlive string) SearchOption {
+	return func(s *searchOption) {
+		s.keepAlive = keepAlive
+	}
+}
+
+// Tiebreaker is the field appended to the sort of SearchPointInTime so that
+// every hit has a unique sort position. It defaults to "_shard_doc", which
+// needs Elasticsearch 7.12; use a unique keyword field on older clusters.
+func Tiebreaker(field string) SearchOption {
+	return func(s *searchOption) {
+		s.tiebreaker = field
+	}
+}
+
+// PointInTimeIterator iterates over every hit of a query, fetching the next
+// page with search_after against a point in time whenever the current page
+// is exhausted. Sort values in HitMeta are json.Number, so that long values
+// round-trip into search_after exactly.
+type PointInTimeIterator struct {
+	ctx       context.Context
+	client    *elastic.Client
+	source    map[string]interface{}
+	keepAlive string
+
+	mu     sync.Mutex
+	pitID  string
+	page   *HitSourceIterator
+	after  []interface{}
+	last   bool
+	err    error
+	closed chan struct{}
+	once   sync.Once
+}
+
+type pitSearchResult struct {
+	elastic.SearchResult
+	PitID string `json:"pit_id"`
+}
+
+// SearchPointInTime opens a point in time on index and returns an iterator
+// over every hit matching the query, Limit hits per page. The point in time
+// is closed once the last page is read, on Close, or when ctx is done; until
+// then a goroutine watches ctx, so an iterator that is neither drained nor
+// closed keeps it alive for as long as ctx is.
+// Points in time need Elasticsearch 7.10 or later.
+func (s *SearchClient) SearchPointInTime(ctx context.Context, index string, searchText interface{}, targetFields []string, opts ...SearchOption) (*PointInTimeIterator, error) {
+	sOpt := newSearchOption(opts)
+	if sOpt.keepAlive == "" {
+		sOpt.keepAlive = DefaultKeepAlive
+	}
+	if sOpt.tiebreaker == "" {
+		sOpt.tiebreaker = DefaultTiebreaker
+	}
+
+	src, err := sOpt.searchSource(searchText, targetFields)
+	if err != nil {
+		return nil, err
+	}
+	src = src.Size(sOpt.size)
+	if len(sOpt.sortField) == 0 && len(sOpt.sortSpecs) == 0 && searchText != "" {
+		src = src.SortBy(elastic.NewScoreSort())
+	}
+	src = src.SortBy(elastic.NewFieldSort(sOpt.tiebreaker).Asc())
+	body, err := src.Source()
+	if err != nil {
+		return nil, err
+	}
+	source, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("esmini: unexpected search source")
+	}
+
+	res, err := s.iClient.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/" + url.PathEscape(index) + "/_pit",
+		Params: url.Values{"keep_alive": []string{sOpt.keepAlive}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var pit struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(res.Body, &pit); err != nil {
+		return nil, err
+	}
+
+	it := &PointInTimeIterator{
+		ctx:       ctx,
+		client:    s.iClient.raw,
+		source:    source,
+		keepAlive: sOpt.keepAlive,
+		pitID:     pit.ID,
+		page:      &HitSourceIterator{},
+		closed:    make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			it.Close()
+		case <-it.closed:
+		}
+	}()
+	return it, nil
+}
+
+// HasNext reports whether another hit is available, fetching the next page
+// when needed. It returns false on error; check Err.
+func (it *PointInTimeIterator) HasNext() bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	for !it.page.HasNext() {
+		if it.last || it.err != nil {
+			return false
+		}
+		if err := it.fetch(); err != nil {
+			it.err = err
+			it.release(it.pitID)
+			return false
+		}
+	}
+	return true
+}
+
+func (it *PointInTimeIterator) fetch() error {
+	if err := it.ctx.Err(); err != nil {
+		return err
+	}
+
+	body := make(map[string]interface{}, len(it.source)+2)
+	for k, v := range it.source {
+		body[k] = v
+	}
+	body["pit"] = map[string]interface{}{"id": it.pitID, "keep_alive": it.keepAlive}
+	if it.after != nil {
+		body["search_after"] = it.after
+	}
+
+	res, err := it.client.PerformRequest(it.ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/_search",
+		Body:   body,
+	})
+	if err != nil {
+		return err
+	}
+	var result pitSearchResult
+	dec := json.NewDecoder(bytes.NewReader(res.Body))
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		return err
+	}
+	if len(result.PitID) > 0 {
+		it.pitID = result.PitID
+	}
+
+	page := newSearchResponse(&result.SearchResult)
+	it.page = page.NewHitSourceIterator()
+	size, _ := it.source["size"].(int)
+	if len(page.Metadata) == 0 || len(page.Metadata) < size {
+		// The hits of the last page are still returned when the close
+		// fails; Err reports the failure.
+		it.last = true
+		it.err = it.release(it.pitID)
+	}
+	if n := len(page.Metadata); n > 0 {
+		it.after = page.Metadata[n-1].Sort
+	}
+	return nil
+}
+
+func (it *PointInTimeIterator) Next(v interface{}) error {
+	_, err := it.NextWithMeta(v)
+	return err
+}
+
+func (it *PointInTimeIterator) NextWithMeta(v interface{}) (HitMeta, error) {
+	if !it.HasNext() {
+		if err := it.Err(); err != nil {
+			return HitMeta{}, err
+		}
+		return HitMeta{}, errors.New("No next value")
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.page.NextWithMeta(v)
+}
+
+// Err returns the error that stopped the iteration, or the failure to close
+// the point in time after the last page, if any.
+func (it *PointInTimeIterator) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.err
+}
+
+// Close releases the point in time. It is safe to call more than once.
+func (it *PointInTimeIterator) Close() error {
+	it.mu.Lock()
+	pitID := it.pitID
+	it.mu.Unlock()
+	return it.release(pitID)
+}
+
+func (it *PointInTimeIterator) release(pitID string) error {
+	var err error
+	it.once.Do(func() {
+		close(it.closed)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err = it.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: http.MethodDelete,
+			Path:   "/_pit",
+			Body:   map[string]interface{}{"id": pitID},
+		})
+	})
+	return err
+}
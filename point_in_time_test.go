@@ -0,0 +1,149 @@
+package esmini
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func tweetsWithID(n int) []interface{} {
+	docs := make([]interface{}, 0, n)
+	for i := 1; i <= n; i++ {
+		docs = append(docs, tweetWithID{ID: i, Message: "message", Retweets: i, Created: time.Now()})
+	}
+	return docs
+}
+
+func TestSearchPointInTime(t *testing.T) {
+	index := "tweets_with_id"
+	srv, client := setupFake(t, index, tweetsWithID(25)...)
+
+	sClient := NewSearchClient(client)
+	itr, err := sClient.SearchPointInTime(context.TODO(), index, "", nil, Limit(10), SortField("retweets"), Order(Desc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	more := list.New()
+	more.PushBack(tweetWithID{ID: 100, Message: "message", Retweets: 100})
+	if _, err := client.BulkInsert(context.TODO(), index, more, DocID("ID")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 25
+	for itr.HasNext() {
+		var tw tweetWithID
+		meta, err := itr.NextWithMeta(&tw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tw.Retweets != expected {
+			t.Fatalf("expected %v, but got %v\n", expected, tw.Retweets)
+		}
+		if len(meta.Sort) != 2 {
+			t.Fatalf("expected sort and tiebreaker values, but got %v\n", meta.Sort)
+		}
+		expected--
+	}
+	if err := itr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected != 0 {
+		t.Fatalf("expected every hit, but %v were missing\n", expected)
+	}
+	if srv.OpenPointsInTime() != 0 {
+		t.Fatalf("expected %v, but got %v\n", 0, srv.OpenPointsInTime())
+	}
+}
+
+func TestSearchPointInTimeCanceled(t *testing.T) {
+	index := "tweets_with_id"
+	srv, client := setupFake(t, index, tweetsWithID(5)...)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	sClient := NewSearchClient(client)
+	itr, err := sClient.SearchPointInTime(ctx, index, "", nil, Limit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !itr.HasNext() {
+		t.Fatal(itr.Err())
+	}
+	if srv.OpenPointsInTime() != 1 {
+		t.Fatalf("expected %v, but got %v\n", 1, srv.OpenPointsInTime())
+	}
+
+	cancel()
+	for i := 0; i < 100 && srv.OpenPointsInTime() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if srv.OpenPointsInTime() != 0 {
+		t.Fatalf("expected %v, but got %v\n", 0, srv.OpenPointsInTime())
+	}
+
+	for itr.HasNext() {
+		var tw tweetWithID
+		if err := itr.Next(&tw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if itr.Err() != context.Canceled {
+		t.Fatalf("expected %v, but got %v\n", context.Canceled, itr.Err())
+	}
+}
+
+func TestSearchPointInTimeCloseError(t *testing.T) {
+	index := "tweets_with_id"
+	srv, _ := setupFake(t, index, tweetsWithID(5)...)
+
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && r.URL.Path == "/_pit" {
+			http.Error(w, `{"error": {"type": "exception", "reason": "boom"}, "status": 500}`, http.StatusInternalServerError)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+	failingClient, err := New(elastic.SetURL(failing.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer failingClient.Stop()
+
+	itr, err := NewSearchClient(failingClient).SearchPointInTime(context.TODO(), index, "", nil, Limit(10), SortField("retweets"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for itr.HasNext() {
+		var tw tweetWithID
+		meta, err := itr.NextWithMeta(&tw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := meta.Sort[0].(json.Number); !ok {
+			t.Fatalf("expected %T, but got %T\n", json.Number(""), meta.Sort[0])
+		}
+		n++
+	}
+	if n != 5 {
+		t.Fatalf("expected %v, but got %v\n", 5, n)
+	}
+	if itr.Err() == nil {
+		t.Fatal("expected the close error, but got nil")
+	}
+}
@@ -0,0 +1,86 @@
+package esmini
+
+import (
+	"context"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// RefreshPolicy controls when the changes of a write become visible to
+// search.
+type RefreshPolicy string
+
+const (
+	// RefreshTrue refreshes the affected shards right after the write.
+	RefreshTrue RefreshPolicy = "true"
+	// RefreshFalse leaves the changes to the next periodic refresh.
+	RefreshFalse RefreshPolicy = "false"
+	// RefreshWaitFor returns once a refresh has made the changes visible,
+	// without forcing one.
+	RefreshWaitFor RefreshPolicy = "wait_for"
+)
+
+type writeOption struct {
+	refresh       RefreshPolicy
+	routing       string
+	ifSeqNo       *int64
+	ifPrimaryTerm *int64
+	version       *int64
+	update        updateOption
+}
+
+// WriteOption configures a single-document write such as IndexDoc, Update
+// or Delete.
+type WriteOption func(*writeOption)
+
+func newWriteOption(opts []WriteOption) *writeOption {
+	wOpt := &writeOption{}
+	for _, opt := range opts {
+		opt(wOpt)
+	}
+	return wOpt
+}
+
+// Refresh sets the refresh policy of a write, overriding the client's
+// default.
+func Refresh(policy RefreshPolicy) WriteOption {
+	return func(w *writeOption) {
+		w.refresh = policy
+	}
+}
+
+// BulkRefresh sets the refresh policy of the requests sent by BulkInsert,
+// its variants and Bulk. NewBulkIndexer rejects it, and its requests ignore
+// the client's default; call Refresh after Flush instead.
+func BulkRefresh(policy RefreshPolicy) BulkOption {
+	return func(b *bulkOption) {
+		b.refresh = policy
+	}
+}
+
+// WithRefresh returns a client sharing i's connection whose writes use
+// policy unless a call sets its own. Without a default, Update and Delete
+// refresh and bulk requests do not.
+func (i *IndexClient) WithRefresh(policy RefreshPolicy) *IndexClient {
+	c := *i
+	c.refresh = policy
+	return &c
+}
+
+// refreshPolicy returns the policy a write uses: its own, the client's
+// default, or fallback.
+func (i *IndexClient) refreshPolicy(policy, fallback RefreshPolicy) string {
+	switch {
+	case len(policy) > 0:
+		return string(policy)
+	case len(i.refresh) > 0:
+		return string(i.refresh)
+	}
+	return string(fallback)
+}
+
+// Refresh makes every change made to indices visible to search. Without
+// indices, all indices are refreshed.
+func (i *IndexClient) Refresh(ctx context.Context, indices ...string) (*elastic.RefreshResult, error) {
+	return i.raw.Refresh(indices...).Do(ctx)
+}
@@ -0,0 +1,64 @@
+package esmini
+
+import (
+	"context"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestRefreshPolicy(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	steps := []struct {
+		name     string
+		write    func() error
+		expected int
+	}{
+		{"bulk without refresh", func() error {
+			_, err := client.Bulk(ctx, index, []*BulkAction{IndexAction(counter{ID: "1"}), IndexAction(counter{ID: "2"})})
+			return err
+		}, 0},
+		{"bulk with wait_for", func() error {
+			_, err := BulkInsertSlice(ctx, client, index, []counter{{ID: "3"}}, BulkRefresh(RefreshWaitFor))
+			return err
+		}, 1},
+		{"update refreshes by default", func() error {
+			_, err := client.Update(ctx, index, "1", map[string]interface{}{"count": 1})
+			return err
+		}, 2},
+		{"delete without refresh", func() error {
+			_, err := client.Delete(ctx, index, "2", Refresh(RefreshFalse))
+			return err
+		}, 2},
+		{"client default", func() error {
+			_, err := client.WithRefresh(RefreshFalse).Update(ctx, index, "1", map[string]interface{}{"count": 2})
+			return err
+		}, 2},
+		{"call overrides client default", func() error {
+			_, err := client.WithRefresh(RefreshFalse).Delete(ctx, index, "1", Refresh(RefreshTrue))
+			return err
+		}, 3},
+		{"explicit refresh", func() error {
+			_, err := client.Refresh(ctx, index)
+			return err
+		}, 4},
+	}
+	for _, step := range steps {
+		if err := step.write(); err != nil {
+			t.Fatalf("%s: %v\n", step.name, err)
+		}
+		if srv.Refreshes() != step.expected {
+			t.Fatalf("%s: expected %v refreshes, but got %v\n", step.name, step.expected, srv.Refreshes())
+		}
+	}
+
+	if _, err := client.Update(ctx, index, "3", map[string]interface{}{"count": 3}, Refresh("soon")); err == nil {
+		t.Fatal("expected an error for an unknown refresh policy")
+	}
+	if _, err := client.Refresh(ctx, "missing"); !elastic.IsNotFound(err) {
+		t.Fatalf("expected not found error, but got %v\n", err)
+	}
+}
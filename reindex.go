@@ -0,0 +1,74 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+)
+
+type reindexOption struct {
+	clauses  []BoolQueriesWithClauseOption
+	script   *Script
+	pipeline string
+}
+
+// ReindexQuery copies only the source documents matching every clause.
+func ReindexQuery(clauses []BoolQueriesWithClauseOption) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.reindex.clauses = clauses
+	}
+}
+
+// ReindexScript runs script on every source document before it is written
+// to the destination. The script can change ctx._source, or skip the
+// document by setting ctx.op to "noop".
+func ReindexScript(script Script) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.reindex.script = &script
+	}
+}
+
+// ReindexPipeline sends the documents through the ingest pipeline of that
+// name on their way to the destination, after ReindexScript.
+func ReindexPipeline(pipeline string) ByQueryOption {
+	return func(b *byQueryOption) {
+		b.reindex.pipeline = pipeline
+	}
+}
+
+// Reindex copies the documents of source into dest, e.g. an index created
+// with CreateIndexWithMapping for a changed mapping, keeping their IDs.
+// It runs in the background; use the returned Task to follow, throttle,
+// cancel or wait for it. Documents changed in source after the start are
+// copied as they were.
+func (i *IndexClient) Reindex(ctx context.Context, source, dest string, opts ...ByQueryOption) (*Task, error) {
+	if len(source) == 0 || len(dest) == 0 {
+		return nil, errors.New("esmini: reindex needs a source and a destination index")
+	}
+	bOpt := newByQueryOption(opts)
+
+	src := map[string]interface{}{"index": source}
+	if len(bOpt.reindex.clauses) > 0 {
+		query, err := byQueryBody(bOpt.reindex.clauses, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		src["query"] = query["query"]
+	}
+	if bOpt.batchSize > 0 {
+		src["size"] = bOpt.batchSize
+	}
+	dst := map[string]interface{}{"index": dest}
+	if len(bOpt.reindex.pipeline) > 0 {
+		dst["pipeline"] = bOpt.reindex.pipeline
+	}
+	body, err := byQueryBody(nil, bOpt.reindex.script, false)
+	if err != nil {
+		return nil, err
+	}
+	body["source"] = src
+	body["dest"] = dst
+	if bOpt.proceed {
+		body["conflicts"] = "proceed"
+	}
+	return i.startTask(ctx, "/_reindex", "_reindex", i.taskParams(bOpt), body)
+}
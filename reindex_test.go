@@ -0,0 +1,84 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReindex(t *testing.T) {
+	srv, client := setupFake(t, "counters", counters(6)...)
+
+	ctx := context.TODO()
+	if _, err := client.raw.IngestPutPipeline("migrate").BodyString(`{
+		"processors": [
+			{"set": {"field": "migrated", "value": true}},
+			{"rename": {"field": "tags", "target_field": "labels"}}
+		]
+	}`).Do(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := client.Reindex(ctx, "counters", "counters-v2",
+		ReindexQuery([]BoolQueriesWithClauseOption{{Target: "tags", Query: "even"}}),
+		ReindexScript(Script{Source: "ctx._source.count += params.n", Params: map[string]interface{}{"n": 100}}),
+		ReindexPipeline("migrate"),
+		BatchSize(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progress []int64
+	res, err := task.Wait(ctx, time.Millisecond, func(s *TaskStatus) {
+		progress = append(progress, s.Created)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || res.Created != 3 || len(progress) != 3 || progress[0] != 1 {
+		t.Fatalf("expected %v created over %v polls, but got %v and %v\n", 3, 3, res.Created, progress)
+	}
+	var doc map[string]interface{}
+	if _, err := client.Get(ctx, "counters-v2", "4", &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["count"] != float64(104) || doc["migrated"] != true || doc["labels"] == nil || doc["tags"] != nil {
+		t.Fatalf("unexpected reindexed document %v\n", doc)
+	}
+	if srv.DocCount("counters") != 6 {
+		t.Fatalf("expected %v, but got %v\n", 6, srv.DocCount("counters"))
+	}
+
+	task, err = client.Reindex(ctx, "counters", "counters-v2", BatchSize(2), RequestsPerSecond(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := task.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Action != "indices:data/write/reindex" || status.Created != 1 || status.Updated != 1 || status.RequestsPerSecond != 10 {
+		t.Fatalf("expected %v created and %v updated, but got %v\n", 1, 1, status)
+	}
+	if err := task.Rethrottle(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := task.Cancel(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err = task.Wait(ctx, time.Millisecond, nil)
+	if !errors.Is(err, ErrTaskCanceled) || res.RequestsPerSecond != -1 || srv.DocCount("counters-v2") != 4 {
+		t.Fatalf("expected %v, but got %v\n", ErrTaskCanceled, err)
+	}
+
+	if _, err := client.Reindex(ctx, "counters", "counters-v3", ReindexPipeline("missing")); err == nil {
+		t.Fatal("expected an error for a missing pipeline")
+	}
+	if _, err := client.Reindex(ctx, "counters", "counters"); err == nil {
+		t.Fatal("expected an error for reindexing into the source")
+	}
+	if _, err := client.Reindex(ctx, "counters", ""); err == nil {
+		t.Fatal("expected an error without a destination")
+	}
+}
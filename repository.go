@@ -0,0 +1,138 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Repository stores documents of type T in one index. IDs, routing and
+// versions are read from the esmini struct tags of T, see TagName.
+//
+//	repo := esmini.NewRepository[tweet](client, "tweets")
+//	if _, err := repo.Save(ctx, tweet{ID: "1", User: "alice"}); err != nil {
+//		...
+//	}
+//	res, err := repo.Search(ctx, "alice", []string{"user"})
+type Repository[T any] struct {
+	client *IndexClient
+	index  string
+}
+
+func NewRepository[T any](client *IndexClient, index string) *Repository[T] {
+	return &Repository[T]{client: client, index: index}
+}
+
+func (r *Repository[T]) Index() string {
+	return r.index
+}
+
+// Save indexes doc, overwriting any document with the same ID. Documents
+// without an ID field get one generated, which the response holds.
+func (r *Repository[T]) Save(ctx context.Context, doc T, opts ...WriteOption) (*elastic.IndexResponse, error) {
+	return r.client.IndexDoc(ctx, r.index, doc, opts...)
+}
+
+// SaveAll indexes docs in one bulk request. Failed documents are reported
+// by a *BulkError like BulkInsert.
+func (r *Repository[T]) SaveAll(ctx context.Context, docs []T, opts ...BulkOption) (*elastic.BulkResponse, error) {
+	bulkOpt := &bulkOption{}
+	for _, opt := range opts {
+		opt(bulkOpt)
+	}
+
+	reqs := make([]elastic.BulkableRequest, 0, len(docs))
+	for _, doc := range docs {
+		req, err := newBulkIndexRequest(r.index, doc, bulkOpt)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return r.client.bulk(ctx, r.index, reqs, bulkOpt)
+}
+
+// Get returns the document id. A missing document returns a
+// *NotFoundError.
+func (r *Repository[T]) Get(ctx context.Context, id string, opts ...GetOption) (T, error) {
+	var doc T
+	if _, err := r.client.Get(ctx, r.index, id, &doc, opts...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return doc, nil
+}
+
+// Delete removes the document id. A missing document returns a
+// *NotFoundError.
+func (r *Repository[T]) Delete(ctx context.Context, id string, opts ...WriteOption) error {
+	_, err := r.client.Delete(ctx, r.index, id, opts...)
+	if isDocumentMissing(err) {
+		return &NotFoundError{Index: r.index, IDs: []string{id}}
+	}
+	return err
+}
+
+// Update merges fields, a map or a T of which only the non-zero fields
+// count, into the document id, leaving the other fields as they are. A
+// missing document returns a *NotFoundError.
+func (r *Repository[T]) Update(ctx context.Context, id string, fields interface{}, opts ...WriteOption) error {
+	_, err := r.client.Update(ctx, r.index, id, fields, opts...)
+	if isDocumentMissing(err) {
+		return &NotFoundError{Index: r.index, IDs: []string{id}}
+	}
+	return err
+}
+
+// Modify changes the document id with modify and saves it, retrying on
+// conflicting writes like ReadModifyWrite.
+func (r *Repository[T]) Modify(ctx context.Context, id string, retries int, modify func(*T) error, opts ...WriteOption) (*elastic.IndexResponse, error) {
+	return ReadModifyWrite(ctx, r.client, r.index, id, retries, modify, opts...)
+}
+
+// TypedSearchResponse is a SearchResponse with the hits decoded into T.
+// Docs and Metadata are in hit order.
+type TypedSearchResponse[T any] struct {
+	TotalHits    int64
+	Docs         []T
+	Metadata     []HitMeta
+	Aggregations Aggregations
+}
+
+// Search runs a SearchClient search on the repository's index and decodes
+// every hit.
+func (r *Repository[T]) Search(ctx context.Context, searchText interface{}, targetFields []string, opts ...SearchOption) (*TypedSearchResponse[T], error) {
+	res, err := NewSearchClient(r.client).Search(ctx, r.index, searchText, targetFields, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := &TypedSearchResponse[T]{
+		TotalHits:    res.TotalHits,
+		Docs:         make([]T, 0, len(res.Sources)),
+		Metadata:     res.Metadata,
+		Aggregations: res.Aggregations,
+	}
+	for j, source := range res.Sources {
+		var doc T
+		if len(source) > 0 {
+			if err := json.Unmarshal(source, &doc); err != nil {
+				return nil, fmt.Errorf("esmini: decode hit %s: %w", res.Metadata[j].ID, err)
+			}
+		}
+		typed.Docs = append(typed.Docs, doc)
+	}
+	return typed, nil
+}
+
+// Count returns how many documents match the query Search would run for
+// the same arguments. Paging, sorting and aggregation options are ignored.
+func (r *Repository[T]) Count(ctx context.Context, searchText interface{}, targetFields []string, opts ...SearchOption) (int64, error) {
+	query, err := newSearchOption(opts).query(searchText, targetFields)
+	if err != nil {
+		return 0, err
+	}
+	return r.client.raw.Count(r.index).Query(query).Do(ctx)
+}
@@ -0,0 +1,85 @@
+package esmini
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRepository(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	if _, err := client.CreateIndexFor(ctx, "products", product{}); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRepository[product](client, "products")
+
+	if _, err := repo.SaveAll(ctx, []product{
+		{ID: "1", Name: "red shirt", Category: "shirts", Price: 10},
+		{ID: "2", Name: "blue shirt", Category: "shirts", Price: 25},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := repo.Save(ctx, product{ID: "3", Name: "red shoes", Category: "shoes", Price: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Id != "3" {
+		t.Fatalf("expected %v, but got %v\n", "3", res.Id)
+	}
+
+	p, err := repo.Get(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "blue shirt" {
+		t.Fatalf("expected %v, but got %v\n", "blue shirt", p.Name)
+	}
+
+	if err := repo.Update(ctx, "2", map[string]interface{}{"price": 20}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = repo.Get(ctx, "2"); p.Price != 20 || p.Name != "blue shirt" {
+		t.Fatalf("expected %v for %v, but got %v\n", 20, "blue shirt", p)
+	}
+
+	found, err := repo.Search(ctx, "red", []string{"name"}, SortField("price"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, doc := range found.Docs {
+		names = append(names, doc.Name)
+	}
+	if found.TotalHits != 2 || !reflect.DeepEqual(names, []string{"red shirt", "red shoes"}) || found.Metadata[1].ID != "3" {
+		t.Fatalf("expected %v, but got %v\n", []string{"red shirt", "red shoes"}, names)
+	}
+
+	count, err := repo.Count(ctx, "", nil, BoolQueriesWithClause([]BoolQueriesWithClauseOption{
+		{Target: "category", Query: "shirts", Clause: "filter"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected %v, but got %v\n", 2, count)
+	}
+
+	if err := repo.Delete(ctx, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v\n", ErrNotFound, err)
+	}
+	if err := repo.Delete(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v\n", ErrNotFound, err)
+	}
+	if err := repo.Update(ctx, "1", map[string]interface{}{"price": 1}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, but got %v\n", ErrNotFound, err)
+	}
+	if _, err := repo.SaveAll(ctx, []product{{Name: "no id"}}, DocID("ID")); !errors.Is(err, ErrZeroDocID) {
+		t.Fatalf("expected %v, but got %v\n", ErrZeroDocID, err)
+	}
+}
@@ -0,0 +1,18 @@
+package esmini
+
+import "github.com/olivere/elastic/v7"
+
+// Script is a Painless script run by scripted updates, update_by_query and
+// reindex. Params are exposed to the script as params.<name>.
+type Script struct {
+	Source string
+	Params map[string]interface{}
+}
+
+func (s *Script) build() *elastic.Script {
+	script := elastic.NewScript(s.Source).Lang("painless")
+	if len(s.Params) > 0 {
+		script = script.Params(s.Params)
+	}
+	return script
+}
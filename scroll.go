@@ -0,0 +1,216 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Slices splits a Scroll into n slices scrolled in parallel, one worker per
+// slice. Values below 2 scroll in a single request stream.
+func Slices(n int) SearchOption {
+	return func(s *searchOption) {
+		s.slices = n
+	}
+}
+
+// ScrollIterator iterates over every hit of a query using the scroll API,
+// Limit hits per page. Hits of sliced scrolls arrive in no particular order.
+type ScrollIterator struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	hits   chan scrollHit
+	done   chan struct{}
+
+	mu       sync.Mutex
+	cur      *scrollHit
+	err      error
+	clearErr error
+}
+
+type scrollHit struct {
+	source json.RawMessage
+	meta   HitMeta
+}
+
+// Scroll starts scrolling over every hit on index matching the query and
+// returns an iterator over them. The scroll contexts are cleared once the
+// last page is read, on error, on Close, or when ctx is done; a first page
+// still in flight when ctx is done cannot be cleared and expires after
+// KeepAlive instead. Call Close when stopping before the last hit.
+func (s *SearchClient) Scroll(ctx context.Context, index string, searchText interface{}, targetFields []string, opts ...SearchOption) (*ScrollIterator, error) {
+	sOpt := newSearchOption(opts)
+	if sOpt.size < 1 {
+		return nil, fmt.Errorf("esmini: scroll page size must be positive, got %d", sOpt.size)
+	}
+	if sOpt.keepAlive == "" {
+		sOpt.keepAlive = DefaultKeepAlive
+	}
+	slices := sOpt.slices
+	if slices < 2 {
+		slices = 1
+	}
+	src, err := sOpt.searchSource(searchText, targetFields)
+	if err != nil {
+		return nil, err
+	}
+
+	scrollCtx, cancel := context.WithCancel(ctx)
+	it := &ScrollIterator{
+		parent: ctx,
+		ctx:    scrollCtx,
+		cancel: cancel,
+		hits:   make(chan scrollHit, sOpt.size),
+		done:   make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	for id := 0; id < slices; id++ {
+		// Every slice needs its own source, the scroll service adds to it.
+		if id > 0 {
+			src, _ = sOpt.searchSource(searchText, targetFields)
+		}
+		svc := s.iClient.raw.Scroll(index).
+			SearchSource(src).
+			Size(sOpt.size).
+			KeepAlive(sOpt.keepAlive)
+		if slices > 1 {
+			svc = svc.Slice(elastic.NewSliceQuery().Id(id).Max(slices))
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			it.scroll(svc)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(it.hits)
+		close(it.done)
+	}()
+	return it, nil
+}
+
+func (it *ScrollIterator) scroll(svc *elastic.ScrollService) {
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := svc.Clear(ctx); err != nil {
+			it.mu.Lock()
+			if it.clearErr == nil {
+				it.clearErr = err
+			}
+			it.mu.Unlock()
+		}
+	}()
+
+	for {
+		res, err := svc.Do(it.ctx)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			it.fail(err)
+			return
+		}
+		page := newSearchResponse(res)
+		for j, source := range page.Sources {
+			select {
+			case it.hits <- scrollHit{source: source, meta: page.Metadata[j]}:
+			case <-it.ctx.Done():
+				it.fail(it.ctx.Err())
+				return
+			}
+		}
+	}
+}
+
+// fail records the first error and stops the other slices. Cancellations
+// caused by Close rather than the caller's context are not reported.
+func (it *ScrollIterator) fail(err error) {
+	if it.ctx.Err() != nil {
+		if err = it.parent.Err(); err == nil {
+			return
+		}
+	}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if it.err == nil {
+		it.err = err
+	}
+	it.cancel()
+}
+
+// HasNext reports whether another hit is available, waiting for the next
+// page when needed. It returns false on error; check Err.
+func (it *ScrollIterator) HasNext() bool {
+	it.mu.Lock()
+	cur := it.cur
+	it.mu.Unlock()
+	if cur != nil {
+		return true
+	}
+
+	hit, ok := <-it.hits
+	if !ok {
+		return false
+	}
+	it.mu.Lock()
+	it.cur = &hit
+	it.mu.Unlock()
+	return true
+}
+
+func (it *ScrollIterator) Next(v interface{}) error {
+	_, err := it.NextWithMeta(v)
+	return err
+}
+
+// NextWithMeta decodes the next hit into v, and returns its metadata. Hits
+// without a source, as with NoSource, leave v untouched.
+func (it *ScrollIterator) NextWithMeta(v interface{}) (HitMeta, error) {
+	if !it.HasNext() {
+		if err := it.Err(); err != nil {
+			return HitMeta{}, err
+		}
+		return HitMeta{}, errors.New("No next value")
+	}
+	it.mu.Lock()
+	hit := it.cur
+	it.cur = nil
+	it.mu.Unlock()
+
+	if len(hit.source) == 0 {
+		return hit.meta, nil
+	}
+	if err := json.Unmarshal(hit.source, v); err != nil {
+		return HitMeta{}, err
+	}
+	return hit.meta, nil
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ScrollIterator) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.err
+}
+
+// Close stops scrolling and waits until every scroll context is cleared. It
+// is safe to call more than once.
+func (it *ScrollIterator) Close() error {
+	it.cancel()
+	for range it.hits {
+	}
+	<-it.done
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.clearErr
+}
@@ -0,0 +1,149 @@
+package esmini
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScroll(t *testing.T) {
+	index := "tweets_with_id"
+	srv, client := setupFake(t, index, tweetsWithID(25)...)
+
+	sClient := NewSearchClient(client)
+	tests := []struct {
+		name string
+		opts []SearchOption
+	}{
+		{"single", []SearchOption{Limit(10)}},
+		{"sliced", []SearchOption{Limit(3), Slices(3)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itr, err := sClient.Scroll(context.TODO(), index, "", nil, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer itr.Close()
+
+			seen := map[int]bool{}
+			for itr.HasNext() {
+				var tw tweetWithID
+				meta, err := itr.NextWithMeta(&tw)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if seen[tw.ID] {
+					t.Fatalf("expected each hit once, but got %v twice\n", tw.ID)
+				}
+				if meta.Index != index {
+					t.Fatalf("expected %v, but got %v\n", index, meta.Index)
+				}
+				seen[tw.ID] = true
+			}
+			if err := itr.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if len(seen) != 25 {
+				t.Fatalf("expected %v, but got %v\n", 25, len(seen))
+			}
+			if err := itr.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if srv.OpenScrolls() != 0 {
+				t.Fatalf("expected %v, but got %v\n", 0, srv.OpenScrolls())
+			}
+		})
+	}
+}
+
+func TestScrollCanceled(t *testing.T) {
+	index := "tweets_with_id"
+	srv, client := setupFake(t, index, tweetsWithID(10)...)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	sClient := NewSearchClient(client)
+	itr, err := sClient.Scroll(ctx, index, "", nil, Limit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !itr.HasNext() {
+		t.Fatal(itr.Err())
+	}
+
+	cancel()
+	for itr.HasNext() {
+		var tw tweetWithID
+		if err := itr.Next(&tw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if itr.Err() != context.Canceled {
+		t.Fatalf("expected %v, but got %v\n", context.Canceled, itr.Err())
+	}
+	for i := 0; i < 100 && srv.OpenScrolls() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if srv.OpenScrolls() != 0 {
+		t.Fatalf("expected %v, but got %v\n", 0, srv.OpenScrolls())
+	}
+}
+
+func TestScrollClose(t *testing.T) {
+	index := "tweets_with_id"
+	srv, client := setupFake(t, index, tweetsWithID(10)...)
+
+	sClient := NewSearchClient(client)
+	itr, err := sClient.Scroll(context.TODO(), index, "", nil, Limit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tw tweetWithID
+	if err := itr.Next(&tw); err != nil {
+		t.Fatal(err)
+	}
+	if err := itr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := itr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if srv.OpenScrolls() != 0 {
+		t.Fatalf("expected %v, but got %v\n", 0, srv.OpenScrolls())
+	}
+}
+
+func TestScrollNoSource(t *testing.T) {
+	index := "tweets_with_id"
+	_, client := setupFake(t, index, tweetsWithID(5)...)
+
+	sClient := NewSearchClient(client)
+	if _, err := sClient.Scroll(context.TODO(), index, "", nil, Limit(-1)); err == nil {
+		t.Fatal("expected an error for a negative page size")
+	}
+	itr, err := sClient.Scroll(context.TODO(), index, "", nil, Limit(2), NoSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+
+	ids := map[string]bool{}
+	for itr.HasNext() {
+		var tw tweetWithID
+		meta, err := itr.NextWithMeta(&tw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tw.ID != 0 {
+			t.Fatalf("expected %v, but got %v\n", 0, tw.ID)
+		}
+		ids[meta.ID] = true
+	}
+	if err := itr.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 5 {
+		t.Fatalf("expected %v, but got %v\n", 5, len(ids))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/olivere/elastic/v7"
 )
@@ -13,10 +14,60 @@ type SearchClient struct {
 }
 
 type SearchResponse struct {
-	TotalHits int64
-	Hits      int64
-	Sources   []json.RawMessage
-	index     int
+	TotalHits    int64
+	Hits         int64
+	Sources      []json.RawMessage
+	Metadata     []HitMeta
+	Aggregations Aggregations
+	index        int
+}
+
+// HitMeta holds everything Elasticsearch returns about a hit besides its
+// source. Score is nil when sorting by a field.
+type HitMeta struct {
+	ID             string
+	Index          string
+	Score          *float64
+	Routing        string
+	Version        *int64
+	SeqNo          *int64
+	PrimaryTerm    *int64
+	Sort           []interface{}
+	Highlight      map[string][]string
+	MatchedQueries []string
+	// Fields holds the values of DocValueFields and StoredFields.
+	Fields map[string][]interface{}
+}
+
+func newHitMeta(hit *elastic.SearchHit) HitMeta {
+	return HitMeta{
+		ID:             hit.Id,
+		Index:          hit.Index,
+		Score:          hit.Score,
+		Routing:        hit.Routing,
+		Version:        hit.Version,
+		SeqNo:          hit.SeqNo,
+		PrimaryTerm:    hit.PrimaryTerm,
+		Sort:           hit.Sort,
+		Highlight:      hit.Highlight,
+		MatchedQueries: hit.MatchedQueries,
+		Fields:         hitFields(hit.Fields),
+	}
+}
+
+func hitFields(fields map[string]interface{}) map[string][]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	out := make(map[string][]interface{}, len(fields))
+	for name, v := range fields {
+		if values, ok := v.([]interface{}); ok {
+			out[name] = values
+		} else {
+			out[name] = []interface{}{v}
+		}
+	}
+	return out
 }
 
 type SearchOrder int
@@ -41,6 +92,17 @@ type searchOption struct {
 	fuzziness             string
 	minimumShouldMatch    string
 	boolQueriesWithClause []BoolQueriesWithClauseOption
+	keepAlive             string
+	tiebreaker            string
+	slices                int
+	aggs                  []namedAgg
+	highlight             *HighlightOption
+	sortSpecs             []SortSpec
+	sourceIncludes        []string
+	sourceExcludes        []string
+	noSource              bool
+	docValueFields        []string
+	storedFields          []string
 }
 
 type SearchOption func(*searchOption)
@@ -93,6 +155,25 @@ type BoolQueriesWithClauseOption struct {
 	Target string
 	Query  interface{}
 	Clause string // Clause can be "must", "should", "must_not", "filter"
+	// Type can be "term", "terms", "range", "exists", "prefix", "wildcard",
+	// "regexp", "ids", "match", "match_phrase" or "bool". When empty, a term
+	// query is built, or a terms query when Query is a []interface{}.
+	//
+	// Range queries take a Range as Query, ids queries a []string, and bool
+	// groups a []BoolQueriesWithClauseOption. Target is unused by ids and
+	// bool.
+	Type string
+}
+
+// Range is the Query of a "range" clause. Bounds can be numbers, strings,
+// dates or date math such as "now-7d/d"; nil bounds are left open.
+type Range struct {
+	Gt       interface{}
+	Gte      interface{}
+	Lt       interface{}
+	Lte      interface{}
+	Format   string
+	TimeZone string
 }
 
 func BoolQueriesWithClause(boolQueries []BoolQueriesWithClauseOption) SearchOption {
@@ -107,7 +188,7 @@ func NewSearchClient(client *IndexClient) *SearchClient {
 	}
 }
 
-func (s *SearchClient) Search(ctx context.Context, index string, searchText interface{}, targetFields []string, opts ...SearchOption) (SearchResponse, error) {
+func newSearchOption(opts []SearchOption) *searchOption {
 	sOpt := &searchOption{
 		size:      DefaultSize,
 		from:      DefaultFrom,
@@ -116,7 +197,10 @@ func (s *SearchClient) Search(ctx context.Context, index string, searchText inte
 	for _, opt := range opts {
 		opt(sOpt)
 	}
+	return sOpt
+}
 
+func (sOpt *searchOption) query(searchText interface{}, targetFields []string) (*elastic.BoolQuery, error) {
 	query := elastic.NewBoolQuery()
 	if searchText != "" {
 		multiMatchQuery := elastic.NewMultiMatchQuery(searchText, targetFields...).Type(sOpt.matchType)
@@ -128,93 +212,228 @@ func (s *SearchClient) Search(ctx context.Context, index string, searchText inte
 		query.Must(multiMatchQuery)
 	}
 
-	if len(sOpt.boolQueriesWithClause) > 0 {
-		for _, v := range sOpt.boolQueriesWithClause {
-			var termQuery *elastic.TermQuery
-			if values, ok := v.Query.([]interface{}); ok {
-				termsQuery := elastic.NewTermsQuery(v.Target, values...)
-				switch v.Clause {
-				case "must":
-					query.Must(termsQuery)
-				case "should":
-					query.Should(termsQuery)
-				case "must_not":
-					query.MustNot(termsQuery)
-				case "filter":
-					query.Filter(termsQuery)
-				default:
-					query.Filter(termsQuery)
-				}
-			} else {
-				termQuery = elastic.NewTermQuery(v.Target, v.Query)
-				switch v.Clause {
-				case "must":
-					query.Must(termQuery)
-				case "should":
-					query.Should(termQuery)
-				case "must_not":
-					query.MustNot(termQuery)
-				case "filter":
-					query.Filter(termQuery)
-				default:
-					query.Filter(termQuery)
-				}
-			}
+	if err := addBoolClauses(query, sOpt.boolQueriesWithClause); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+func addBoolClauses(query *elastic.BoolQuery, clauses []BoolQueriesWithClauseOption) error {
+	for _, v := range clauses {
+		q, err := v.query()
+		if err != nil {
+			return err
+		}
+		switch v.Clause {
+		case "must":
+			query.Must(q)
+		case "should":
+			query.Should(q)
+		case "must_not":
+			query.MustNot(q)
+		case "filter":
+			query.Filter(q)
+		default:
+			query.Filter(q)
 		}
 	}
+	return nil
+}
 
-	var sortQuery *elastic.FieldSort
-	var res *elastic.SearchResult
-	var err error
-	var result SearchResponse
+func (v BoolQueriesWithClauseOption) query() (elastic.Query, error) {
+	typ := v.Type
+	if typ == "" {
+		typ = "term"
+		if _, ok := v.Query.([]interface{}); ok {
+			typ = "terms"
+		}
+	}
+
+	switch typ {
+	case "term":
+		return elastic.NewTermQuery(v.Target, v.Query), nil
+	case "terms":
+		values, ok := v.Query.([]interface{})
+		if !ok {
+			values = []interface{}{v.Query}
+		}
+		return elastic.NewTermsQuery(v.Target, values...), nil
+	case "range":
+		var r Range
+		switch t := v.Query.(type) {
+		case Range:
+			r = t
+		case *Range:
+			r = *t
+		default:
+			return nil, fmt.Errorf("esmini: range clause on %s needs a Range query, got %T", v.Target, v.Query)
+		}
+		q := elastic.NewRangeQuery(v.Target)
+		if r.Gt != nil {
+			q.Gt(r.Gt)
+		}
+		if r.Gte != nil {
+			q.Gte(r.Gte)
+		}
+		if r.Lt != nil {
+			q.Lt(r.Lt)
+		}
+		if r.Lte != nil {
+			q.Lte(r.Lte)
+		}
+		if len(r.Format) > 0 {
+			q.Format(r.Format)
+		}
+		if len(r.TimeZone) > 0 {
+			q.TimeZone(r.TimeZone)
+		}
+		return q, nil
+	case "exists":
+		return elastic.NewExistsQuery(v.Target), nil
+	case "prefix":
+		return elastic.NewPrefixQuery(v.Target, fmt.Sprint(v.Query)), nil
+	case "wildcard":
+		return elastic.NewWildcardQuery(v.Target, fmt.Sprint(v.Query)), nil
+	case "regexp":
+		return elastic.NewRegexpQuery(v.Target, fmt.Sprint(v.Query)), nil
+	case "ids":
+		switch ids := v.Query.(type) {
+		case []string:
+			return elastic.NewIdsQuery().Ids(ids...), nil
+		case string:
+			return elastic.NewIdsQuery().Ids(ids), nil
+		case []interface{}:
+			q := elastic.NewIdsQuery()
+			for _, id := range ids {
+				q.Ids(fmt.Sprint(id))
+			}
+			return q, nil
+		}
+		return nil, fmt.Errorf("esmini: ids clause needs a []string query, got %T", v.Query)
+	case "match":
+		return elastic.NewMatchQuery(v.Target, v.Query), nil
+	case "match_phrase":
+		return elastic.NewMatchPhraseQuery(v.Target, v.Query), nil
+	case "bool":
+		clauses, ok := v.Query.([]BoolQueriesWithClauseOption)
+		if !ok {
+			return nil, fmt.Errorf("esmini: bool clause needs a []BoolQueriesWithClauseOption query, got %T", v.Query)
+		}
+		q := elastic.NewBoolQuery()
+		if err := addBoolClauses(q, clauses); err != nil {
+			return nil, err
+		}
+		return q, nil
+	}
+	return nil, fmt.Errorf("esmini: unknown bool clause type %q", v.Type)
+}
 
+func (sOpt *searchOption) sorters() ([]elastic.Sorter, error) {
+	var sorters []elastic.Sorter
 	if len(sOpt.sortField) > 0 {
 		if sOpt.order == Asc {
-			sortQuery = elastic.NewFieldSort(sOpt.sortField).Asc()
+			sorters = append(sorters, elastic.NewFieldSort(sOpt.sortField).Asc())
 		} else {
-			sortQuery = elastic.NewFieldSort(sOpt.sortField).Desc()
+			sorters = append(sorters, elastic.NewFieldSort(sOpt.sortField).Desc())
 		}
-		res, err = s.iClient.raw.Search().
-			Index(index).
-			Query(query).
-			SortBy(sortQuery).
-			From(sOpt.from).Size(sOpt.size).
-			Do(ctx)
-
+	}
+	for _, spec := range sOpt.sortSpecs {
+		sorter, err := spec.sorter()
 		if err != nil {
-			return result, err
+			return nil, err
 		}
-	} else {
-		res, err = s.iClient.raw.Search().
-			Index(index).
-			Query(query).
-			From(sOpt.from).Size(sOpt.size).
-			Do(ctx)
+		sorters = append(sorters, sorter)
+	}
+	return sorters, nil
+}
 
-		if err != nil {
-			return result, err
-		}
+// searchSource builds the request body shared by every search flavour.
+func (sOpt *searchOption) searchSource(searchText interface{}, targetFields []string) (*elastic.SearchSource, error) {
+	query, err := sOpt.query(searchText, targetFields)
+	if err != nil {
+		return nil, err
+	}
+	sorters, err := sOpt.sorters()
+	if err != nil {
+		return nil, err
+	}
+	src := elastic.NewSearchSource().
+		Query(query).
+		SortBy(sorters...).
+		Version(true).
+		SeqNoAndPrimaryTerm(true)
+	for _, a := range sOpt.aggs {
+		src = src.Aggregation(a.name, a.agg.build())
+	}
+	if sOpt.highlight != nil {
+		src = src.Highlight(sOpt.highlight.build())
+	}
+	switch {
+	case sOpt.noSource:
+		src = src.FetchSource(false)
+	case len(sOpt.sourceIncludes) > 0 || len(sOpt.sourceExcludes) > 0:
+		src = src.FetchSourceIncludeExclude(sOpt.sourceIncludes, sOpt.sourceExcludes)
+	case len(sOpt.storedFields) > 0:
+		// stored_fields alone would drop the source.
+		src = src.FetchSource(true)
+	}
+	if len(sOpt.docValueFields) > 0 {
+		src = src.DocvalueFields(sOpt.docValueFields...)
 	}
+	if len(sOpt.storedFields) > 0 {
+		src = src.StoredFields(sOpt.storedFields...)
+	}
+	return src, nil
+}
 
+func newSearchResponse(res *elastic.SearchResult) SearchResponse {
+	var result SearchResponse
 	result.TotalHits = res.TotalHits()
+	if len(res.Aggregations) > 0 {
+		result.Aggregations = Aggregations(res.Aggregations)
+	}
+	if res.Hits == nil {
+		return result
+	}
 	result.Hits = int64(len(res.Hits.Hits))
 
 	for _, hit := range res.Hits.Hits {
 		result.Sources = append(result.Sources, hit.Source)
+		result.Metadata = append(result.Metadata, newHitMeta(hit))
 	}
+	return result
+}
+
+func (s *SearchClient) Search(ctx context.Context, index string, searchText interface{}, targetFields []string, opts ...SearchOption) (SearchResponse, error) {
+	sOpt := newSearchOption(opts)
 
-	return result, nil
+	src, err := sOpt.searchSource(searchText, targetFields)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	res, err := s.iClient.raw.Search().
+		Index(index).
+		SearchSource(src.From(sOpt.from).Size(sOpt.size)).
+		Do(ctx)
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	return newSearchResponse(res), nil
 }
 
 func (r *SearchResponse) NewHitSourceIterator() *HitSourceIterator {
 	return &HitSourceIterator{
 		array: r.Sources,
+		metas: r.Metadata,
 		index: 0,
 	}
 }
 
 type HitSourceIterator struct {
 	array []json.RawMessage
+	metas []HitMeta
 	index int
 }
 
@@ -226,8 +445,14 @@ func (i *HitSourceIterator) HasNext() bool {
 	return i.index != len(i.array)
 }
 
+// Next decodes the next source into v. Hits without a source, as with
+// NoSource, leave v untouched.
 func (i *HitSourceIterator) Next(v interface{}) error {
 	if i.HasNext() {
+		if len(i.array[i.index]) == 0 {
+			i.index++
+			return nil
+		}
 		bytes := []byte(i.array[i.index])
 		err := json.Unmarshal(bytes, v)
 		if err != nil {
@@ -238,3 +463,16 @@ func (i *HitSourceIterator) Next(v interface{}) error {
 	}
 	return errors.New("No next value")
 }
+
+// NextWithMeta decodes the next source into v like Next, and returns the
+// hit's metadata along with it.
+func (i *HitSourceIterator) NextWithMeta(v interface{}) (HitMeta, error) {
+	var meta HitMeta
+	if i.index < len(i.metas) {
+		meta = i.metas[i.index]
+	}
+	if err := i.Next(v); err != nil {
+		return HitMeta{}, err
+	}
+	return meta, nil
+}
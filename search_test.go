@@ -337,3 +337,287 @@ func ExampleSearchClient_Search() {
 		panic(err)
 	}
 }
+
+func TestSearchHitMeta(t *testing.T) {
+	index := "tweets"
+	_, client := setupFake(t, "")
+	setupTestData(client.raw, index)
+
+	sClient := NewSearchClient(client)
+	res, err := sClient.Search(context.TODO(), index, "message1", []string{"message"}, Fuzziness("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Metadata) != 1 {
+		t.Fatalf("expected %v, but got %v\n", 1, len(res.Metadata))
+	}
+
+	itr := res.NewHitSourceIterator()
+	var tw tweet
+	meta, err := itr.NextWithMeta(&tw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tw.Message != tweet1.Message {
+		t.Fatalf("expected %v, but got %v\n", tweet1.Message, tw.Message)
+	}
+	if meta.ID == "" || meta.Index != index {
+		t.Fatalf("unexpected meta %+v\n", meta)
+	}
+	if meta.Score == nil || *meta.Score <= 0 {
+		t.Fatalf("expected a score, but got %v\n", meta.Score)
+	}
+	if meta.Version == nil || *meta.Version != 1 {
+		t.Fatalf("expected version %v, but got %v\n", 1, meta.Version)
+	}
+	if meta.SeqNo == nil || meta.PrimaryTerm == nil {
+		t.Fatalf("expected seq_no and primary_term, but got %+v\n", meta)
+	}
+	if _, err := itr.NextWithMeta(&tw); err == nil {
+		t.Fatal("expected error, but got nil")
+	}
+
+	if _, err := client.Delete(context.TODO(), index, meta.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = sClient.Search(context.TODO(), index, "message", []string{"message"}, SortField("created"), Order(Desc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Hits != 2 {
+		t.Fatalf("expected %v, but got %v\n", 2, res.Hits)
+	}
+	if res.Metadata[0].Score != nil || len(res.Metadata[0].Sort) != 1 {
+		t.Fatalf("unexpected meta %+v\n", res.Metadata[0])
+	}
+	if res.Metadata[0].Sort[0] != float64(tweet2.Created.UnixNano()/int64(time.Millisecond)) {
+		t.Fatalf("expected %v, but got %v\n", tweet2.Created.UnixNano()/int64(time.Millisecond), res.Metadata[0].Sort[0])
+	}
+}
+
+func TestSearchBoolClauseTypes(t *testing.T) {
+	index := "products"
+	_, client := setupFake(t, index, products()...)
+
+	sClient := NewSearchClient(client)
+	tests := []struct {
+		name     string
+		clauses  []BoolQueriesWithClauseOption
+		expected []string
+	}{
+		{
+			"range", []BoolQueriesWithClauseOption{
+				{Target: "price", Query: Range{Gte: 10, Lt: 80}, Clause: "filter", Type: "range"},
+			}, []string{"1", "2"},
+		},
+		{
+			"date range with date math", []BoolQueriesWithClauseOption{
+				{Target: "created", Query: Range{Gt: "2020-01-01||/d"}, Clause: "filter", Type: "range"},
+			}, []string{"3"},
+		},
+		{
+			"exists", []BoolQueriesWithClauseOption{
+				{Target: "reviews", Clause: "filter", Type: "exists"},
+			}, []string{"1", "2"},
+		},
+		{
+			"prefix", []BoolQueriesWithClauseOption{
+				{Target: "category", Query: "sho", Clause: "filter", Type: "prefix"},
+			}, []string{"3"},
+		},
+		{
+			"wildcard", []BoolQueriesWithClauseOption{
+				{Target: "category", Query: "s*s", Clause: "filter", Type: "wildcard"},
+			}, []string{"1", "2", "3"},
+		},
+		{
+			"regexp", []BoolQueriesWithClauseOption{
+				{Target: "category", Query: "shi.*", Clause: "filter", Type: "regexp"},
+			}, []string{"1", "2"},
+		},
+		{
+			"ids", []BoolQueriesWithClauseOption{
+				{Query: []string{"1", "3"}, Clause: "filter", Type: "ids"},
+			}, []string{"1", "3"},
+		},
+		{
+			"match", []BoolQueriesWithClauseOption{
+				{Target: "name", Query: "red", Clause: "must", Type: "match"},
+			}, []string{"1", "3"},
+		},
+		{
+			"match_phrase", []BoolQueriesWithClauseOption{
+				{Target: "name", Query: "red shirt", Clause: "must", Type: "match_phrase"},
+			}, []string{"1"},
+		},
+		{
+			"nested bool groups", []BoolQueriesWithClauseOption{
+				{Type: "bool", Clause: "filter", Query: []BoolQueriesWithClauseOption{
+					{Target: "category", Query: "shoes", Clause: "should"},
+					{Target: "name", Query: "blue", Clause: "should", Type: "match"},
+				}},
+				{Target: "price", Query: Range{Gt: 50}, Clause: "must_not", Type: "range"},
+			}, []string{"2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := sClient.Search(context.TODO(), index, "", nil, SortField("price"), BoolQueriesWithClause(tt.clauses))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, meta := range res.Metadata {
+				ids = append(ids, meta.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Fatalf("expected %v, but got %v\n", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestSearchBoolClauseErrors(t *testing.T) {
+	sClient := NewSearchClient(&IndexClient{})
+	tests := []BoolQueriesWithClauseOption{
+		{Target: "price", Query: 10, Type: "range"},
+		{Query: 1, Type: "ids"},
+		{Query: "x", Type: "bool"},
+		{Target: "price", Type: "fuzzy"},
+	}
+	for _, clause := range tests {
+		_, err := sClient.Search(context.TODO(), "products", "", nil, BoolQueriesWithClause([]BoolQueriesWithClauseOption{clause}))
+		if err == nil {
+			t.Fatalf("expected an error for %+v\n", clause)
+		}
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	index := "products"
+	_, client := setupFake(t, index, products()...)
+
+	anyField := false
+	sClient := NewSearchClient(client)
+	tests := []struct {
+		name     string
+		opt      HighlightOption
+		expected map[string][]string
+	}{
+		{
+			"defaults", HighlightOption{Fields: []string{"name"}},
+			map[string][]string{"name": {"<em>red</em> shirt"}},
+		},
+		{
+			"tags", HighlightOption{Fields: []string{"name"}, PreTags: []string{"<b>"}, PostTags: []string{"</b>"}},
+			map[string][]string{"name": {"<b>red</b> shirt"}},
+		},
+		{
+			"field not searched", HighlightOption{Fields: []string{"category"}},
+			map[string][]string{},
+		},
+		{
+			"require field match disabled", HighlightOption{Fields: []string{"name", "category"}, RequireFieldMatch: &anyField},
+			map[string][]string{"name": {"<em>red</em> shirt"}, "category": {"<em>shirts</em>"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := sClient.Search(context.TODO(), index, "red shirts", []string{"name"}, Fuzziness("0"), SortField("price"), Limit(1), Highlight(tt.opt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Metadata) != 1 || res.Metadata[0].ID != "1" {
+				t.Fatalf("expected hit %v, but got %v\n", "1", res.Metadata)
+			}
+			got := res.Metadata[0].Highlight
+			if got == nil {
+				got = map[string][]string{}
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v, but got %v\n", tt.expected, got)
+			}
+		})
+	}
+}
+
+type article struct {
+	ID    string `json:"id" esmini:"id" es:"type=keyword"`
+	Title string `json:"title" es:"store=true"`
+	Body  string `json:"body"`
+}
+
+func TestSearchSourceFiltering(t *testing.T) {
+	index := "products"
+	_, client := setupFake(t, index, products()...)
+
+	sClient := NewSearchClient(client)
+	res, err := sClient.Search(context.TODO(), index, "", nil, Sort(SortSpec{Field: "price"}),
+		SourceIncludes("name", "reviews.*"), SourceExcludes("reviews.stars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var source map[string]interface{}
+	if err := json.Unmarshal(res.Sources[0], &source); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":    "red shirt",
+		"reviews": []interface{}{map[string]interface{}{"author": "alice"}, map[string]interface{}{"author": "bob"}},
+	}
+	if !reflect.DeepEqual(source, expected) {
+		t.Fatalf("expected %v, but got %v\n", expected, source)
+	}
+
+	res, err = sClient.Search(context.TODO(), index, "", nil, Sort(SortSpec{Field: "price"}),
+		NoSource(), DocValueFields("category", "created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Sources[0]) != 0 {
+		t.Fatalf("expected no source, but got %s\n", res.Sources[0])
+	}
+	var p product
+	itr := res.NewHitSourceIterator()
+	meta, err := itr.NextWithMeta(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFields := map[string][]interface{}{
+		"category": {"shirts"},
+		"created":  {"2020-01-01T12:00:00.000Z"},
+	}
+	if !reflect.DeepEqual(meta.Fields, expectedFields) {
+		t.Fatalf("expected %v, but got %v\n", expectedFields, meta.Fields)
+	}
+
+	if _, err := sClient.Search(context.TODO(), index, "", nil, DocValueFields("name")); err == nil {
+		t.Fatal("expected an error for doc values of a text field")
+	}
+}
+
+func TestSearchStoredFields(t *testing.T) {
+	index := "articles"
+	_, client := setupFake(t, index, article{ID: "1", Title: "title", Body: "body"})
+
+	sClient := NewSearchClient(client)
+	res, err := sClient.Search(context.TODO(), index, "", nil, StoredFields("title", "body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a article
+	meta, err := res.NewHitSourceIterator().NextWithMeta(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Body != "body" {
+		t.Fatalf("expected the source to be kept, but got %+v\n", a)
+	}
+	expected := map[string][]interface{}{"title": {"title"}}
+	if !reflect.DeepEqual(meta.Fields, expected) {
+		t.Fatalf("expected %v, but got %v\n", expected, meta.Fields)
+	}
+}
@@ -0,0 +1,100 @@
+package esmini
+
+import (
+	"errors"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// SortSpec is one level of a multi-field sort. Field can be a field name,
+// "_score" or "_doc".
+type SortSpec struct {
+	Field string
+	// Order defaults to Asc, or to Desc for "_score", so that the best
+	// matches come first.
+	Order *SearchOrder
+	// Missing places documents without the field: "_first", "_last" or a
+	// value to sort them as.
+	Missing interface{}
+	// Mode picks the value of array fields: "min", "max", "avg", "sum" or
+	// "median".
+	Mode         string
+	UnmappedType string
+	// GeoDistance sorts by the distance between Field, a geo_point, and a
+	// point.
+	GeoDistance *GeoDistanceSort
+	// Script sorts by the value of a script instead of a field.
+	Script *ScriptSort
+}
+
+type GeoDistanceSort struct {
+	Lat          float64
+	Lon          float64
+	Unit         string // Unit can be "m", "km", "mi", ...; defaults to "m"
+	DistanceType string // DistanceType can be "arc" or "plane"
+}
+
+// ScriptSort is a Painless script computing the sort value of a document.
+type ScriptSort struct {
+	Source string
+	Params map[string]interface{}
+	Type   string // Type can be "number" or "string"; defaults to "number"
+}
+
+// Sort orders hits by specs, in order. It is applied after SortField when
+// both are set.
+func Sort(specs ...SortSpec) SearchOption {
+	return func(s *searchOption) {
+		s.sortSpecs = append(s.sortSpecs, specs...)
+	}
+}
+
+func (spec SortSpec) sorter() (elastic.Sorter, error) {
+	asc := spec.Order == nil || *spec.Order == Asc
+
+	switch {
+	case spec.Script != nil:
+		typ := spec.Script.Type
+		if typ == "" {
+			typ = "number"
+		}
+		script := elastic.NewScript(spec.Script.Source).Lang("painless")
+		if len(spec.Script.Params) > 0 {
+			script = script.Params(spec.Script.Params)
+		}
+		s := elastic.NewScriptSort(script, typ).Order(asc)
+		if len(spec.Mode) > 0 {
+			s = s.SortMode(spec.Mode)
+		}
+		return s, nil
+	case len(spec.Field) == 0:
+		return nil, errors.New("esmini: sort spec needs a Field or a Script")
+	case spec.GeoDistance != nil:
+		g := spec.GeoDistance
+		s := elastic.NewGeoDistanceSort(spec.Field).Point(g.Lat, g.Lon).Order(asc)
+		if len(g.Unit) > 0 {
+			s = s.Unit(g.Unit)
+		}
+		if len(g.DistanceType) > 0 {
+			s = s.DistanceType(g.DistanceType)
+		}
+		if len(spec.Mode) > 0 {
+			s = s.SortMode(spec.Mode)
+		}
+		return s, nil
+	case spec.Field == "_score":
+		return elastic.NewScoreSort().Order(spec.Order != nil && *spec.Order == Asc), nil
+	}
+
+	s := elastic.NewFieldSort(spec.Field).Order(asc)
+	if spec.Missing != nil {
+		s = s.Missing(spec.Missing)
+	}
+	if len(spec.Mode) > 0 {
+		s = s.SortMode(spec.Mode)
+	}
+	if len(spec.UnmappedType) > 0 {
+		s = s.UnmappedType(spec.UnmappedType)
+	}
+	return s, nil
+}
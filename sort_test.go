@@ -0,0 +1,117 @@
+package esmini
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type place struct {
+	ID       string `json:"id" esmini:"id" es:"type=keyword"`
+	Pinned   bool   `json:"pinned"`
+	Ratings  []int  `json:"ratings,omitempty"`
+	Location string `json:"location" es:"type=geo_point"`
+	Price    int    `json:"price"`
+}
+
+func places() []interface{} {
+	return []interface{}{
+		place{ID: "1", Ratings: []int{1, 5}, Location: "35.68,139.76", Price: 10},
+		place{ID: "2", Pinned: true, Ratings: []int{4}, Location: "34.69,135.50", Price: 30},
+		place{ID: "3", Location: "43.06,141.35", Price: 20},
+		place{ID: "4", Ratings: []int{2, 3}, Location: "35.00,135.77", Price: 5},
+	}
+}
+
+func TestSearchSort(t *testing.T) {
+	index := "places"
+	_, client := setupFake(t, index, places()...)
+	desc := Desc
+
+	sClient := NewSearchClient(client)
+	tests := []struct {
+		name     string
+		specs    []SortSpec
+		expected []string
+	}{
+		{
+			"multiple fields with mode", []SortSpec{
+				{Field: "pinned", Order: &desc},
+				{Field: "ratings", Order: &desc, Mode: "avg"},
+			}, []string{"2", "1", "4", "3"},
+		},
+		{
+			"missing first", []SortSpec{
+				{Field: "ratings", Missing: "_first"},
+			}, []string{"3", "1", "4", "2"},
+		},
+		{
+			"missing value", []SortSpec{
+				{Field: "ratings", Missing: 10, UnmappedType: "long"},
+			}, []string{"1", "4", "2", "3"},
+		},
+		{
+			"doc", []SortSpec{
+				{Field: "_doc"},
+			}, []string{"1", "2", "3", "4"},
+		},
+		{
+			"geo distance", []SortSpec{
+				{Field: "location", GeoDistance: &GeoDistanceSort{Lat: 35.01, Lon: 135.76, Unit: "km"}},
+			}, []string{"4", "2", "1", "3"},
+		},
+		{
+			"script", []SortSpec{
+				{Script: &ScriptSort{Source: "doc['price'].value * params.factor", Params: map[string]interface{}{"factor": 2}}, Order: &desc},
+			}, []string{"2", "3", "1", "4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := sClient.Search(context.TODO(), index, "", nil, Sort(tt.specs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, meta := range res.Metadata {
+				ids = append(ids, meta.ID)
+				if len(meta.Sort) != len(tt.specs) {
+					t.Fatalf("expected %v sort values, but got %v\n", len(tt.specs), meta.Sort)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.expected) {
+				t.Fatalf("expected %v, but got %v\n", tt.expected, ids)
+			}
+		})
+	}
+
+	if _, err := sClient.Search(context.TODO(), index, "", nil, Sort(SortSpec{Order: &desc})); err == nil {
+		t.Fatal("expected an error for a sort spec without a field")
+	}
+}
+
+func TestSortSpecScoreOrder(t *testing.T) {
+	asc := Asc
+	for _, tt := range []struct {
+		spec     SortSpec
+		expected string
+	}{
+		{SortSpec{Field: "_score"}, "desc"},
+		{SortSpec{Field: "_score", Order: &asc}, "asc"},
+		{SortSpec{Field: "price"}, "asc"},
+	} {
+		sorter, err := tt.spec.sorter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := sorter.Source()
+		if err != nil {
+			t.Fatal(err)
+		}
+		order := src.(map[string]interface{})[tt.spec.Field].(map[string]interface{})["order"]
+		if order != tt.expected {
+			t.Fatalf("expected %v, but got %v\n", tt.expected, order)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// DefaultWaitInterval is how often Task.Wait polls when given a
+// non-positive interval.
+const DefaultWaitInterval = time.Second
+
+// ErrTaskCanceled is returned by Task.Wait when the task was cancelled
+// before it completed.
+var ErrTaskCanceled = errors.New("esmini: task canceled")
+
+// ByQueryError is returned when an update or delete by query or a reindex
+// stopped on failed documents, including the version conflicts it was not
+// told to proceed on. Response counts the documents processed before it
+// stopped.
+type ByQueryError struct {
+	Response *elastic.BulkIndexByScrollResponse
+}
+
+func (e *ByQueryError) Error() string {
+	f := e.Response.Failures[0]
+	return fmt.Sprintf("esmini: %d document(s) failed, first %s/%s with status %d", len(e.Response.Failures), f.Index, f.Id, f.Status)
+}
+
+// Is reports whether the request stopped on a version conflict, so that
+// errors.Is(err, ErrConflict) holds.
+func (e *ByQueryError) Is(target error) bool {
+	if target != ErrConflict {
+		return false
+	}
+	for _, f := range e.Response.Failures {
+		if f.Status == http.StatusConflict {
+			return true
+		}
+	}
+	return false
+}
+
+// Task is a request running in the background on the cluster, started by
+// Reindex or one of the Async methods.
+type Task struct {
+	ID string
+
+	client   *IndexClient
+	endpoint string
+}
+
+// TaskStatus is the progress of a Task. Response is set once it completed,
+// and Error if it failed before processing any document.
+type TaskStatus struct {
+	Completed         bool                               `json:"-"`
+	Action            string                             `json:"-"`
+	Total             int64                              `json:"total"`
+	Created           int64                              `json:"created"`
+	Updated           int64                              `json:"updated"`
+	Deleted           int64                              `json:"deleted"`
+	Batches           int64                              `json:"batches"`
+	VersionConflicts  int64                              `json:"version_conflicts"`
+	Noops             int64                              `json:"noops"`
+	RequestsPerSecond float64                            `json:"requests_per_second"`
+	Canceled          string                             `json:"canceled"`
+	Response          *elastic.BulkIndexByScrollResponse `json:"-"`
+	Error             *elastic.ErrorDetails              `json:"-"`
+}
+
+// Status fetches the current progress of t.
+func (t *Task) Status(ctx context.Context) (*TaskStatus, error) {
+	res, err := t.client.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodGet,
+		Path:   "/_tasks/" + url.PathEscape(t.ID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Completed bool `json:"completed"`
+		Task      struct {
+			Action string          `json:"action"`
+			Status json.RawMessage `json:"status"`
+		} `json:"task"`
+		Response *elastic.BulkIndexByScrollResponse `json:"response"`
+		Error    *elastic.ErrorDetails              `json:"error"`
+	}
+	if err := json.Unmarshal(res.Body, &result); err != nil {
+		return nil, err
+	}
+
+	status := &TaskStatus{}
+	if len(result.Task.Status) > 0 {
+		if err := json.Unmarshal(result.Task.Status, status); err != nil {
+			return nil, err
+		}
+	}
+	status.Completed = result.Completed
+	status.Action = result.Task.Action
+	status.Response = result.Response
+	status.Error = result.Error
+	return status, nil
+}
+
+// Wait polls t every interval, or DefaultWaitInterval if it is not
+// positive, until it completes, calling progress, if not nil, with every
+// status fetched. It returns ErrTaskCanceled if t was cancelled, and a
+// *ByQueryError if it stopped on failed documents; the response is returned
+// along with either.
+func (t *Task) Wait(ctx context.Context, interval time.Duration, progress func(*TaskStatus)) (*elastic.BulkIndexByScrollResponse, error) {
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := t.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(status)
+		}
+		if status.Completed {
+			return status.result(t.ID)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *TaskStatus) result(id string) (*elastic.BulkIndexByScrollResponse, error) {
+	switch {
+	case s.Error != nil:
+		return nil, fmt.Errorf("esmini: task %s failed: %s: %s", id, s.Error.Type, s.Error.Reason)
+	case s.Response == nil:
+		return nil, fmt.Errorf("esmini: task %s completed without a response", id)
+	}
+	return byQueryResult(s.Response)
+}
+
+// Cancel asks the cluster to stop t. Documents already processed stay
+// changed; Wait then returns ErrTaskCanceled.
+func (t *Task) Cancel(ctx context.Context) error {
+	_, err := t.client.raw.TasksCancel().TaskId(t.ID).Do(ctx)
+	return err
+}
+
+// Rethrottle changes how many documents per second t processes. A
+// non-positive rps removes the limit.
+func (t *Task) Rethrottle(ctx context.Context, rps float64) error {
+	_, err := t.client.raw.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/" + t.endpoint + "/" + url.PathEscape(t.ID) + "/_rethrottle",
+		Params: url.Values{"requests_per_second": []string{formatRequestsPerSecond(rps)}},
+	})
+	return err
+}
+
+func formatRequestsPerSecond(rps float64) string {
+	if rps <= 0 {
+		return "-1"
+	}
+	return strconv.FormatFloat(rps, 'f', -1, 64)
+}
+
+// byQueryResult returns res along with a *ByQueryError or ErrTaskCanceled
+// when it did not process every document.
+func byQueryResult(res *elastic.BulkIndexByScrollResponse) (*elastic.BulkIndexByScrollResponse, error) {
+	switch {
+	case len(res.Failures) > 0:
+		return res, &ByQueryError{Response: res}
+	case len(res.Canceled) > 0:
+		return res, ErrTaskCanceled
+	}
+	return res, nil
+}
@@ -0,0 +1,240 @@
+package esmini
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Settings are index settings, built like:
+//
+//	esmini.NewSettings().Shards(1).Replicas(0).RefreshInterval(30 * time.Second)
+type Settings struct {
+	values map[string]interface{}
+}
+
+// NewSettings returns empty index settings.
+func NewSettings() *Settings {
+	return &Settings{values: map[string]interface{}{}}
+}
+
+// Shards sets the number of primary shards.
+func (s *Settings) Shards(n int) *Settings {
+	return s.Set("number_of_shards", n)
+}
+
+// Replicas sets the number of replicas of each primary shard.
+func (s *Settings) Replicas(n int) *Settings {
+	return s.Set("number_of_replicas", n)
+}
+
+// RefreshInterval sets how often changes become visible to search. A
+// negative interval disables periodic refreshes.
+func (s *Settings) RefreshInterval(interval time.Duration) *Settings {
+	if interval < 0 {
+		return s.Set("refresh_interval", "-1")
+	}
+	return s.Set("refresh_interval", fmt.Sprintf("%dms", interval.Milliseconds()))
+}
+
+// DefaultPipeline sends documents indexed without a pipeline through the
+// ingest pipeline of that name.
+func (s *Settings) DefaultPipeline(pipeline string) *Settings {
+	return s.Set("default_pipeline", pipeline)
+}
+
+// Set sets any other index setting, e.g. "analysis", with name relative to
+// "index.".
+func (s *Settings) Set(name string, value interface{}) *Settings {
+	s.values[name] = value
+	return s
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *Settings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.values)
+}
+
+// Property is the mapping of one field, built like:
+//
+//	esmini.NewProperty("text").Analyzer("english").Field("raw", esmini.NewProperty("keyword"))
+type Property struct {
+	params     map[string]interface{}
+	properties map[string]*Property
+	fields     map[string]*Property
+}
+
+// NewProperty returns the mapping of a field of type typ, such as
+// "keyword", "text", "long", "date", "object" or "nested".
+func NewProperty(typ string) *Property {
+	return &Property{params: map[string]interface{}{"type": typ}}
+}
+
+// Analyzer sets the analyzer of a text field.
+func (p *Property) Analyzer(analyzer string) *Property {
+	return p.Param("analyzer", analyzer)
+}
+
+// Format sets the accepted formats of a date field, e.g.
+// "strict_date_optional_time||epoch_millis".
+func (p *Property) Format(format string) *Property {
+	return p.Param("format", format)
+}
+
+// Index sets whether the field is searchable.
+func (p *Property) Index(index bool) *Property {
+	return p.Param("index", index)
+}
+
+// Param sets any other mapping parameter of the field.
+func (p *Property) Param(name string, value interface{}) *Property {
+	p.params[name] = value
+	return p
+}
+
+// Property adds a sub-field to an object or nested field.
+func (p *Property) Property(name string, sub *Property) *Property {
+	if p.properties == nil {
+		p.properties = map[string]*Property{}
+	}
+	p.properties[name] = sub
+	return p
+}
+
+// Field indexes the field a second way, as name.<name> with the mapping of
+// sub, e.g. a keyword field for sorting a text field.
+func (p *Property) Field(name string, sub *Property) *Property {
+	if p.fields == nil {
+		p.fields = map[string]*Property{}
+	}
+	p.fields[name] = sub
+	return p
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p *Property) MarshalJSON() ([]byte, error) {
+	source := make(map[string]interface{}, len(p.params)+2)
+	for k, v := range p.params {
+		source[k] = v
+	}
+	if len(p.properties) > 0 {
+		source["properties"] = p.properties
+	}
+	if len(p.fields) > 0 {
+		source["fields"] = p.fields
+	}
+	return json.Marshal(source)
+}
+
+// Mapping is the mapping of the fields of an index, built like:
+//
+//	esmini.NewMapping().
+//		Dynamic("strict").
+//		Property("user", esmini.NewProperty("keyword")).
+//		Property("message", esmini.NewProperty("text"))
+type Mapping struct {
+	dynamic    string
+	properties map[string]interface{}
+}
+
+// NewMapping returns a mapping without fields.
+func NewMapping() *Mapping {
+	return &Mapping{properties: map[string]interface{}{}}
+}
+
+// NewMappingFor returns the mapping GenerateMapping builds for v's type,
+// to which more fields can be added.
+func NewMappingFor(v interface{}) (*Mapping, error) {
+	mapping, err := GenerateMapping(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Mapping{properties: mapping["properties"].(map[string]interface{})}, nil
+}
+
+// Dynamic sets how fields missing from the mapping are handled: "true"
+// adds them, "false" ignores them and "strict" rejects the document.
+func (m *Mapping) Dynamic(dynamic string) *Mapping {
+	m.dynamic = dynamic
+	return m
+}
+
+// Property maps the field name, replacing any mapping it had.
+func (m *Mapping) Property(name string, p *Property) *Mapping {
+	m.properties[name] = p
+	return m
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m *Mapping) MarshalJSON() ([]byte, error) {
+	source := map[string]interface{}{"properties": m.properties}
+	if len(m.dynamic) > 0 {
+		source["dynamic"] = m.dynamic
+	}
+	return json.Marshal(source)
+}
+
+// Template holds the settings, mappings and aliases of an index. It is the
+// body of IndexTemplate and ComponentTemplate; marshaled, it is also a body
+// for CreateIndexWithMapping.
+type Template struct {
+	settings *Settings
+	mapping  *Mapping
+	aliases  map[string][]BoolQueriesWithClauseOption
+}
+
+// NewTemplate returns an empty Template.
+func NewTemplate() *Template {
+	return &Template{}
+}
+
+// Settings sets the index settings.
+func (t *Template) Settings(settings *Settings) *Template {
+	t.settings = settings
+	return t
+}
+
+// Mapping sets the mapping.
+func (t *Template) Mapping(mapping *Mapping) *Template {
+	t.mapping = mapping
+	return t
+}
+
+// Alias adds the alias name, limited to the documents matching every
+// clause of filter if it is not empty.
+func (t *Template) Alias(name string, filter []BoolQueriesWithClauseOption) *Template {
+	if t.aliases == nil {
+		t.aliases = map[string][]BoolQueriesWithClauseOption{}
+	}
+	t.aliases[name] = filter
+	return t
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t *Template) MarshalJSON() ([]byte, error) {
+	source := map[string]interface{}{}
+	if t.settings != nil {
+		source["settings"] = t.settings
+	}
+	if t.mapping != nil {
+		source["mappings"] = t.mapping
+	}
+	if len(t.aliases) > 0 {
+		aliases := make(map[string]interface{}, len(t.aliases))
+		for name, filter := range t.aliases {
+			a := map[string]interface{}{}
+			if len(filter) > 0 {
+				query, err := (&searchOption{boolQueriesWithClause: filter}).query("", nil)
+				if err != nil {
+					return nil, err
+				}
+				if a["filter"], err = query.Source(); err != nil {
+					return nil, err
+				}
+			}
+			aliases[name] = a
+		}
+		source["aliases"] = aliases
+	}
+	return json.Marshal(source)
+}
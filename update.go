@@ -0,0 +1,264 @@
+package esmini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+type updateOption struct {
+	fields          []string
+	upsert          interface{}
+	docAsUpsert     bool
+	scriptedUpsert  bool
+	retryOnConflict int
+	returnSource    bool
+}
+
+// UpdateFields limits a struct update to the given JSON fields, dotted for
+// nested objects, including zero values. Without it, only the non-zero
+// fields of a struct are sent.
+func UpdateFields(fields ...string) WriteOption {
+	return func(w *writeOption) {
+		w.update.fields = append(w.update.fields, fields...)
+	}
+}
+
+// Upsert is indexed by Update or UpdateWithScript when the document does
+// not exist.
+func Upsert(doc interface{}) WriteOption {
+	return func(w *writeOption) {
+		w.update.upsert = doc
+	}
+}
+
+// DocAsUpsert indexes the partial document of Update when the document does
+// not exist.
+func DocAsUpsert() WriteOption {
+	return func(w *writeOption) {
+		w.update.docAsUpsert = true
+	}
+}
+
+// ScriptedUpsert runs the script of UpdateWithScript on the Upsert document
+// too, instead of indexing it as is.
+func ScriptedUpsert() WriteOption {
+	return func(w *writeOption) {
+		w.update.scriptedUpsert = true
+	}
+}
+
+// RetryOnConflict lets Elasticsearch retry an update that conflicts with a
+// concurrent write. It cannot be combined with IfSeqNo.
+func RetryOnConflict(retries int) WriteOption {
+	return func(w *writeOption) {
+		w.update.retryOnConflict = retries
+	}
+}
+
+// ReturnSource returns the updated document in the GetResult of the
+// response.
+func ReturnSource() WriteOption {
+	return func(w *writeOption) {
+		w.update.returnSource = true
+	}
+}
+
+// Update merges doc into the document id. doc can be a map of fields, sent
+// as is, or a struct, of which only the non-zero fields are sent, down into
+// nested structs, unless UpdateFields names them. With IfSeqNo, conflicting
+// writes return a *ConflictError.
+func (i *IndexClient) Update(ctx context.Context, index string, id string, doc interface{}, opts ...WriteOption) (*elastic.UpdateResponse, error) {
+	wOpt := newWriteOption(opts)
+	partial, err := partialDoc(doc, wOpt.update.fields)
+	if err != nil {
+		return nil, err
+	}
+	svc, err := i.updateService(index, id, wOpt)
+	if err != nil {
+		return nil, err
+	}
+	svc = svc.Doc(partial)
+	if wOpt.update.docAsUpsert {
+		svc = svc.DocAsUpsert(true)
+	}
+	res, err := svc.Do(ctx)
+	return res, asConflict(index, id, err)
+}
+
+// UpdateWithScript updates the document id with a Painless script, e.g.
+//
+//	client.UpdateWithScript(ctx, "tweets", "1", esmini.Script{
+//		Source: "ctx._source.retweets += params.n",
+//		Params: map[string]interface{}{"n": 1},
+//	}, esmini.Upsert(tweet{ID: 1, Retweets: 1}))
+func (i *IndexClient) UpdateWithScript(ctx context.Context, index, id string, script Script, opts ...WriteOption) (*elastic.UpdateResponse, error) {
+	wOpt := newWriteOption(opts)
+	svc, err := i.updateService(index, id, wOpt)
+	if err != nil {
+		return nil, err
+	}
+	svc = svc.Script(script.build())
+	if wOpt.update.scriptedUpsert {
+		svc = svc.ScriptedUpsert(true)
+	}
+	res, err := svc.Do(ctx)
+	return res, asConflict(index, id, err)
+}
+
+func (i *IndexClient) updateService(index, id string, wOpt *writeOption) (*elastic.UpdateService, error) {
+	if wOpt.version != nil {
+		return nil, fmt.Errorf("esmini: Update does not support versions, use IfSeqNo")
+	}
+	if wOpt.ifSeqNo != nil && wOpt.update.retryOnConflict > 0 {
+		return nil, fmt.Errorf("esmini: RetryOnConflict cannot be combined with IfSeqNo")
+	}
+	svc := i.raw.Update().
+		Index(index).
+		Id(id).
+		Refresh(i.refreshPolicy(wOpt.refresh, RefreshTrue))
+	if len(wOpt.routing) > 0 {
+		svc = svc.Routing(wOpt.routing)
+	}
+	if wOpt.ifSeqNo != nil {
+		svc = svc.IfSeqNo(*wOpt.ifSeqNo).IfPrimaryTerm(*wOpt.ifPrimaryTerm)
+	}
+	if wOpt.update.upsert != nil {
+		svc = svc.Upsert(wOpt.update.upsert)
+	}
+	if wOpt.update.retryOnConflict > 0 {
+		svc = svc.RetryOnConflict(wOpt.update.retryOnConflict)
+	}
+	if wOpt.update.returnSource {
+		svc = svc.FetchSource(true)
+	}
+	return svc, nil
+}
+
+// partialDoc returns the fields of doc an update sends: a map as is, the
+// non-zero fields of a struct, or the fields named by mask. Zero fields of
+// nested structs are left out too; slices are sent whole.
+func partialDoc(doc interface{}, mask []string) (interface{}, error) {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Map && len(mask) == 0 {
+		return doc, nil
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var full map[string]interface{}
+	if err := dec.Decode(&full); err != nil {
+		return nil, fmt.Errorf("esmini: update document must be an object: %w", err)
+	}
+
+	if len(mask) > 0 {
+		partial := map[string]interface{}{}
+		for _, p := range mask {
+			v, ok := lookupField(full, p)
+			if !ok {
+				return nil, fmt.Errorf("esmini: update field %s not found in %T", p, doc)
+			}
+			setField(partial, p, v)
+		}
+		return partial, nil
+	}
+
+	if v.Kind() == reflect.Struct {
+		dropZeroFields(full, v)
+	}
+	return full, nil
+}
+
+// dropZeroFields deletes the fields of m encoded from a zero field of
+// struct v, recursing into the objects encoded from nested structs.
+func dropZeroFields(m map[string]interface{}, v reflect.Value) {
+	for name, encoded := range m {
+		fv, ok := jsonField(v, name)
+		if !ok {
+			continue
+		}
+		if fv.IsZero() {
+			delete(m, name)
+			continue
+		}
+		for fv.Kind() == reflect.Ptr {
+			fv = fv.Elem()
+		}
+		if nested, ok := encoded.(map[string]interface{}); ok && fv.Kind() == reflect.Struct {
+			dropZeroFields(nested, fv)
+		}
+	}
+}
+
+// jsonField finds the field of struct v encoded under the JSON key name,
+// looking into embedded structs like encoding/json does.
+func jsonField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for j := 0; j < t.NumField(); j++ {
+		f := t.Field(j)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		fv := v.Field(j)
+		if f.Anonymous && tag == "" {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if found, ok := jsonField(fv, name); ok {
+					return found, true
+				}
+			}
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return fv, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func lookupField(m map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	v, ok := m[parts[len(parts)-1]]
+	return v, ok
+}
+
+func setField(m map[string]interface{}, path string, v interface{}) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[part] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+}
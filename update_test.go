@@ -0,0 +1,150 @@
+package esmini
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestUpdateStruct(t *testing.T) {
+	_, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	if _, err := client.IndexDoc(ctx, index, counter{ID: "1", Count: 5, Tags: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		doc      interface{}
+		opts     []WriteOption
+		expected counter
+	}{
+		{"non-zero fields", counter{Tags: []string{"b"}}, nil, counter{ID: "1", Count: 5, Tags: []string{"b"}}},
+		{"pointer", &counter{Count: 7}, nil, counter{ID: "1", Count: 7, Tags: []string{"b"}}},
+		{"field mask", counter{Tags: []string{"c"}}, []WriteOption{UpdateFields("count")}, counter{ID: "1", Count: 0, Tags: []string{"b"}}},
+		{"map", map[string]interface{}{"count": 3}, nil, counter{ID: "1", Count: 3, Tags: []string{"b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Update(ctx, index, "1", tt.doc, append(tt.opts, ReturnSource())...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.GetResult == nil {
+				t.Fatal("expected the updated source")
+			}
+			var got counter
+			if err := json.Unmarshal(res.GetResult.Source, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Fatalf("expected %v, but got %v\n", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := client.Update(ctx, index, "1", counter{}, UpdateFields("missing")); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+	if _, err := client.Update(ctx, index, "2", counter{ID: "2", Count: 2}, DocAsUpsert()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Update(ctx, index, "3", map[string]interface{}{"count": 1}, Upsert(counter{ID: "3", Count: 30})); err != nil {
+		t.Fatal(err)
+	}
+	for id, count := range map[string]int{"2": 2, "3": 30} {
+		var c counter
+		if _, err := client.Get(ctx, index, id, &c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Count != count {
+			t.Fatalf("expected %v for %v, but got %v\n", count, id, c.Count)
+		}
+	}
+	if _, err := client.Update(ctx, index, "1", counter{Count: 1}, RetryOnConflict(3), IfSeqNo(0, 1)); err == nil {
+		t.Fatal("expected an error combining RetryOnConflict and IfSeqNo")
+	}
+}
+
+func TestUpdateWithScript(t *testing.T) {
+	srv, client := setupFake(t, "")
+
+	ctx := context.TODO()
+	index := "counters"
+	increment := Script{Source: "ctx._source.count += params.n", Params: map[string]interface{}{"n": 2}}
+
+	res, err := client.UpdateWithScript(ctx, index, "1", increment, Upsert(counter{ID: "1", Count: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Result != "created" {
+		t.Fatalf("expected %v, but got %v\n", "created", res.Result)
+	}
+	res, err = client.UpdateWithScript(ctx, index, "1", increment, RetryOnConflict(3), ReturnSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c counter
+	if err := json.Unmarshal(res.GetResult.Source, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Count != 3 {
+		t.Fatalf("expected %v, but got %v\n", 3, c.Count)
+	}
+
+	if _, err := client.UpdateWithScript(ctx, index, "2", increment, Upsert(counter{ID: "2", Count: 10}), ScriptedUpsert()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ctx, index, "2", &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Count != 12 {
+		t.Fatalf("expected %v, but got %v\n", 12, c.Count)
+	}
+
+	res, err = client.UpdateWithScript(ctx, index, "2", Script{Source: "ctx.op = 'delete'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Result != "deleted" || srv.DocCount(index) != 1 {
+		t.Fatalf("expected %v, but got %v\n", "deleted", res.Result)
+	}
+
+	if _, err := client.UpdateWithScript(ctx, index, "9", increment); !elastic.IsNotFound(err) {
+		t.Fatalf("expected not found error, but got %v\n", err)
+	}
+}
+
+func TestPartialDoc(t *testing.T) {
+	big := map[string]interface{}{"n": int64(9007199254740993)}
+	got, err := partialDoc(big, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(got); string(b) != `{"n":9007199254740993}` {
+		t.Fatalf("expected %v, but got %s\n", `{"n":9007199254740993}`, b)
+	}
+
+	type author struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	type post struct {
+		Views  int64   `json:"views"`
+		Author author  `json:"author"`
+		Editor *author `json:"editor"`
+	}
+	got, err = partialDoc(post{Views: 9007199254740993, Author: author{Name: "a"}, Editor: &author{Email: "e"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(got)
+	if expected := `{"author":{"name":"a"},"editor":{"email":"e"},"views":9007199254740993}`; string(b) != expected {
+		t.Fatalf("expected %v, but got %s\n", expected, b)
+	}
+}